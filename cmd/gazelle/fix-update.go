@@ -48,14 +48,28 @@ type updateConfig struct {
 	walkMode       walk.Mode
 	patchPath      string
 	patchBuffer    bytes.Buffer
+	manifestPath   string
+	depsManifest   resolve.DepsManifest
+
+	// reportDepChanges indicates that changes to dependencies should be
+	// recorded in depChanges and reported instead of writing build files.
+	// Set with -mode=report.
+	reportDepChanges bool
+	depChanges       []resolve.RuleDepChange
+
+	// pruneRedundantDeps indicates that direct dependencies already provided
+	// by other direct dependencies should be removed after resolution.
+	pruneRedundantDeps bool
 }
 
 type emitFunc func(c *config.Config, f *rule.File) error
 
 var modeFromName = map[string]emitFunc{
-	"print": printFile,
-	"fix":   fixFile,
-	"diff":  diffFile,
+	"print":  printFile,
+	"fix":    fixFile,
+	"diff":   diffFile,
+	"deps":   skipFile,
+	"report": skipFile,
 }
 
 const updateName = "_update"
@@ -77,9 +91,11 @@ func (ucr *updateConfigurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *conf
 
 	c.ShouldFix = cmd == "fix"
 
-	fs.StringVar(&ucr.mode, "mode", "fix", "print: prints all of the updated BUILD files\n\tfix: rewrites all of the BUILD files in place\n\tdiff: computes the rewrite but then just does a diff")
+	fs.StringVar(&ucr.mode, "mode", "fix", "print: prints all of the updated BUILD files\n\tfix: rewrites all of the BUILD files in place\n\tdiff: computes the rewrite but then just does a diff\n\tdeps: prints a JSON manifest of resolved dependencies without changing files\n\treport: prints a JSON list of dependencies each rule would gain and lose without changing files")
 	fs.BoolVar(&ucr.recursive, "r", true, "when true, gazelle will update subdirectories recursively")
 	fs.StringVar(&uc.patchPath, "patch", "", "when set with -mode=diff, gazelle will write to a file instead of stdout")
+	fs.StringVar(&uc.manifestPath, "manifest", "", "when set with -mode=deps or -mode=report, gazelle will write the manifest or report to a file instead of stdout")
+	fs.BoolVar(&uc.pruneRedundantDeps, "prune_redundant_deps", false, "when true, gazelle will omit dependencies that are embedded by other dependencies of the same rule")
 	fs.Var(&gzflag.MultiFlag{Values: &ucr.knownImports}, "known_import", "import path for which external resolution is skipped (can specify multiple times)")
 	fs.StringVar(&ucr.repoConfigPath, "repo_config", "", "file where Gazelle should load repository configuration. Defaults to WORKSPACE.")
 }
@@ -95,6 +111,13 @@ func (ucr *updateConfigurer) CheckFlags(fs *flag.FlagSet, c *config.Config) erro
 	if uc.patchPath != "" && ucr.mode != "diff" {
 		return fmt.Errorf("-patch set but -mode is %s, not diff", ucr.mode)
 	}
+	if uc.manifestPath != "" && ucr.mode != "deps" && ucr.mode != "report" {
+		return fmt.Errorf("-manifest set but -mode is %s, not deps or report", ucr.mode)
+	}
+	if ucr.mode == "deps" {
+		uc.depsManifest = make(resolve.DepsManifest)
+	}
+	uc.reportDepChanges = ucr.mode == "report"
 
 	dirs := fs.Args()
 	if len(dirs) == 0 {
@@ -242,15 +265,20 @@ func runFixUpdate(cmd command, args []string) (err error) {
 	mrslv := newMetaResolver()
 	kinds := make(map[string]rule.KindInfo)
 	loads := genericLoads
+	// The module map resolver comes first, so results from a module map
+	// passed with -module_map are preferred over other cross resolvers.
+	exts := make([]interface{}, 0, len(languages)+1)
+	exts = append(exts, resolve.ModuleMapResolver{})
 	for _, lang := range languages {
 		cexts = append(cexts, lang)
+		exts = append(exts, lang)
 		for kind, info := range lang.Kinds() {
 			mrslv.AddBuiltin(kind, lang)
 			kinds[kind] = info
 		}
 		loads = append(loads, lang.Loads()...)
 	}
-	ruleIndex := resolve.NewRuleIndex(mrslv.Resolver)
+	ruleIndex := resolve.NewRuleIndex(mrslv.Resolver, exts...)
 
 	c, err := newFixUpdateConfiguration(cmd, args, cexts)
 	if err != nil {
@@ -261,6 +289,13 @@ func runFixUpdate(cmd command, args []string) (err error) {
 		return err
 	}
 
+	resolve.SetIndexParallelism(c, ruleIndex)
+
+	// Reuse indexing results for unchanged build files from an earlier run.
+	if err := resolve.AttachIndexCache(c, ruleIndex); err != nil {
+		return err
+	}
+
 	if cmd == fixCmd {
 		// Only check the version when "fix" is run. Generated build files
 		// frequently work with older version of rules_go, and we don't want to
@@ -268,17 +303,19 @@ func runFixUpdate(cmd command, args []string) (err error) {
 		checkRulesGoVersion(c.RepoRoot)
 	}
 
-	// Visit all directories in the repository.
+	// Visit all directories in the repository. Build files are indexed
+	// together after the walk, so they can be indexed concurrently.
 	var visits []visitRecord
+	var indexed []resolve.IndexedFile
 	uc := getUpdateConfig(c)
 	walk.Walk(c, cexts, uc.dirs, uc.walkMode, func(dir, rel string, c *config.Config, update bool, f *rule.File, subdirs, regularFiles, genFiles []string) {
+		mrslv.Configure(rel, c)
+
 		// If this file is ignored or if Gazelle was not asked to update this
 		// directory, just index the build file and move on.
 		if !update {
 			if c.IndexLibraries && f != nil {
-				for _, r := range f.Rules {
-					ruleIndex.AddRule(c, r, f)
-				}
+				indexed = append(indexed, resolve.IndexedFile{Config: c, File: f})
 			}
 			return
 		}
@@ -352,14 +389,39 @@ func runFixUpdate(cmd command, args []string) (err error) {
 
 		// Add library rules to the dependency resolution table.
 		if c.IndexLibraries {
-			for _, r := range f.Rules {
-				ruleIndex.AddRule(c, r, f)
-			}
+			indexed = append(indexed, resolve.IndexedFile{Config: c, File: f})
 		}
 	})
+	ruleIndex.AddFiles(indexed)
+
+	// Index rules in local repositories registered with flags.
+	if c.IndexLibraries {
+		if err := resolve.IndexLocalRepositories(c, ruleIndex); err != nil {
+			return err
+		}
+	}
+
+	if err := resolve.SaveIndexCache(c, ruleIndex); err != nil {
+		return err
+	}
 
 	// Finish building the index for dependency resolution.
 	ruleIndex.Finish()
+	if cmd == dumpIndexCmd {
+		return ruleIndex.WriteJSON(os.Stdout)
+	}
+
+	// Let extensions check invariants of the whole index.
+	langRslvs := make([]resolve.Resolver, len(languages))
+	for i, lang := range languages {
+		langRslvs[i] = lang
+	}
+	if errs := resolve.ValidateIndex(c, ruleIndex, langRslvs); len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
+		}
+		return fmt.Errorf("encountered %d errors while validating the index", len(errs))
+	}
 
 	// Resolve dependencies.
 	rc, cleanupRc := repo.NewRemoteCache(uc.repos)
@@ -368,19 +430,97 @@ func runFixUpdate(cmd command, args []string) (err error) {
 			err = cerr
 		}
 	}()
+	var resolveErrs []error
+	requiredLoads := make(map[*rule.File][]rule.LoadInfo)
 	for _, v := range visits {
+		rslvs := make([]resolve.Resolver, len(v.rules))
+		for i, r := range v.rules {
+			rslvs[i] = mrslv.Resolver(r, v.pkgRel)
+		}
+		var oldDeps map[string][]label.Label
+		if uc.reportDepChanges {
+			oldDeps = make(map[string][]label.Label)
+			for _, r := range v.file.Rules {
+				oldDeps[r.Name()] = resolve.RuleDeps(r, label.New(c.RepoName, v.pkgRel, r.Name()))
+			}
+		}
+		cleanupPkg := resolve.SetupPackage(v.c, v.pkgRel, rslvs)
 		for i, r := range v.rules {
 			from := label.New(c.RepoName, v.pkgRel, r.Name())
-			mrslv.Resolver(r, v.pkgRel).Resolve(v.c, ruleIndex, rc, r, v.imports[i], from)
+			existing := findRuleByName(v.file, r.Name())
+			resolve.CopyRuleOverrides(v.c, existing, r)
+			resolveErr := resolve.ResolveRule(v.c, rslvs[i], ruleIndex, rc, r, v.imports[i], from)
+			ruleErrs := resolve.TakeUnresolved(v.c)
+			if resolveErr != nil && resolveErr != resolve.ErrStopResolving {
+				ruleErrs = append(ruleErrs, fmt.Errorf("%s: %v", from, resolveErr))
+			}
+			if len(ruleErrs) > 0 && resolve.FailFast(v.c) {
+				cleanupPkg()
+				return fmt.Errorf("%s: %v", v.file.Path, ruleErrs[0])
+			}
+			if uc.pruneRedundantDeps {
+				resolve.PruneRedundantDeps(ruleIndex, r, from)
+			}
+			resolve.CollapseUmbrellaDeps(v.c, r, from)
+			resolve.AddDefaultDeps(v.c, r, from)
+			resolve.FormatDeps(v.c, rslvs[i], r, from)
+			resolve.PrepareMerge(v.c, r)
+			ruleIndex.RecordResolvedDeps(from, resolve.RuleDeps(r, from))
+			if err := resolve.CheckDeps(v.c, r, from); err != nil {
+				ruleErrs = append(ruleErrs, err)
+			}
+			if existing != nil {
+				if err := resolve.CheckOrphanDeps(v.c, existing, r, from); err != nil {
+					ruleErrs = append(ruleErrs, err)
+				}
+			}
+			if len(ruleErrs) > 0 && resolve.FailFast(v.c) {
+				cleanupPkg()
+				return fmt.Errorf("%s: %v", v.file.Path, ruleErrs[0])
+			}
+			resolveErrs = append(resolveErrs, ruleErrs...)
+			if uc.depsManifest != nil {
+				uc.depsManifest.AddRule(r, from)
+			}
 		}
+		requiredLoads[v.file] = append(requiredLoads[v.file], resolve.TakeRequiredLoads(v.c)...)
+		cleanupPkg()
 		merger.MergeFile(v.file, v.empty, v.rules, merger.PostResolve,
 			unionKindInfoMaps(kinds, v.mappedKindInfo))
+		generated := make(map[string]bool)
+		for _, r := range v.rules {
+			generated[r.Name()] = true
+		}
+		for _, r := range v.file.Rules {
+			if generated[r.Name()] {
+				resolve.RecordDepsCoverage(v.c, r, v.pkgRel)
+				resolve.AnnotateProvenance(v.c, r)
+			}
+		}
+		if uc.reportDepChanges {
+			for _, r := range v.file.Rules {
+				from := label.New(c.RepoName, v.pkgRel, r.Name())
+				if change, ok := resolve.DiffDeps(from, oldDeps[r.Name()], resolve.RuleDeps(r, from)); ok {
+					uc.depChanges = append(uc.depChanges, change)
+				}
+			}
+		}
+	}
+	if err := resolve.CheckDepCycles(c, ruleIndex); err != nil {
+		resolveErrs = append(resolveErrs, err)
+	}
+	if len(resolveErrs) > 0 {
+		for _, err := range resolveErrs {
+			log.Print(err)
+		}
+		return fmt.Errorf("encountered %d errors while resolving dependencies", len(resolveErrs))
 	}
 
 	// Emit merged files.
 	var exit error
 	for _, v := range visits {
 		merger.FixLoads(v.file, applyKindMappings(v.mappedKinds, loads))
+		merger.AddLoads(v.file, requiredLoads[v.file])
 		if err := uc.emit(v.c, v.file); err != nil {
 			if err == exitError {
 				exit = err
@@ -394,6 +534,16 @@ func runFixUpdate(cmd command, args []string) (err error) {
 			return err
 		}
 	}
+	if uc.depsManifest != nil {
+		if err := writeDepsManifest(uc); err != nil {
+			return err
+		}
+	}
+	if uc.reportDepChanges {
+		if err := writeDepChanges(uc); err != nil {
+			return err
+		}
+	}
 
 	return exit
 }
@@ -444,6 +594,10 @@ output mode determines what Gazelle does with updated BUILD files.
   fix (default) - write updated BUILD files back to disk.
   print - print updated BUILD files to stdout.
   diff - diff updated BUILD files against existing files in unified format.
+  deps - print a JSON manifest mapping each generated rule to its resolved
+      dependencies. No files are changed.
+  report - print a JSON list of the dependencies each generated rule would
+      gain and lose. No files are changed.
 
 Gazelle accepts a list of paths to Go package directories to process (defaults
 to the working directory if none are given). It recursively traverses
@@ -510,6 +664,17 @@ func findWorkspaceName(f *rule.File) string {
 	return ""
 }
 
+// findRuleByName returns the rule in f with the given name, or nil if there
+// is none.
+func findRuleByName(f *rule.File, name string) *rule.Rule {
+	for _, r := range f.Rules {
+		if r.Name() == name {
+			return r
+		}
+	}
+	return nil
+}
+
 func isDescendingDir(dir, root string) bool {
 	rel, err := filepath.Rel(root, dir)
 	if err != nil {
@@ -31,9 +31,11 @@ const (
 	fixCmd
 	updateReposCmd
 	helpCmd
+	dumpIndexCmd
 )
 
 var commandFromName = map[string]command{
+	"dump-index":   dumpIndexCmd,
 	"fix":          fixCmd,
 	"help":         helpCmd,
 	"update":       updateCmd,
@@ -46,6 +48,7 @@ var nameFromCommand = []string{
 	"fix",
 	"update-repos",
 	"help",
+	"dump-index",
 }
 
 func (cmd command) String() string {
@@ -78,7 +81,7 @@ func run(args []string) error {
 	}
 
 	switch cmd {
-	case fixCmd, updateCmd:
+	case fixCmd, updateCmd, dumpIndexCmd:
 		return runFixUpdate(cmd, args)
 	case helpCmd:
 		return help()
@@ -109,6 +112,8 @@ Gazelle defaults to "update".
       existing rules.
   update-repos - updates repository rules in the WORKSPACE file. Run with
       -h for details.
+  dump-index - generates rules as update does, then prints the index used
+      for dependency resolution as JSON instead of updating BUILD files.
   help - show this message.
 
 For usage information for a specific command, run the command with the -h flag.
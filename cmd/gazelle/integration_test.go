@@ -21,6 +21,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -66,6 +67,7 @@ func TestHelp(t *testing.T) {
 		{"fix", "-h"},
 		{"update", "-h"},
 		{"update-repos", "-h"},
+		{"dump-index", "-h"},
 	} {
 		t.Run(args[0], func(t *testing.T) {
 			if err := runGazelle(".", args); err == nil {
@@ -2975,3 +2977,406 @@ go_repository(
 		},
 	})
 }
+
+func TestDepsManifest(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/repo",
+		}, {
+			Path: "a/a.go",
+			Content: `
+package a
+
+import (
+	"fmt"
+
+	"example.com/repo/b"
+	"example.com/repo/c"
+)
+`,
+		}, {
+			Path: "b/b.go",
+			Content: `
+package b
+
+import "example.com/repo/c"
+`,
+		}, {
+			Path:    "c/c.go",
+			Content: "package c",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-mode=deps", "-manifest=deps.json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, append(files, testtools.FileSpec{
+		Path: "deps.json",
+		Content: `
+{
+  "//a:go_default_library": [
+    "//b:go_default_library",
+    "//c:go_default_library"
+  ],
+  "//b:go_default_library": [
+    "//c:go_default_library"
+  ],
+  "//c:go_default_library": []
+}
+`,
+	}))
+	for _, rel := range []string{"a", "b", "c"} {
+		if _, err := os.Stat(filepath.Join(dir, rel, "BUILD.bazel")); !os.IsNotExist(err) {
+			t.Errorf("%s: build file was written in deps mode", rel)
+		}
+	}
+}
+
+func TestDepChangesReport(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/repo",
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["a.go"],
+    importpath = "example.com/repo/a",
+    visibility = ["//visibility:public"],
+    deps = ["//c:go_default_library"],
+)
+`,
+		}, {
+			Path: "a/a.go",
+			Content: `
+package a
+
+import "example.com/repo/b"
+`,
+		}, {
+			Path: "b/b.go",
+			Content: `
+package b
+
+import "example.com/repo/c"
+`,
+		}, {
+			Path:    "c/c.go",
+			Content: "package c",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-mode=report", "-manifest=report.json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, append(files, testtools.FileSpec{
+		Path: "report.json",
+		Content: `
+[
+  {
+    "label": "//a:go_default_library",
+    "added": [
+      "//b:go_default_library"
+    ],
+    "removed": [
+      "//c:go_default_library"
+    ]
+  },
+  {
+    "label": "//b:go_default_library",
+    "added": [
+      "//c:go_default_library"
+    ],
+    "removed": []
+  }
+]
+`,
+	}))
+	for _, rel := range []string{"b", "c"} {
+		if _, err := os.Stat(filepath.Join(dir, rel, "BUILD.bazel")); !os.IsNotExist(err) {
+			t.Errorf("%s: build file was written in report mode", rel)
+		}
+	}
+}
+
+func TestStrictResolveFailFast(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/repo",
+		}, {
+			Path: "a/a.go",
+			Content: `
+package a
+
+import (
+	"../../outside_a"
+	"../../outside_a_later"
+)
+`,
+		}, {
+			Path: "a/a_test.go",
+			Content: `
+package a
+
+import "../../outside_a_test"
+`,
+		}, {
+			Path: "b/b.go",
+			Content: `
+package b
+
+import "../../outside_b"
+`,
+		},
+	}
+
+	for _, tc := range []struct {
+		desc, flag   string
+		wantContains []string
+		wantMissing  []string
+	}{
+		{
+			desc:         "accumulate",
+			flag:         "-strict_resolve",
+			wantContains: []string{"encountered 4 errors"},
+		}, {
+			desc:         "fail_fast",
+			flag:         "-strict_resolve_fail_fast",
+			wantContains: []string{filepath.Join("a", "BUILD.bazel"), "//a:go_default_library", `"../../outside_a"`},
+			wantMissing:  []string{"outside_a_later", "outside_a_test", "outside_b", "encountered"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, files)
+			defer cleanup()
+
+			err := runGazelle(dir, []string{tc.flag})
+			if err == nil {
+				t.Fatal("got success; want error")
+			}
+			for _, want := range tc.wantContains {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+			for _, missing := range tc.wantMissing {
+				if strings.Contains(err.Error(), missing) {
+					t.Errorf("error %q should not contain %q", err, missing)
+				}
+			}
+			for _, rel := range []string{"a", "b"} {
+				if _, err := os.Stat(filepath.Join(dir, rel, "BUILD.bazel")); !os.IsNotExist(err) {
+					t.Errorf("%s: build file was written despite resolve errors", rel)
+				}
+			}
+		})
+	}
+}
+
+// TestMergeSelectDeps checks that resolved dependencies are merged into the
+// default branch of a select written by hand in an existing build file, and
+// that the other branches are preserved.
+func TestMergeSelectDeps(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/repo",
+		}, {
+			Path:    "dep/dep.go",
+			Content: "package dep",
+		}, {
+			Path: "lib/lib.go",
+			Content: `
+package lib
+
+import _ "example.com/repo/dep"
+`,
+		}, {
+			Path: "lib/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo/lib",
+    deps = select({
+        "@platforms//os:linux": ["//linux:go_default_library"],
+        "//conditions:default": ["//old:go_default_library"],
+    }),
+)
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "lib/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo/lib",
+    visibility = ["//visibility:public"],
+    deps = select({
+        "@platforms//os:linux": ["//linux:go_default_library"],
+        "//conditions:default": ["//dep:go_default_library"],
+    }),
+)
+`,
+	}})
+}
+
+// TestGlobDeps checks that calls to glob in existing dependency attributes
+// are preserved by default and replaced by resolved dependencies when
+// expand_glob_deps is set, unless they're marked with "# keep".
+func TestGlobDeps(t *testing.T) {
+	for _, tc := range []struct {
+		desc, directive, old, want string
+	}{
+		{
+			desc: "preserve",
+			old:  `["//old:go_default_library"] + glob(["vendor/*.a"])`,
+			want: `["//dep:go_default_library"] + glob(["vendor/*.a"])`,
+		}, {
+			desc:      "expand",
+			directive: "# gazelle:expand_glob_deps true",
+			old:       `["//old:go_default_library"] + glob(["vendor/*.a"])`,
+			want:      `["//dep:go_default_library"]`,
+		}, {
+			desc:      "expand_with_kept_glob",
+			directive: "# gazelle:expand_glob_deps true",
+			old: `glob(["vendor/*.a"]) + glob(
+        # keep
+        ["kept/*.a"],
+    )`,
+			want: `["//dep:go_default_library"] + glob(
+        # keep
+        ["kept/*.a"],
+    )`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			buildFile := func(deps string) string {
+				return `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo/lib",
+    visibility = ["//visibility:public"],
+    deps = ` + deps + `,
+)
+`
+			}
+			files := []testtools.FileSpec{
+				{Path: "WORKSPACE"},
+				{
+					Path:    "BUILD.bazel",
+					Content: "# gazelle:prefix example.com/repo\n" + tc.directive,
+				}, {
+					Path:    "dep/dep.go",
+					Content: "package dep",
+				}, {
+					Path: "lib/lib.go",
+					Content: `
+package lib
+
+import _ "example.com/repo/dep"
+`,
+				}, {
+					Path:    "lib/BUILD.bazel",
+					Content: buildFile(tc.old),
+				},
+			}
+			dir, cleanup := testtools.CreateFiles(t, files)
+			defer cleanup()
+
+			if err := runGazelle(dir, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+				Path:    "lib/BUILD.bazel",
+				Content: buildFile(tc.want),
+			}})
+		})
+	}
+}
+
+// TestDumpIndex checks that dump-index prints the index as JSON without
+// writing build files.
+func TestDumpIndex(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "foo/foo.go",
+			Content: "package foo",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = w
+	runErr := runGazelle(dir, []string{"dump-index", "-go_prefix=example.com/repo"})
+	os.Stdout = oldStdout
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+
+	var index struct {
+		Rules []struct {
+			Label   string
+			Lang    string
+			Imports []struct{ Lang, Imp string }
+		}
+	}
+	if err := json.Unmarshal(out, &index); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if len(index.Rules) != 1 {
+		t.Fatalf("got %d rules; want 1\n%s", len(index.Rules), out)
+	}
+	got := index.Rules[0]
+	if got.Label != "//foo:go_default_library" || got.Lang != "go" || len(got.Imports) != 1 || got.Imports[0].Imp != "example.com/repo/foo" {
+		t.Errorf("got %+v; want //foo:go_default_library importable as example.com/repo/foo", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foo", "BUILD.bazel")); !os.IsNotExist(err) {
+		t.Errorf("dump-index wrote foo/BUILD.bazel")
+	}
+}
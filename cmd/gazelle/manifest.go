@@ -0,0 +1,57 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// skipFile is the emitFunc for -mode=deps and -mode=report. Build files are
+// not written; the dependency manifest or report is written by
+// writeDepsManifest or writeDepChanges instead.
+func skipFile(c *config.Config, f *rule.File) error {
+	return nil
+}
+
+func writeDepsManifest(uc *updateConfig) error {
+	return writeManifestOutput(uc, uc.depsManifest.Write)
+}
+
+func writeDepChanges(uc *updateConfig) error {
+	return writeManifestOutput(uc, func(w io.Writer) error {
+		return resolve.WriteDepChanges(w, uc.depChanges)
+	})
+}
+
+// writeManifestOutput calls write with the file named by -manifest, or with
+// stdout if -manifest is not set.
+func writeManifestOutput(uc *updateConfig, write func(w io.Writer) error) error {
+	var out io.Writer = os.Stdout
+	if uc.manifestPath != "" {
+		f, err := os.Create(uc.manifestPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return write(out)
+}
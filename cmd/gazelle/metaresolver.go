@@ -26,20 +26,37 @@ type metaResolver struct {
 	// builtins provides a map of the language kinds to their resolver.
 	builtins map[string]resolve.Resolver
 
+	// byName provides a map of resolver names to resolvers.
+	byName map[string]resolve.Resolver
+
 	// mappedKinds provides a list of replacements used by File.Pkg.
 	mappedKinds map[string][]config.MappedKind
+
+	// configs provides the configuration for each package, used to look up
+	// resolver_for_kind directives.
+	configs map[string]*config.Config
 }
 
 func newMetaResolver() *metaResolver {
 	return &metaResolver{
 		builtins:    make(map[string]resolve.Resolver),
+		byName:      make(map[string]resolve.Resolver),
 		mappedKinds: make(map[string][]config.MappedKind),
+		configs:     make(map[string]*config.Config),
 	}
 }
 
 // AddBuiltin registers a builtin kind with its info.
 func (mr *metaResolver) AddBuiltin(kindName string, resolver resolve.Resolver) {
 	mr.builtins[kindName] = resolver
+	mr.byName[resolver.Name()] = resolver
+}
+
+// Configure records the configuration for the given package. Resolvers
+// chosen with resolver_for_kind directives in c take precedence over
+// builtin kinds and kind mappings in that package.
+func (mr *metaResolver) Configure(pkgRel string, c *config.Config) {
+	mr.configs[pkgRel] = c
 }
 
 // MappedKind records the fact that the given mapping was applied while
@@ -52,6 +69,13 @@ func (mr *metaResolver) MappedKind(pkgRel string, kind config.MappedKind) {
 // indicating whether one was found. Empty string may be passed for pkgRel,
 // which results in consulting the builtin kinds only.
 func (mr metaResolver) Resolver(r *rule.Rule, pkgRel string) resolve.Resolver {
+	if c, ok := mr.configs[pkgRel]; ok {
+		if name, ok := resolve.ResolverForKind(c, r.Kind()); ok {
+			if rslv, ok := mr.byName[name]; ok {
+				return rslv
+			}
+		}
+	}
 	for _, mappedKind := range mr.mappedKinds[pkgRel] {
 		if mappedKind.KindName == r.Kind() {
 			return mr.builtins[mappedKind.FromKind]
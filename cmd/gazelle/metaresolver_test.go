@@ -0,0 +1,80 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+type namedResolver string
+
+func (r namedResolver) Name() string { return string(r) }
+
+func (namedResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	return nil
+}
+
+func (namedResolver) Embeds(r *rule.Rule, from label.Label) []label.Label { return nil }
+
+func (namedResolver) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+}
+
+func TestMetaResolverResolverForKind(t *testing.T) {
+	c := config.New()
+	cr := &resolve.Configurer{}
+	cr.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError), "update", c)
+	rootConfig := c.Clone()
+	cr.Configure(rootConfig, "", nil)
+	f, err := rule.LoadData("fork/BUILD.bazel", "fork", []byte("# gazelle:resolver_for_kind py_library my_fork\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forkConfig := rootConfig.Clone()
+	cr.Configure(forkConfig, "fork", f)
+	forkSubConfig := forkConfig.Clone()
+	cr.Configure(forkSubConfig, "fork/sub", nil)
+
+	py := namedResolver("py")
+	fork := namedResolver("my_fork")
+	mr := newMetaResolver()
+	mr.AddBuiltin("py_library", py)
+	mr.AddBuiltin("my_fork_library", fork)
+	mr.Configure("", rootConfig)
+	mr.Configure("fork", forkConfig)
+	mr.Configure("fork/sub", forkSubConfig)
+
+	r := rule.NewRule("py_library", "lib")
+	for _, tc := range []struct {
+		pkg  string
+		want resolve.Resolver
+	}{
+		{pkg: "", want: py},
+		{pkg: "other", want: py},
+		{pkg: "fork", want: fork},
+		{pkg: "fork/sub", want: fork},
+	} {
+		if got := mr.Resolver(r, tc.pkg); got != tc.want {
+			t.Errorf("package %q: got resolver %v; want %v", tc.pkg, got, tc.want)
+		}
+	}
+}
@@ -24,4 +24,10 @@ const (
 	// GazelleImportsKey is an internal attribute that lists imported packages
 	// on generated rules. It is replaced with "deps" during import resolution.
 	GazelleImportsKey = "_gazelle_imports"
+
+	// BuildTagsKey is an internal attribute that lists the build tags that
+	// are set when a generated rule is built, as a []string. Resolvers may
+	// read it with resolve.RuleBuildTags to choose providers whose build
+	// constraints are satisfied.
+	BuildTagsKey = "_build_tags"
 )
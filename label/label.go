@@ -67,6 +67,10 @@ var (
 
 // Parse reads a label from a string.
 // See https://docs.bazel.build/versions/master/build-ref.html#lexi.
+//
+// Labels in the main repository written with an empty repository name
+// (for example, "@//foo:bar") are parsed the same as labels without a
+// repository name ("//foo:bar").
 func Parse(s string) (Label, error) {
 	origStr := s
 
@@ -79,7 +83,9 @@ func Parse(s string) (Label, error) {
 			return NoLabel, fmt.Errorf("label parse error: repository does not end with '//': %q", origStr)
 		}
 		repo = s[len("@"):endRepo]
-		if !labelRepoRegexp.MatchString(repo) {
+		// "@//" refers to the main repository, which is the same as a label
+		// with no repository name.
+		if repo != "" && !labelRepoRegexp.MatchString(repo) {
 			return NoLabel, fmt.Errorf("label parse error: repository has invalid characters: %q", origStr)
 		}
 		s = s[endRepo:]
@@ -59,7 +59,9 @@ func TestParse(t *testing.T) {
 	}{
 		{str: "", wantErr: true},
 		{str: "@//:", wantErr: true},
-		{str: "@//:a", wantErr: true},
+		{str: "@//:a", want: Label{Name: "a"}},
+		{str: "@//a", want: Label{Pkg: "a", Name: "a"}},
+		{str: "@//a/b:c", want: Label{Pkg: "a/b", Name: "c"}},
 		{str: "@a:b", wantErr: true},
 		{str: ":a", want: Label{Name: "a", Relative: true}},
 		{str: "a", want: Label{Name: "a", Relative: true}},
@@ -86,6 +88,35 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestMainRepoEqual(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{a: "@//foo:bar", b: "//foo:bar", want: true},
+		{a: "@//foo", b: "//foo:foo", want: true},
+		{a: "@//:bar", b: "//:bar", want: true},
+		{a: "@name//foo:bar", b: "//foo:bar", want: false},
+		{a: "@name//foo:bar", b: "@//foo:bar", want: false},
+		{a: "@name//foo:bar", b: "@name//foo:bar", want: true},
+	} {
+		a, err := Parse(tc.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(tc.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.Equal(b); got != tc.want {
+			t.Errorf("%s.Equal(%s) = %v; want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := a.Abs("", "x").Equal(b.Abs("", "x")); got != tc.want {
+			t.Errorf("%s.Abs().Equal(%s.Abs()) = %v; want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
 func TestImportPathToBazelRepoName(t *testing.T) {
 	for path, want := range map[string]string{
 		"git.sr.ht/~urandom/errors": "ht_sr_git_urandom_errors",
@@ -240,7 +240,7 @@ func (*goLang) KnownDirectives() []string {
 func (*goLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
 	gc := newGoConfig()
 	switch cmd {
-	case "fix", "update":
+	case "fix", "update", "dump-index":
 		fs.Var(
 			tagsFlag(gc.setBuildTags),
 			"build_tags",
@@ -19,7 +19,6 @@ import (
 	"errors"
 	"fmt"
 	"go/build"
-	"log"
 	"path"
 	"regexp"
 	"strings"
@@ -67,17 +66,43 @@ func (gl *goLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remo
 	}
 	imports := importsRaw.(rule.PlatformStrings)
 	r.DelAttr("deps")
-	resolve := ResolveGo
+	resolveImport, lang := resolveGo, "go"
 	if r.Kind() == "go_proto_library" {
-		resolve = resolveProto
+		resolveImport, lang = resolveProto, "proto"
 	}
-	deps, errs := imports.Map(func(imp string) (string, error) {
-		l, err := resolve(c, ix, rc, imp, from)
+	stopped := false
+	deps, _ := imports.Map(func(imp string) (string, error) {
+		if stopped {
+			return "", nil
+		}
+		var l label.Label
+		var err error
+		if ol, ok := resolve.RuleOverride(c, r, resolve.ImportSpec{Lang: lang, Imp: imp}, from); ok {
+			l = ol
+		} else {
+			l, err = resolveImport(c, ix, rc, r, imp, from)
+		}
+		if err != nil && err != skipImportError {
+			if ql, ok := resolve.QuarantineLabel(c, resolve.ImportSpec{Lang: lang, Imp: imp}); ok {
+				l, err = ql, nil
+			}
+		}
+		if err == nil {
+			if ferr := resolve.CheckForbiddenRepo(c, resolve.ImportSpec{Lang: lang, Imp: imp}, l); ferr != nil {
+				err = ferr
+			} else if lerr := resolve.CheckLayering(c, resolve.ImportSpec{Lang: lang, Imp: imp}, from, l); lerr != nil {
+				err = lerr
+			}
+		}
 		if err == skipImportError {
 			return "", nil
 		} else if err != nil {
-			return "", err
+			if resolve.ReportUnresolved(c, from, resolve.ImportSpec{Lang: lang, Imp: imp}, err) == resolve.ErrStopResolving {
+				stopped = true
+			}
+			return "", nil
 		}
+		ix.RecordResolvedImport(resolve.ImportSpec{Lang: lang, Imp: imp}, l)
 		for _, embed := range gl.Embeds(r, from) {
 			if embed.Equal(l) {
 				return "", nil
@@ -86,9 +111,19 @@ func (gl *goLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remo
 		l = l.Rel(from.Repo, from.Pkg)
 		return l.String(), nil
 	})
-	for _, err := range errs {
-		log.Print(err)
-	}
+	// Several imports may resolve to the same label, for example, when they
+	// match the same wildcard resolve directive.
+	deps, _ = deps.MapSlice(func(ss []string) ([]string, error) {
+		seen := make(map[string]bool)
+		rs := ss[:0]
+		for _, s := range ss {
+			if !seen[s] {
+				seen[s] = true
+				rs = append(rs, s)
+			}
+		}
+		return rs, nil
+	})
 	if !deps.IsEmpty() {
 		if r.Kind() == "go_proto_library" {
 			// protos may import the same library multiple times by different names,
@@ -113,6 +148,12 @@ var (
 // This may be used directly by other language extensions related to Go
 // (gomock). Gazelle calls Language.Resolve instead.
 func ResolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, imp string, from label.Label) (label.Label, error) {
+	return resolveGo(c, ix, rc, nil, imp, from)
+}
+
+// resolveGo is like ResolveGo, but r is the rule being resolved, if it's
+// known. r is used to check whether self-imports are allowed.
+func resolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imp string, from label.Label) (label.Label, error) {
 	gc := getGoConfig(c)
 	pcMode := getProtoMode(c)
 	if build.IsLocalImport(imp) {
@@ -123,11 +164,13 @@ func ResolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, im
 		imp = path.Join(gc.prefix, cleanRel)
 	}
 
+	imp = resolve.ReplaceDeprecatedImport(c, resolve.ImportSpec{Lang: "go", Imp: imp}).Imp
+
 	if IsStandard(imp) {
 		return label.NoLabel, skipImportError
 	}
 
-	if l, ok := resolve.FindRuleWithOverride(c, resolve.ImportSpec{Lang: "go", Imp: imp}, "go"); ok {
+	if l, ok := ix.FindRuleWithOverride(c, resolve.ImportSpec{Lang: "go", Imp: imp}, "go"); ok {
 		return l, nil
 	}
 
@@ -157,12 +200,16 @@ func ResolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, im
 		}
 	}
 
-	if l, err := resolveWithIndexGo(ix, imp, from); err == nil || err == skipImportError {
+	if l, err := resolveWithIndexGo(c, ix, r, imp, from); err == nil || err == skipImportError {
 		return l, err
 	} else if err != notFoundError {
 		return label.NoLabel, err
 	}
 
+	if l, ok := resolve.FindRuleWithWildcardOverride(c, resolve.ImportSpec{Lang: "go", Imp: imp}, "go"); ok {
+		return l, nil
+	}
+
 	// Special cases for rules_go and bazel_gazelle.
 	// These have names that don't following conventions and they're
 	// typeically declared with http_archive, not go_repository, so Gazelle
@@ -196,8 +243,8 @@ func IsStandard(imp string) bool {
 	return stdPackages[imp]
 }
 
-func resolveWithIndexGo(ix *resolve.RuleIndex, imp string, from label.Label) (label.Label, error) {
-	matches := ix.FindRulesByImport(resolve.ImportSpec{Lang: "go", Imp: imp}, "go")
+func resolveWithIndexGo(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp string, from label.Label) (label.Label, error) {
+	matches := ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: "go", Imp: imp}, "go")
 	var bestMatch resolve.FindResult
 	var bestMatchIsVendored bool
 	var bestMatchVendorRoot string
@@ -218,9 +265,7 @@ func resolveWithIndexGo(ix *resolve.RuleIndex, imp string, from label.Label) (la
 				break
 			}
 		}
-		if isVendored {
-		}
-		if isVendored && !label.New(m.Label.Repo, vendorRoot, "").Contains(from) {
+		if !resolve.VendorVisible(from, m.Label, "vendor") {
 			// vendor directory not visible
 			continue
 		}
@@ -244,9 +289,12 @@ func resolveWithIndexGo(ix *resolve.RuleIndex, imp string, from label.Label) (la
 	if bestMatch.Label.Equal(label.NoLabel) {
 		return label.NoLabel, notFoundError
 	}
-	if bestMatch.IsSelfImport(from) {
+	if ix.IsSelfImport(bestMatch, r, from) {
 		return label.NoLabel, skipImportError
 	}
+	if bestMatch.Load != nil {
+		resolve.RequireLoad(c, *bestMatch.Load)
+	}
 	return bestMatch.Label, nil
 }
 
@@ -292,14 +340,16 @@ func resolveVendored(rc *repo.RemoteCache, imp string) (label.Label, error) {
 	return label.New("", path.Join("vendor", imp), defaultLibName), nil
 }
 
-func resolveProto(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, imp string, from label.Label) (label.Label, error) {
+func resolveProto(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imp string, from label.Label) (label.Label, error) {
 	pcMode := getProtoMode(c)
 
+	imp = resolve.ReplaceDeprecatedImport(c, resolve.ImportSpec{Lang: "proto", Imp: imp}).Imp
+
 	if wellKnownProtos[imp] {
 		return label.NoLabel, skipImportError
 	}
 
-	if l, ok := resolve.FindRuleWithOverride(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "go"); ok {
+	if l, ok := ix.FindRuleWithOverride(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "go"); ok {
 		return l, nil
 	}
 
@@ -311,12 +361,16 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache,
 		}
 	}
 
-	if l, err := resolveWithIndexProto(ix, imp, from); err == nil || err == skipImportError {
+	if l, err := resolveWithIndexProto(c, ix, r, imp, from); err == nil || err == skipImportError {
 		return l, err
 	} else if err != notFoundError {
 		return label.NoLabel, err
 	}
 
+	if l, ok := resolve.FindRuleWithWildcardOverride(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "go"); ok {
+		return l, nil
+	}
+
 	// As a fallback, guess the label based on the proto file name. We assume
 	// all proto files in a directory belong to the same package, and the
 	// package name matches the directory base name. We also assume that protos
@@ -350,15 +404,15 @@ var wellKnownProtos = map[string]bool{
 	"google/protobuf/wrappers.proto":        true,
 }
 
-func resolveWithIndexProto(ix *resolve.RuleIndex, imp string, from label.Label) (label.Label, error) {
-	matches := ix.FindRulesByImport(resolve.ImportSpec{Lang: "proto", Imp: imp}, "go")
+func resolveWithIndexProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp string, from label.Label) (label.Label, error) {
+	matches := ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "go")
 	if len(matches) == 0 {
 		return label.NoLabel, notFoundError
 	}
 	if len(matches) > 1 {
 		return label.NoLabel, fmt.Errorf("multiple rules (%s and %s) may be imported with %q from %s", matches[0].Label, matches[1].Label, imp, from)
 	}
-	if matches[0].IsSelfImport(from) {
+	if ix.IsSelfImport(matches[0], r, from) {
 		return label.NoLabel, skipImportError
 	}
 	return matches[0].Label, nil
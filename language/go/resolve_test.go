@@ -18,9 +18,11 @@ package golang
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/pathtools"
 	"github.com/bazelbuild/bazel-gazelle/repo"
@@ -131,6 +133,74 @@ go_library(
     importpath = "a",
     deps = ["//:good"],
 )
+`,
+		}, {
+			desc: "wildcard_override",
+			index: []buildFile{{
+				content: `
+# gazelle:resolve go github.com/foo/generated/... //generated:all_gen
+`,
+			}, {
+				rel: "generated/real",
+				content: `
+go_library(
+    name = "go_default_library",
+    importpath = "github.com/foo/generated/real",
+)
+`,
+			}},
+			old: buildFile{
+				rel: "test",
+				content: `
+go_library(
+    name = "a",
+    importpath = "a",
+    _imports = [
+        "github.com/foo/generated",
+        "github.com/foo/generated/real",
+        "github.com/foo/generated/x/y",
+    ],
+)
+`,
+			},
+			want: `
+go_library(
+    name = "a",
+    importpath = "a",
+    deps = [
+        "//generated:all_gen",
+        "//generated/real:go_default_library",
+    ],
+)
+`,
+		}, {
+			desc: "forbidden_repo",
+			index: []buildFile{{
+				content: `
+# gazelle:forbidden_repo bad_repo
+# gazelle:resolve go example.com/bad @bad_repo//:go_default_library
+# gazelle:resolve go example.com/good @good_repo//:go_default_library
+`,
+			}},
+			old: buildFile{
+				rel: "test",
+				content: `
+go_library(
+    name = "a",
+    importpath = "a",
+    _imports = [
+        "example.com/bad",
+        "example.com/good",
+    ],
+)
+`,
+			},
+			want: `
+go_library(
+    name = "a",
+    importpath = "a",
+    deps = ["@good_repo//:go_default_library"],
+)
 `,
 		}, {
 			desc: "same_package",
@@ -1226,3 +1296,234 @@ type mapResolver map[string]resolve.Resolver
 func (mr mapResolver) Resolver(r *rule.Rule, f string) resolve.Resolver {
 	return mr[r.Kind()]
 }
+
+// loadCrossResolver resolves one Go import to a rule that requires a load.
+type loadCrossResolver struct{}
+
+func (loadCrossResolver) CrossResolve(c *config.Config, ix *resolve.RuleIndex, imp resolve.ImportSpec, lang string) []resolve.FindResult {
+	if imp.Imp != "example.com/macro" {
+		return nil
+	}
+	return []resolve.FindResult{{
+		Label: label.New("ext", "", "macro_lib"),
+		Load:  &rule.LoadInfo{Name: "@ext//:defs.bzl", Symbols: []string{"macro_lib"}},
+	}}
+}
+
+func TestResolveRequiresLoad(t *testing.T) {
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/repo")
+	ix := resolve.NewRuleIndex(nil, loadCrossResolver{})
+	ix.Finish()
+	gl := langs[1].(*goLang)
+	r := rule.NewRule("go_library", "go_default_library")
+	imports := rule.PlatformStrings{Generic: []string{"example.com/macro"}}
+	gl.Resolve(c, ix, testRemoteCache(nil), r, imports, label.New("", "", "go_default_library"))
+
+	if got, want := r.AttrStrings("deps"), []string{"@ext//:macro_lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deps: got %q; want %q", got, want)
+	}
+	want := []rule.LoadInfo{{Name: "@ext//:defs.bzl", Symbols: []string{"macro_lib"}}}
+	if got := resolve.TakeRequiredLoads(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("loads: got %#v; want %#v", got, want)
+	}
+}
+
+func TestResolveRuleOverride(t *testing.T) {
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/repo")
+	gl := langs[1].(*goLang)
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return gl })
+	lib, err := rule.LoadData("y/BUILD.bazel", "y", []byte(`
+go_library(
+    name = "go_default_library",
+    importpath = "example.com/repo/y",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.AddRule(c, lib.Rules[0], lib)
+	ix.Finish()
+
+	existing, err := rule.LoadData("x/BUILD.bazel", "x", []byte(`
+go_library(
+    name = "overridden",
+    gazelle_deps_override = {"example.com/repo/y": "//vendor:y"},
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := rule.PlatformStrings{Generic: []string{"example.com/repo/y"}}
+	for _, tc := range []struct {
+		name     string
+		existing *rule.Rule
+		want     []string
+	}{
+		{name: "overridden", existing: existing.Rules[0], want: []string{"//vendor:y"}},
+		{name: "plain", want: []string{"//y:go_default_library"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := rule.NewRule("go_library", tc.name)
+			resolve.CopyRuleOverrides(c, tc.existing, r)
+			gl.Resolve(c, ix, testRemoteCache(nil), r, imports, label.New("", "x", tc.name))
+			if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// selfImportTestResolver is the Go resolver, but it allows go_test rules to
+// keep self-imports.
+type selfImportTestResolver struct {
+	*goLang
+}
+
+func (selfImportTestResolver) AllowSelfImport(from label.Label, r *rule.Rule) bool {
+	return r.Kind() == "go_test"
+}
+
+func TestResolveAllowSelfImport(t *testing.T) {
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/repo")
+	gl := langs[1].(*goLang)
+	f, err := rule.LoadData("x/BUILD.bazel", "x", []byte(`
+go_library(
+    name = "go_default_library",
+    embed = [":go_default_test"],
+    importpath = "example.com/repo/x",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := rule.PlatformStrings{Generic: []string{"example.com/repo/x"}}
+	for _, tc := range []struct {
+		desc string
+		rslv resolve.Resolver
+		want []string
+	}{
+		{desc: "dropped", rslv: gl},
+		{desc: "allowed", rslv: selfImportTestResolver{gl}, want: []string{":go_default_library"}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return tc.rslv })
+			ix.AddRule(c, f.Rules[0], f)
+			ix.Finish()
+			r := rule.NewRule("go_test", "go_default_test")
+			gl.Resolve(c, ix, testRemoteCache(nil), r, imports, label.New("", "x", "go_default_test"))
+			if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveForbiddenRepoError(t *testing.T) {
+	c, langs, cexts := testConfig(t, "-go_prefix=example.com/repo", "-strict_resolve")
+	gl := langs[1].(*goLang)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:forbidden_repo bad_repo
+# gazelle:resolve go example.com/bad @bad_repo//:go_default_library
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cext := range cexts {
+		cext.Configure(c, "", f)
+	}
+	ix := resolve.NewRuleIndex(nil)
+	ix.Finish()
+	r := rule.NewRule("go_library", "a")
+	imports := rule.PlatformStrings{Generic: []string{"example.com/bad"}}
+	from := label.New("", "", "a")
+	gl.Resolve(c, ix, testRemoteCache(nil), r, imports, from)
+
+	errs := resolve.TakeUnresolved(c)
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors; want 1", len(errs))
+	}
+	if got := strings.Count(errs[0].Error(), from.String()); got != 1 {
+		t.Errorf("error %q mentions %s %d times; want once", errs[0], from, got)
+	}
+}
+
+func TestResolveFailFast(t *testing.T) {
+	c, langs, cexts := testConfig(t, "-go_prefix=example.com/repo", "-strict_resolve_fail_fast")
+	gl := langs[1].(*goLang)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:forbidden_repo bad_repo
+# gazelle:resolve go example.com/bad1 @bad_repo//:go_default_library
+# gazelle:resolve go example.com/bad2 @bad_repo//:go_default_library
+# gazelle:resolve go example.com/good //good:go_default_library
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cext := range cexts {
+		cext.Configure(c, "", f)
+	}
+	ix := resolve.NewRuleIndex(nil)
+	ix.Finish()
+	r := rule.NewRule("go_library", "a")
+	imports := rule.PlatformStrings{Generic: []string{"example.com/bad1", "example.com/good", "example.com/bad2"}}
+	gl.Resolve(c, ix, testRemoteCache(nil), r, imports, label.New("", "", "a"))
+
+	if errs := resolve.TakeUnresolved(c); len(errs) != 1 {
+		t.Errorf("got %d errors; want 1: %v", len(errs), errs)
+	}
+	if deps := r.AttrStrings("deps"); len(deps) != 0 {
+		t.Errorf("imports after the first error were resolved: %q", deps)
+	}
+}
+
+// fromNormalizingResolver is the Go resolver, but rules in the package gen
+// are generated by a macro whose logical label is //pub.
+type fromNormalizingResolver struct {
+	*goLang
+}
+
+func (fromNormalizingResolver) NormalizeFrom(from label.Label, r *rule.Rule) label.Label {
+	if from.Pkg == "gen" {
+		return label.New(from.Repo, "pub", "pub")
+	}
+	return from
+}
+
+func TestResolveNormalizeFromOtherPackage(t *testing.T) {
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/repo")
+	gl := langs[1].(*goLang)
+	pubFile, err := rule.LoadData("pub/BUILD.bazel", "pub", []byte(`
+go_library(
+    name = "pub",
+    importpath = "example.com/repo/pub",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	genFile, err := rule.LoadData("gen/BUILD.bazel", "gen", []byte(`
+go_library(
+    name = "helper",
+    importpath = "example.com/repo/gen/helper",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rslv := fromNormalizingResolver{gl}
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return rslv })
+	ix.AddRule(c, pubFile.Rules[0], pubFile)
+	ix.AddRule(c, genFile.Rules[0], genFile)
+	ix.Finish()
+
+	// The import of the logical label is a self-import, and the other
+	// dependency is written relative to the physical package.
+	r := rule.NewRule("go_library", "lib")
+	imports := rule.PlatformStrings{Generic: []string{"example.com/repo/pub", "example.com/repo/gen/helper"}}
+	if err := resolve.ResolveRule(c, rslv, ix, testRemoteCache(nil), r, imports, label.New("", "gen", "lib")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.AttrStrings("deps"), []string{":helper"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
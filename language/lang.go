@@ -37,7 +37,10 @@ import (
 //
 // A single instance of Language is created for each fix / update run. Some
 // state may be stored in this instance, but stateless behavior is encouraged,
-// especially since some operations may be concurrent in the future.
+// especially since some operations may be concurrent. When
+// -index_parallelism is greater than 1, the Imports, Embeds, and other
+// indexing methods of Resolver may be called concurrently while the rule
+// index is built.
 //
 // Tasks languages are used for
 //
@@ -18,7 +18,6 @@ package proto
 import (
 	"errors"
 	"fmt"
-	"log"
 	"path"
 	"sort"
 	"strings"
@@ -64,12 +63,33 @@ func (_ *protoLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Re
 	r.DelAttr("deps")
 	depSet := make(map[string]bool)
 	for _, imp := range imports {
-		l, err := resolveProto(c, ix, r, imp, from)
+		var l label.Label
+		var err error
+		if ol, ok := resolve.RuleOverride(c, r, resolve.ImportSpec{Lang: "proto", Imp: imp}, from); ok {
+			l = ol
+		} else {
+			l, err = resolveProto(c, ix, r, imp, from)
+		}
+		if err != nil && err != skipImportError {
+			if ql, ok := resolve.QuarantineLabel(c, resolve.ImportSpec{Lang: "proto", Imp: imp}); ok {
+				l, err = ql, nil
+			}
+		}
+		if err == nil {
+			if ferr := resolve.CheckForbiddenRepo(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, l); ferr != nil {
+				err = ferr
+			} else if lerr := resolve.CheckLayering(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, from, l); lerr != nil {
+				err = lerr
+			}
+		}
 		if err == skipImportError {
 			continue
 		} else if err != nil {
-			log.Print(err)
+			if resolve.ReportUnresolved(c, from, resolve.ImportSpec{Lang: "proto", Imp: imp}, err) == resolve.ErrStopResolving {
+				break
+			}
 		} else {
+			ix.RecordResolvedImport(resolve.ImportSpec{Lang: "proto", Imp: imp}, l)
 			l = l.Rel(from.Repo, from.Pkg)
 			depSet[l.String()] = true
 		}
@@ -94,8 +114,9 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp str
 	if !strings.HasSuffix(imp, ".proto") {
 		return label.NoLabel, fmt.Errorf("can't import non-proto: %q", imp)
 	}
+	imp = resolve.ReplaceDeprecatedImport(c, resolve.ImportSpec{Lang: "proto", Imp: imp}).Imp
 
-	if l, ok := resolve.FindRuleWithOverride(c, resolve.ImportSpec{Imp: imp, Lang: "proto"}, "proto"); ok {
+	if l, ok := ix.FindRuleWithOverride(c, resolve.ImportSpec{Imp: imp, Lang: "proto"}, "proto"); ok {
 		return l, nil
 	}
 
@@ -107,12 +128,16 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp str
 		}
 	}
 
-	if l, err := resolveWithIndex(ix, imp, from); err == nil || err == skipImportError {
+	if l, err := resolveWithIndex(c, ix, r, imp, from); err == nil || err == skipImportError {
 		return l, err
 	} else if err != notFoundError {
 		return label.NoLabel, err
 	}
 
+	if l, ok := resolve.FindRuleWithWildcardOverride(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "proto"); ok {
+		return l, nil
+	}
+
 	rel := path.Dir(imp)
 	if rel == "." {
 		rel = ""
@@ -121,15 +146,15 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp str
 	return label.New("", rel, name), nil
 }
 
-func resolveWithIndex(ix *resolve.RuleIndex, imp string, from label.Label) (label.Label, error) {
-	matches := ix.FindRulesByImport(resolve.ImportSpec{Lang: "proto", Imp: imp}, "proto")
+func resolveWithIndex(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp string, from label.Label) (label.Label, error) {
+	matches := ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "proto")
 	if len(matches) == 0 {
 		return label.NoLabel, notFoundError
 	}
 	if len(matches) > 1 {
 		return label.NoLabel, fmt.Errorf("multiple rules (%s and %s) may be imported with %q from %s", matches[0].Label, matches[1].Label, imp, from)
 	}
-	if matches[0].IsSelfImport(from) {
+	if ix.IsSelfImport(matches[0], r, from) {
 		return label.NoLabel, skipImportError
 	}
 	return matches[0].Label, nil
@@ -177,3 +177,28 @@ by adding a comment like this to WORKSPACE:
     # gazelle:repo bazel_gazelle
 `, f.Path)
 }
+
+// AddLoads ensures f loads each symbol in loads from its file. Unlike
+// FixLoads, AddLoads doesn't remove symbols that aren't used as rule kinds,
+// so it may be used for loads that are needed for other reasons, for example,
+// loads required by resolved dependencies. Missing symbols are added to an
+// existing load of the same file, or a new load is inserted at the top of f,
+// like loads inserted by FixLoads.
+func AddLoads(f *rule.File, loads []rule.LoadInfo) {
+	for _, info := range loads {
+		var load *rule.Load
+		for _, l := range f.Loads {
+			if l.Name() == info.Name {
+				load = l
+				break
+			}
+		}
+		if load == nil {
+			load = rule.NewLoad(info.Name)
+			load.Insert(f, 0)
+		}
+		for _, sym := range info.Symbols {
+			load.Add(sym)
+		}
+	}
+}
@@ -90,6 +90,12 @@ const (
 // version of the attribute will be added if no existing attribute is present;
 // otherwise, the existing attribute will be preserved.
 //
+// If an existing mergeable attribute includes a select expression with
+// conditions Gazelle doesn't generate (for example, "@platforms//os:linux"),
+// the non-default branches of the select are preserved. Generated values
+// are merged into the list concatenated with the select, or into its
+// "//conditions:default" branch if there's no such list.
+//
 // Note that "# keep" comments affect merging. If a value within an existing
 // attribute is marked with a "# keep" comment, it will not be removed.
 // If an attribute is marked with a "# keep" comment, it will not be merged.
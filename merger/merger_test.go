@@ -996,3 +996,271 @@ go_binary(name = "z")
 		})
 	}
 }
+
+func TestAddLoads(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@ext//:defs.bzl", "a")
+
+go_library(
+    name = "go_default_library",
+    deps = ["@ext//:lib"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merger.FixLoads(f, testLoads)
+	merger.AddLoads(f, []rule.LoadInfo{
+		{Name: "@ext//:defs.bzl", Symbols: []string{"a", "b"}},
+		{Name: "@other//:defs.bzl", Symbols: []string{"c"}},
+	})
+	want := `load("@other//:defs.bzl", "c")
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@ext//:defs.bzl", "a", "b")
+
+go_library(
+    name = "go_default_library",
+    deps = ["@ext//:lib"],
+)
+`
+	if got := string(f.Format()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeFileSelect(t *testing.T) {
+	for _, tc := range []struct {
+		desc, previous, current, expected string
+	}{
+		{
+			desc: "select_with_default",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": ["//old"],
+    }),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = [
+        "//linux",
+        "//x",
+    ],
+)`,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": ["//x"],
+    }),
+)`,
+		}, {
+			desc: "select_without_default",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+    }),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": ["//x"],
+    }),
+)`,
+		}, {
+			desc: "list_and_select",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = [
+        "//keep",  # keep
+        "//old",
+    ] + select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": [],
+    }),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = [
+        "//keep",  # keep
+        "//x",
+    ] + select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": [],
+    }),
+)`,
+		}, {
+			desc: "no_deps",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": ["//old"],
+    }),
+)`,
+			current: `go_library(name = "go_default_library")`,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": [],
+    }),
+)`,
+		}, {
+			desc: "generated_platform_select",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@io_bazel_rules_go//go/platform:linux": ["//linux"],
+        "//conditions:default": [],
+    }),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			genFile, err := rule.LoadData(filepath.Join("current", "BUILD.bazel"), "", []byte(tc.current))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := rule.LoadData(filepath.Join("previous", "BUILD.bazel"), "", []byte(tc.previous))
+			if err != nil {
+				t.Fatal(err)
+			}
+			merger.MergeFile(f, nil, genFile.Rules, merger.PostResolve, testKinds)
+			want := tc.expected + "\n"
+			if got := string(f.Format()); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeFileGlob(t *testing.T) {
+	for _, tc := range []struct {
+		desc, previous, current, expected string
+		expandGlobs                       bool
+	}{
+		{
+			desc: "preserve_glob",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = ["//old"] + glob(["deps/*"]),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = ["//x"] + glob(["deps/*"]),
+)`,
+		}, {
+			desc: "expand_glob",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = ["//old"] + glob(["deps/*"]),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expandGlobs: true,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+		}, {
+			desc: "expand_with_kept_glob",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = glob(["deps/*"]) + glob(
+        # keep
+        ["vendor/*"],
+    ),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expandGlobs: true,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = ["//x"] + glob(
+        # keep
+        ["vendor/*"],
+    ),
+)`,
+		}, {
+			desc: "expand_glob_and_select",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": ["//old"],
+    }) + glob(["deps/*"]),
+)`,
+			current: `go_library(
+    name = "go_default_library",
+    deps = ["//x"],
+)`,
+			expandGlobs: true,
+			expected: `go_library(
+    name = "go_default_library",
+    deps = select({
+        "@platforms//os:linux": ["//linux"],
+        "//conditions:default": ["//x"],
+    }),
+)`,
+		}, {
+			desc: "expand_only_glob",
+			previous: `go_library(
+    name = "go_default_library",
+    deps = glob(["deps/*"]),
+)`,
+			current:     `go_library(name = "go_default_library")`,
+			expandGlobs: true,
+			expected:    `go_library(name = "go_default_library")`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			genFile, err := rule.LoadData(filepath.Join("current", "BUILD.bazel"), "", []byte(tc.current))
+			if err != nil {
+				t.Fatal(err)
+			}
+			globs := rule.PreserveGlobs
+			if tc.expandGlobs {
+				globs = rule.ExpandGlobs
+			}
+			genFile.Rules[0].SetPrivateAttr(rule.GlobsKey, globs)
+			f, err := rule.LoadData(filepath.Join("previous", "BUILD.bazel"), "", []byte(tc.previous))
+			if err != nil {
+				t.Fatal(err)
+			}
+			merger.MergeFile(f, nil, genFile.Rules, merger.PostResolve, testKinds)
+			want := tc.expected + "\n"
+			if got := string(f.Format()); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+)
+
+// PrefixRepoTable maps import path prefixes to external repositories. It may
+// be used by cross resolvers to find the label for an import provided by a
+// repository that isn't indexed, similar to how Go imports are resolved
+// using go_repository rules.
+//
+// The zero value is an empty table, ready to use.
+type PrefixRepoTable struct {
+	entries []prefixRepoEntry
+}
+
+type prefixRepoEntry struct {
+	prefix, repoName, labelTemplate string
+}
+
+// Add adds an entry to the table. Imports equal to prefix or starting with
+// prefix followed by a slash are resolved to a label in the repository
+// named repoName.
+//
+// labelTemplate is the label within the repository, like
+// "//{rel}:go_default_library". In the template, "{rel}" is replaced with
+// the import path with prefix and the following slash removed, and "{base}"
+// is replaced with the last component of the import path. The repository name in labelTemplate, if any, is replaced by repoName.
+// If labelTemplate is empty, "//{rel}" is used.
+//
+// If prefix was already added, the entry is replaced.
+func (t *PrefixRepoTable) Add(prefix, repoName, labelTemplate string) {
+	if labelTemplate == "" {
+		labelTemplate = "//{rel}"
+	}
+	e := prefixRepoEntry{prefix: prefix, repoName: repoName, labelTemplate: labelTemplate}
+	for i := range t.entries {
+		if t.entries[i].prefix == prefix {
+			t.entries[i] = e
+			return
+		}
+	}
+	t.entries = append(t.entries, e)
+}
+
+// Resolve returns the label for importPath using the entry with the longest
+// prefix that matches importPath. False is returned if no entry matches or
+// if the expanded template is not a valid label.
+func (t *PrefixRepoTable) Resolve(importPath string) (label.Label, bool) {
+	var best *prefixRepoEntry
+	for i := range t.entries {
+		e := &t.entries[i]
+		if !pathtools.HasPrefix(importPath, e.prefix) {
+			continue
+		}
+		if best == nil || len(e.prefix) > len(best.prefix) {
+			best = e
+		}
+	}
+	if best == nil {
+		return label.NoLabel, false
+	}
+	rel := pathtools.TrimPrefix(importPath, best.prefix)
+	s := strings.NewReplacer("{rel}", rel, "{base}", path.Base(importPath)).Replace(best.labelTemplate)
+	l, err := label.Parse(s)
+	if err != nil {
+		return label.NoLabel, false
+	}
+	l.Repo = best.repoName
+	return l, true
+}
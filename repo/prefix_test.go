@@ -0,0 +1,59 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/repo"
+)
+
+func TestPrefixRepoTable(t *testing.T) {
+	var table repo.PrefixRepoTable
+	table.Add("example.com/a", "com_example_a", "//{rel}:go_default_library")
+	table.Add("example.com/a/b", "com_example_a_b", "//{rel}:{base}")
+	table.Add("example.com/c", "com_example_c", "")
+	table.Add("example.com/bad", "bad", "//{rel}:a:b")
+
+	for _, tc := range []struct {
+		imp, want string
+	}{
+		{imp: "example.com/a", want: "@com_example_a//:go_default_library"},
+		{imp: "example.com/a/x", want: "@com_example_a//x:go_default_library"},
+		{imp: "example.com/a/b", want: "@com_example_a_b//:b"},
+		{imp: "example.com/a/b/y", want: "@com_example_a_b//y"},
+		{imp: "example.com/a/bc", want: "@com_example_a//bc:go_default_library"},
+		{imp: "example.com/c/d", want: "@com_example_c//d"},
+		{imp: "example.com/bad/x"},
+		{imp: "example.com/other"},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			l, ok := table.Resolve(tc.imp)
+			if tc.want == "" {
+				if ok {
+					t.Errorf("got %s; want no match", l)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("got no match; want %s", tc.want)
+			}
+			if got := l.String(); got != tc.want {
+				t.Errorf("got %s; want %s", got, tc.want)
+			}
+		})
+	}
+}
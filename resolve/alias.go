@@ -0,0 +1,167 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"log"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// aliasActual returns the label in the "actual" attribute of r if r is an
+// alias rule whose "actual" is a label string. from is the label of r.
+func aliasActual(r *rule.Rule, from label.Label) (label.Label, bool) {
+	if r.Kind() != "alias" {
+		return label.NoLabel, false
+	}
+	s := r.AttrString("actual")
+	if s == "" {
+		return label.NoLabel, false
+	}
+	l, err := label.Parse(s)
+	if err != nil {
+		return label.NoLabel, false
+	}
+	return l.Abs(from.Repo, from.Pkg), true
+}
+
+// indexedAliasActuals returns the labels that r may refer to if r should be
+// indexed as an alias. conditional is true if r's "actual" attribute is
+// a select expression. Plain aliases are not indexed as aliases where the
+// alias_resolution directive is set to "actual"; conditional aliases always
+// are, since no single actual could be chosen.
+func indexedAliasActuals(c *config.Config, r *rule.Rule, from label.Label) (actuals []label.Label, conditional, ok bool) {
+	if actuals, ok := conditionalAliasActuals(r, from); ok {
+		return actuals, true, true
+	}
+	if getResolveConfig(c).aliasesToActual {
+		return nil, false, false
+	}
+	if l, ok := aliasActual(r, from); ok {
+		return []label.Label{l}, false, true
+	}
+	return nil, false, false
+}
+
+// addAlias adds a record for r, an alias that may refer to actuals. The
+// record's language and imports are filled in by collectAliases after all
+// rules are added.
+func (ix *RuleIndex) addAlias(c *config.Config, r *rule.Rule, f *rule.File, actuals []label.Label, conditional, overlay bool) {
+	record := &ruleRecord{
+		rule:             r,
+		label:            label.New(c.RepoName, f.Pkg, r.Name()),
+		file:             f,
+		overlay:          overlay,
+		sourceRoot:       getResolveConfig(c).sourceRoot,
+		aliasActuals:     actuals,
+		conditionalAlias: conditional,
+	}
+	if existing, ok := ix.labelMap[record.label]; ok {
+		if existing.overlay && !overlay {
+			return
+		}
+		if overlay && !existing.overlay {
+			ix.replaceRule(existing, record)
+			return
+		}
+		log.Printf("multiple rules found with label %s", record.label)
+		return
+	}
+	ix.rules = append(ix.rules, record)
+	ix.labelMap[record.label] = record
+}
+
+// collectAliases indexes each alias by the imports that every rule it may
+// refer to provides, so those imports resolve to the alias. The rules it
+// refers to are hidden from import lookups, and they're recorded as the
+// alias's embeds, so they're treated as self-imports. An alias may refer
+// to another alias, which is indexed first.
+//
+// An alias is only indexed if every rule it may refer to is in the index
+// and was indexed by the same resolver. Otherwise, the alias is not
+// importable, and the rules it refers to are indexed normally.
+//
+// This must be called after embeds are collected, so the imports of
+// actual rules include the imports of rules they embed.
+func (ix *RuleIndex) collectAliases() {
+	state := make(map[*ruleRecord]int)
+	for _, r := range ix.rules {
+		if r.aliasActuals != nil {
+			ix.collectAlias(r, state)
+		}
+	}
+}
+
+// Values in the state map used by collectAlias.
+const (
+	aliasVisiting = 1
+	aliasDone     = 2
+)
+
+// collectAlias indexes the alias r. state tracks aliases that have been
+// visited, so aliases that refer to each other are not indexed.
+func (ix *RuleIndex) collectAlias(r *ruleRecord, state map[*ruleRecord]int) {
+	if state[r] != 0 {
+		return
+	}
+	state[r] = aliasVisiting
+	defer func() { state[r] = aliasDone }()
+
+	var records []*ruleRecord
+	for _, l := range r.aliasActuals {
+		ar, ok := ix.labelMap[l]
+		if ok && ar.aliasActuals != nil {
+			ix.collectAlias(ar, state)
+			if ar.lang == "" {
+				// The alias couldn't be indexed.
+				ok = false
+			}
+		}
+		if !ok || (len(records) > 0 && (ar.lang != records[0].lang || ar.shadow != records[0].shadow)) {
+			records = nil
+			break
+		}
+		records = append(records, ar)
+	}
+	if records == nil {
+		return
+	}
+
+	common := make(map[ImportSpec]int)
+	for _, ar := range records {
+		for _, imp := range dedupImportSpecs(append([]ImportSpec(nil), ar.importedAs...)) {
+			common[imp]++
+		}
+	}
+	var imps []ImportSpec
+	for _, imp := range records[0].importedAs {
+		if common[imp] == len(records) {
+			imps = append(imps, imp)
+			common[imp] = 0
+		}
+	}
+
+	r.lang = records[0].lang
+	r.shadow = records[0].shadow
+	r.importedAs = imps
+	for _, ar := range records {
+		ar.aliased = true
+		r.embeds = append(r.embeds, ar.label)
+		r.embeds = append(r.embeds, ar.embeds...)
+	}
+}
@@ -0,0 +1,123 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestAlias(t *testing.T) {
+	files := []testFile{
+		{
+			rel: "real",
+			content: `
+test_library(
+    name = "target",
+    provides = ["example.com/target"],
+)
+
+test_library(
+    name = "other",
+    provides = ["example.com/other"],
+)
+`,
+		}, {
+			rel: "pub",
+			content: `
+alias(
+    name = "x",
+    actual = "//real:target",
+)
+
+alias(
+    name = "ext",
+    actual = "@ext//lib",
+)
+`,
+		}, {
+			rel: "chain",
+			content: `
+alias(
+    name = "y",
+    actual = "//chain:z",
+)
+
+alias(
+    name = "z",
+    actual = "//real:other",
+)
+
+alias(
+    name = "loop1",
+    actual = ":loop2",
+)
+
+alias(
+    name = "loop2",
+    actual = ":loop1",
+)
+`,
+		},
+	}
+
+	for _, tc := range []struct {
+		desc, directive string
+		want            map[string][]string
+	}{
+		{
+			desc: "alias",
+			want: map[string][]string{
+				"example.com/target": {"//pub:x"},
+				"example.com/other":  {"//chain:y"},
+			},
+		}, {
+			desc:      "actual",
+			directive: "# gazelle:alias_resolution actual",
+			want: map[string][]string{
+				"example.com/target": {"//real:target"},
+				"example.com/other":  {"//real:other"},
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := testConfig(t)
+			f := loadTestFiles(t, []testFile{{content: tc.directive}})[0]
+			cr := &Configurer{}
+			cr.Configure(c, "", f)
+			ix := buildTestIndex(t, c, files, &testResolver{name: "test"})
+			got := make(map[string][]string)
+			for imp := range tc.want {
+				got[imp] = resultLabels(ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: imp}, "test"))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, files, &testResolver{name: "test"})
+	results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "example.com/target"}, "test")
+	if len(results) != 1 || results[0].ConditionalAlias {
+		t.Fatalf("got %+v; want one result that is not a conditional alias", results)
+	}
+	if !results[0].IsSelfImport(label.New("", "real", "target")) {
+		t.Errorf("import from the actual rule is not a self-import")
+	}
+}
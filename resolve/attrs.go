@@ -0,0 +1,72 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "github.com/bazelbuild/bazel-gazelle/rule"
+
+// AttrIndexer is an optional interface that a Resolver may implement to
+// make its rules queryable by the values of some of their attributes with
+// RuleIndex.FindRuleByAttr. This is useful when rules are identified by an
+// attribute like "importpath" rather than by name.
+type AttrIndexer interface {
+	// IndexedAttrs returns the names of attributes of r to index. Attributes
+	// may be strings or lists of strings. Other values are ignored.
+	IndexedAttrs(r *rule.Rule) []string
+}
+
+type attrKey struct {
+	attr, value string
+}
+
+func (ix *RuleIndex) buildAttrIndex() {
+	ix.attrMap = make(map[attrKey][]*ruleRecord)
+	for _, r := range ix.rules {
+		ai, ok := ix.mrslv(r.rule, r.file.Pkg).(AttrIndexer)
+		if !ok {
+			continue
+		}
+		for _, attr := range ai.IndexedAttrs(r.rule) {
+			values := r.rule.AttrStrings(attr)
+			if s := r.rule.AttrString(attr); s != "" {
+				values = []string{s}
+			}
+			indexed := make(map[string]bool)
+			for _, v := range values {
+				if indexed[v] {
+					continue
+				}
+				indexed[v] = true
+				key := attrKey{attr, v}
+				ix.attrMap[key] = append(ix.attrMap[key], r)
+			}
+		}
+	}
+}
+
+// FindRuleByAttr returns rules whose attribute attr has the value value,
+// or contains value if the attribute is a list of strings. Only attributes
+// declared by a resolver's AttrIndexer implementation are indexed. Results
+// are returned in the order rules were added to the index. Embedded rules
+// are included.
+//
+// FindRuleByAttr may only be called after Finish.
+func (ix *RuleIndex) FindRuleByAttr(attr, value string) []FindResult {
+	var results []FindResult
+	for _, r := range ix.attrMap[attrKey{attr, value}] {
+		results = append(results, r.findResult())
+	}
+	return ix.dedup(results)
+}
@@ -0,0 +1,78 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// attrResolver is a testResolver whose rules are indexed by their
+// "importpath" and "aliases" attributes.
+type attrResolver struct {
+	testResolver
+}
+
+func (*attrResolver) IndexedAttrs(r *rule.Rule) []string {
+	return []string{"importpath", "aliases"}
+}
+
+func TestFindRuleByAttr(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "lib",
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    importpath = "example.com/lib",
+    aliases = ["example.com/old", "example.com/older"],
+)
+
+test_library(
+    name = "b",
+    provides = ["b"],
+    importpath = "example.com/lib",
+)
+
+other_library(
+    name = "c",
+    provides = ["c"],
+    importpath = "example.com/other",
+)
+`,
+	}}, &attrResolver{testResolver{name: "test"}}, &testResolver{name: "other"})
+
+	for _, tc := range []struct {
+		attr, value string
+		want        []string
+	}{
+		{attr: "importpath", value: "example.com/lib", want: []string{"//lib:a", "//lib:b"}},
+		{attr: "aliases", value: "example.com/older", want: []string{"//lib:a"}},
+		{attr: "importpath", value: "example.com/old"},
+		{attr: "importpath", value: "example.com/other"},
+		{attr: "name", value: "a"},
+	} {
+		t.Run(tc.attr+"="+tc.value, func(t *testing.T) {
+			got := resultLabels(ix.FindRuleByAttr(tc.attr, tc.value))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// BuildConstrainer is an optional interface that a Resolver may implement
+// if rules in its language are only usable when certain build tags are set,
+// for example, a library with several implementations selected by tags.
+type BuildConstrainer interface {
+	// BuildConstraints returns the build constraints of r. Each constraint is
+	// a tag that must be set, or a tag preceded by "!" that must not be set.
+	// All constraints must be satisfied for r to be used. r may be used with
+	// any tags if nil is returned.
+	BuildConstraints(r *rule.Rule) []string
+}
+
+// SetRuleBuildTags records the build tags that are set when r is built.
+// Languages that generate rules for specific build tags should call it
+// before resolution, so that resolvers can read the tags with
+// RuleBuildTags.
+func SetRuleBuildTags(r *rule.Rule, tags []string) {
+	r.SetPrivateAttr(config.BuildTagsKey, tags)
+}
+
+// RuleBuildTags returns the build tags recorded for r with SetRuleBuildTags,
+// or nil if no tags were recorded.
+func RuleBuildTags(r *rule.Rule) []string {
+	tags, _ := r.PrivateAttr(config.BuildTagsKey).([]string)
+	return tags
+}
+
+// SelectForBuildTags returns the results whose build constraints, as
+// reported by BuildConstrainer, are satisfied when tags are set. Resolvers
+// may call it on lookup results with the tags of the rule being resolved,
+// usually RuleBuildTags(r). Results without constraints are always
+// selected. The order of results is preserved.
+func SelectForBuildTags(results []FindResult, tags []string) []FindResult {
+	set := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		set[t] = true
+	}
+	var selected []FindResult
+	for _, r := range results {
+		if constraintsSatisfied(r.Constraints, set) {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
+
+func constraintsSatisfied(constraints []string, tags map[string]bool) bool {
+	for _, c := range constraints {
+		if strings.HasPrefix(c, "!") {
+			if tags[c[1:]] {
+				return false
+			}
+		} else if !tags[c] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// tagResolver reads build constraints from the "constraints" attribute and
+// resolves imports to providers whose constraints match the consuming
+// rule's build tags.
+type tagResolver struct {
+	testResolver
+}
+
+func (tr *tagResolver) BuildConstraints(r *rule.Rule) []string {
+	return r.AttrStrings("constraints")
+}
+
+func (tr *tagResolver) Resolve(c *config.Config, ix *RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+	var deps []string
+	for _, imp := range imports.([]string) {
+		results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: tr.name, Imp: imp}, tr.name)
+		results = SelectForBuildTags(results, RuleBuildTags(r))
+		if len(results) == 1 {
+			deps = append(deps, results[0].Label.Rel(from.Repo, from.Pkg).String())
+		}
+	}
+	r.SetAttr("deps", deps)
+}
+
+func TestResolveForBuildTags(t *testing.T) {
+	c := testConfig(t)
+	tr := &tagResolver{testResolver{name: "x"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "db",
+		content: `
+x_library(
+    name = "real",
+    provides = ["db"],
+    constraints = ["integration"],
+)
+
+x_library(
+    name = "fake",
+    provides = ["db"],
+    constraints = ["!integration"],
+)
+
+x_library(
+    name = "util",
+    provides = ["util"],
+)
+`,
+	}}, tr)
+
+	for _, tc := range []struct {
+		desc string
+		tags []string
+		want []string
+	}{
+		{desc: "no_tags", want: []string{"//db:fake", "//db:util"}},
+		{desc: "integration", tags: []string{"integration"}, want: []string{"//db:real", "//db:util"}},
+		{desc: "other_tags", tags: []string{"linux"}, want: []string{"//db:fake", "//db:util"}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := rule.NewRule("x_test", "app_test")
+			SetRuleBuildTags(r, tc.tags)
+			tr.Resolve(c, ix, nil, r, []string{"db", "util"}, label.New("", "app", "app_test"))
+			if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// indexCacheVersion is the version of the index cache format. Caches written
+// with a different version are ignored.
+const indexCacheVersion = 1
+
+// IndexCache holds the results of indexing build files in an earlier run,
+// so that rules in build files that haven't changed can be added to
+// a RuleIndex without calling Resolver.Imports and other resolver methods
+// again. A cache is attached to an index with WithIndexCache; it's read with
+// ReadIndexCache and written with RuleIndex.WriteIndexCache.
+//
+// Cached results are keyed by the formatted content of each build file,
+// the directives in the file and its parent directories, -index_cache aside,
+// the flags Gazelle was run with, and Version. This assumes resolvers
+// compute imports only from rules, their build files, directives, and flags.
+type IndexCache struct {
+	// files maps file IDs (see cacheFileID) to cached results read from
+	// an earlier run.
+	files map[string]*cachedFile
+
+	// written maps file IDs to results recorded in this run. Only files
+	// added in this run are written, so files that no longer exist are
+	// dropped from the cache.
+	written map[string]*cachedFile
+
+	// keys caches the key computed for each build file by memoFileKey.
+	keys map[*rule.File]string
+}
+
+// cachedFile is the cached indexing result for one build file.
+type cachedFile struct {
+	// Key identifies the content and configuration of the file. Results are
+	// only used if the key matches.
+	Key   string       `json:"key"`
+	Rules []cachedRule `json:"rules"`
+
+	byName map[string]*cachedRule
+}
+
+// cachedRule is the indexing result for one rule, computed by indexRule.
+type cachedRule struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Lang string `json:"lang"`
+
+	// Imports are the rule's own imports, after import_rewrite directives
+	// were applied. Imports is nil for rules that aren't indexed.
+	Imports []ImportSpec `json:"imports"`
+
+	EmbedOnly   bool     `json:"embed_only,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	ContentKey  string   `json:"content_key,omitempty"`
+	Constraints []string `json:"constraints,omitempty"`
+}
+
+// indexCacheData is the serialized form of an IndexCache.
+type indexCacheData struct {
+	Version int                    `json:"version"`
+	Files   map[string]*cachedFile `json:"files"`
+}
+
+// NewIndexCache returns an empty cache.
+func NewIndexCache() *IndexCache {
+	return &IndexCache{
+		files:   make(map[string]*cachedFile),
+		written: make(map[string]*cachedFile),
+		keys:    make(map[*rule.File]string),
+	}
+}
+
+// ReadIndexCache reads a cache written by RuleIndex.WriteIndexCache. If the
+// cache was written in a different format, an empty cache is returned.
+func ReadIndexCache(r io.Reader) (*IndexCache, error) {
+	var data indexCacheData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("reading index cache: %v", err)
+	}
+	cache := NewIndexCache()
+	if data.Version != indexCacheVersion {
+		return cache, nil
+	}
+	for id, cf := range data.Files {
+		if cf == nil {
+			continue
+		}
+		cf.byName = make(map[string]*cachedRule, len(cf.Rules))
+		for i := range cf.Rules {
+			cf.byName[cf.Rules[i].Name] = &cf.Rules[i]
+		}
+		cache.files[id] = cf
+	}
+	return cache, nil
+}
+
+// WithIndexCache returns an option that causes the index to reuse results
+// in cache for rules in unchanged build files, and to record results for
+// all added rules in cache, so they may be written with WriteIndexCache.
+func WithIndexCache(cache *IndexCache) IndexOption {
+	return func(ix *RuleIndex) {
+		ix.cache = cache
+	}
+}
+
+// WriteIndexCache writes the indexing results for rules added to ix in
+// this run to w. ix must have been created with WithIndexCache.
+func (ix *RuleIndex) WriteIndexCache(w io.Writer) error {
+	if ix.cache == nil {
+		return fmt.Errorf("writing index cache: index was created without WithIndexCache")
+	}
+	data := indexCacheData{Version: indexCacheVersion, Files: ix.cache.written}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(data); err != nil {
+		return fmt.Errorf("writing index cache: %v", err)
+	}
+	return nil
+}
+
+// AttachIndexCache reads the cache file named with -index_cache, if it's
+// set, and attaches it to ix, as WithIndexCache does. A missing or
+// unreadable cache file is not an error; ix starts with an empty cache.
+// AttachIndexCache must be called before rules are added to ix.
+func AttachIndexCache(c *config.Config, ix *RuleIndex) error {
+	path := getResolveConfig(c).indexCachePath
+	if path == "" {
+		return nil
+	}
+	cache := NewIndexCache()
+	if f, err := os.Open(path); err == nil {
+		loaded, err := ReadIndexCache(f)
+		f.Close()
+		if err != nil {
+			log.Printf("%s: %v; the cache will be rebuilt", path, err)
+		} else {
+			cache = loaded
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	WithIndexCache(cache)(ix)
+	return nil
+}
+
+// SaveIndexCache writes the cache attached to ix with AttachIndexCache to
+// the file named with -index_cache. The file is replaced atomically, so
+// a concurrent run never reads a partially written cache.
+func SaveIndexCache(c *config.Config, ix *RuleIndex) error {
+	path := getResolveConfig(c).indexCachePath
+	if path == "" || ix.cache == nil {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := ix.WriteIndexCache(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// cacheFileID identifies a build file in the cache.
+func cacheFileID(c *config.Config, f *rule.File) string {
+	return c.RepoName + "//" + f.Pkg
+}
+
+// cacheFileKey returns a key identifying the content of f and the
+// configuration it's indexed with.
+func cacheFileKey(c *config.Config, f *rule.File) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", getResolveConfig(c).cacheKey)
+	h.Write(f.Format())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// memoFileKey returns cacheFileKey for f, computing it once per file.
+func (cache *IndexCache) memoFileKey(c *config.Config, f *rule.File) string {
+	if key, ok := cache.keys[f]; ok {
+		return key
+	}
+	key := cacheFileKey(c, f)
+	cache.keys[f] = key
+	return key
+}
+
+// lookup returns the cached result for r in f, if f hasn't changed since
+// the cache was written. key is the current key of f. lookup doesn't
+// modify the cache, so it may be called concurrently.
+func (cache *IndexCache) lookup(c *config.Config, f *rule.File, key string, r *rule.Rule) (cachedRule, bool) {
+	cf, ok := cache.files[cacheFileID(c, f)]
+	if !ok || cf.Key != key {
+		return cachedRule{}, false
+	}
+	cr, ok := cf.byName[r.Name()]
+	if !ok || cr.Kind != r.Kind() {
+		return cachedRule{}, false
+	}
+	return *cr, true
+}
+
+// record saves the result for a rule in f, whose key is key, so it's
+// written by WriteIndexCache.
+func (cache *IndexCache) record(c *config.Config, f *rule.File, key string, cr cachedRule) {
+	id := cacheFileID(c, f)
+	cf, ok := cache.written[id]
+	if !ok {
+		cf = &cachedFile{Key: key}
+		cache.written[id] = cf
+	}
+	cf.Rules = append(cf.Rules, cr)
+}
+
+// flagsCacheKey returns the initial cache key for a run, computed from
+// Version and the flags that were set, other than -index_cache and
+// -index_parallelism, which don't affect indexing results.
+func flagsCacheKey(fs *flag.FlagSet) string {
+	var set []string
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "index_cache" && f.Name != "index_parallelism" {
+			set = append(set, f.Name+"="+f.Value.String())
+		}
+	})
+	sort.Strings(set)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", Version)
+	for _, s := range set {
+		fmt.Fprintf(h, "%s\x00", s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// directivesCacheKey returns the cache key for a directory with the given
+// directives, whose parent directory has the key parent.
+func directivesCacheKey(parent string, directives []rule.Directive) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", parent)
+	for _, d := range directives {
+		fmt.Fprintf(h, "%s\x00%s\x00", d.Key, d.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,178 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// countingResolver is a testResolver that counts calls to Imports.
+type countingResolver struct {
+	testResolver
+	calls int
+}
+
+func (cr *countingResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	cr.calls++
+	return cr.testResolver.Imports(c, r, f)
+}
+
+// indexWithCache builds an index of files with cache attached, configuring
+// each file's directory first, and returns the number of Imports calls.
+func indexWithCache(t *testing.T, c *config.Config, cache *IndexCache, files []testFile) (*RuleIndex, int) {
+	rslv := &countingResolver{testResolver: testResolver{name: "test"}}
+	ix := NewRuleIndex(kindResolver(rslv), WithIndexCache(cache))
+	cr := &Configurer{}
+	for _, f := range loadTestFiles(t, files) {
+		fc := c.Clone()
+		cr.Configure(fc, f.Pkg, f)
+		for _, r := range f.Rules {
+			ix.AddRule(fc, r, f)
+		}
+	}
+	ix.Finish()
+	return ix, rslv.calls
+}
+
+func TestIndexCache(t *testing.T) {
+	c := testConfig(t)
+	files := []testFile{
+		{
+			rel: "a",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    embed = [":a_embed"],
+)
+
+test_library(
+    name = "a_embed",
+    provides = ["a_embed"],
+)
+`,
+		}, {
+			rel: "b",
+			content: `
+test_library(
+    name = "b",
+    provides = ["b"],
+)
+
+test_binary(name = "bin")
+`,
+		},
+	}
+	lookup := func(ix *RuleIndex) map[string][]string {
+		got := make(map[string][]string)
+		for _, imp := range []string{"a", "a_embed", "b"} {
+			got[imp] = resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: imp}, "test"))
+		}
+		return got
+	}
+
+	ix, calls := indexWithCache(t, c, NewIndexCache(), files)
+	if calls != 4 {
+		t.Errorf("first run: got %d calls to Imports; want 4", calls)
+	}
+	want := lookup(ix)
+	write := func(ix *RuleIndex) *IndexCache {
+		var buf bytes.Buffer
+		if err := ix.WriteIndexCache(&buf); err != nil {
+			t.Fatal(err)
+		}
+		cache, err := ReadIndexCache(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cache
+	}
+	cache := write(ix)
+
+	ix, calls = indexWithCache(t, c, cache, files)
+	if calls != 0 {
+		t.Errorf("unchanged files: got %d calls to Imports; want 0", calls)
+	}
+	if got := lookup(ix); !reflect.DeepEqual(got, want) {
+		t.Errorf("unchanged files: got %v; want %v", got, want)
+	}
+	cache = write(ix)
+	base := write(ix)
+
+	changed := append([]testFile(nil), files...)
+	changed[1].content = strings.Replace(changed[1].content, `provides = ["b"]`, `provides = ["b", "b2"]`, 1)
+	ix, calls = indexWithCache(t, c, cache, changed)
+	if calls != 2 {
+		t.Errorf("changed file: got %d calls to Imports; want 2", calls)
+	}
+	if got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: "b2"}, "test")); !reflect.DeepEqual(got, []string{"//b"}) {
+		t.Errorf("changed file: got %v for b2; want [//b]", got)
+	}
+
+	directives := append([]testFile(nil), files...)
+	directives[0].content = "# gazelle:source_root a\n" + directives[0].content
+	_, calls = indexWithCache(t, c, base, directives)
+	if calls != 2 {
+		t.Errorf("new directive: got %d calls to Imports; want 2", calls)
+	}
+}
+
+func TestIndexCacheFlag(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TEMPDIR"), "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.json")
+	files := []testFile{{
+		rel:     "a",
+		content: `test_library(name = "a", provides = ["a"])`,
+	}}
+
+	for i, wantCalls := range []int{1, 0} {
+		c := testConfig(t, "-index_cache", path)
+		rslv := &countingResolver{testResolver: testResolver{name: "test"}}
+		ix := NewRuleIndex(kindResolver(rslv))
+		if err := AttachIndexCache(c, ix); err != nil {
+			t.Fatal(err)
+		}
+		addTestFiles(t, c, ix, files)
+		if err := SaveIndexCache(c, ix); err != nil {
+			t.Fatal(err)
+		}
+		if rslv.calls != wantCalls {
+			t.Errorf("run %d: got %d calls to Imports; want %d", i, rslv.calls, wantCalls)
+		}
+	}
+
+	// Caches with a different format are ignored.
+	cache, err := ReadIndexCache(strings.NewReader(`{"version": 0, "files": {"//a": {"key": "x", "rules": []}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.files) != 0 {
+		t.Errorf("got %d files from old cache; want 0", len(cache.files))
+	}
+}
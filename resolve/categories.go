@@ -0,0 +1,324 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// DefaultDepCategory is the category for resolved imports that don't have
+// a more specific category. By default, it is written to the "deps"
+// attribute.
+const DefaultDepCategory = "deps"
+
+// DepCategorizer is an optional interface that a Resolver may implement
+// when its rules separate dependencies into several attributes, for example,
+// compile-time and link-time dependencies.
+type DepCategorizer interface {
+	// DepCategory returns the categories a resolved import belongs to.
+	// An import may belong to more than one category. If no categories are
+	// returned, DefaultDepCategory is used.
+	DepCategory(imp ImportSpec) []string
+}
+
+// DepCategoryAttr returns the name of the attribute that dependencies in
+// the given category are written to. This may be configured with the
+// dep_category_attr directive. By default, the attribute has the same name
+// as the category.
+func DepCategoryAttr(c *config.Config, category string) string {
+	if attr, ok := getResolveConfig(c).categoryAttrs[category]; ok {
+		return attr
+	}
+	return category
+}
+
+// RuntimeDepCategory is the category for imports that are only used at run
+// time, for example, through reflection. By default, it is written to the
+// "runtime_deps" attribute.
+const RuntimeDepCategory = "runtime_deps"
+
+// PluginDepCategory is the category for imports of compiler plugins, like
+// annotation processors, that are applied when a rule is compiled rather
+// than linked into it. By default, it is written to the "plugins"
+// attribute. Resolvers that implement DepCategorizer return it for imports
+// their language marks as plugin imports.
+const PluginDepCategory = "plugins"
+
+// UsageKind describes how an import is used by the source files of a rule.
+// Resolvers that can tell how each import is used pass the kind to
+// CategorizedDeps.AddWithUsage, which chooses a category for the
+// dependency.
+type UsageKind int
+
+const (
+	// CompileUsage indicates an import is needed to compile a rule. This is
+	// the default.
+	CompileUsage UsageKind = iota
+
+	// RuntimeUsage indicates an import is only needed when a rule's code is
+	// run. Dependencies for these imports are in RuntimeDepCategory, unless
+	// the same dependency is also needed at compile time.
+	RuntimeUsage
+)
+
+// AmbientImporter is an optional interface that a Resolver may implement
+// when some imports are provided by the language runtime or toolchain.
+// Ambient imports don't produce dependencies and aren't reported as
+// unresolved, but resolvers that use CategorizedDeps.AddAmbient record them
+// in the rule's ImportReport.
+//
+// Ambient imports are different from excluded imports (for example, imports
+// of the Go standard library), which resolvers skip without recording.
+type AmbientImporter interface {
+	AmbientImports() []ImportSpec
+}
+
+// ImportReport records what happened to each import of a rule during
+// resolution. Excluded imports are not recorded.
+//
+// ImportReport is a library API for resolvers that use CategorizedDeps.
+// Gazelle itself doesn't write it in any output, including -mode=deps and
+// -mode=report. A resolver that wants ambient imports to appear in
+// an audit should get the report with CategorizedDeps.Report after
+// resolving a rule and store it or write it out itself.
+type ImportReport struct {
+	// Resolved is the list of imports that were resolved to dependencies.
+	Resolved []ImportSpec
+
+	// Ambient is the list of imports provided by the runtime, as declared by
+	// AmbientImporter.
+	Ambient []ImportSpec
+
+	// Unresolved is the list of imports that could not be resolved.
+	Unresolved []ImportSpec
+}
+
+// CategorizedDeps collects resolved dependencies for a rule, grouped by
+// category. Resolvers call Add for each resolved import, then Write to
+// set the corresponding attributes.
+type CategorizedDeps struct {
+	rslv    Resolver
+	deps    map[string][]resolvedDep
+	ambient map[ImportSpec]bool
+	report  ImportReport
+
+	// compiled is the set of labels added with CompileUsage. These are
+	// omitted from RuntimeDepCategory.
+	compiled map[label.Label]bool
+}
+
+type resolvedDep struct {
+	label label.Label
+	imp   ImportSpec
+}
+
+// NewCategorizedDeps returns an empty set of dependencies for a rule
+// resolved by rslv. If rslv implements DepCategorizer, it is used to
+// categorize imports passed to Add.
+func NewCategorizedDeps(rslv Resolver) *CategorizedDeps {
+	d := &CategorizedDeps{
+		rslv:     rslv,
+		deps:     make(map[string][]resolvedDep),
+		compiled: make(map[label.Label]bool),
+	}
+	if ai, ok := rslv.(AmbientImporter); ok {
+		d.ambient = make(map[ImportSpec]bool)
+		for _, imp := range ai.AmbientImports() {
+			d.ambient[imp] = true
+		}
+	}
+	return d
+}
+
+// AddAmbient returns true if rslv declares imp to be an ambient import.
+// If so, imp is recorded in the report, and the resolver should not resolve
+// it or add a dependency for it.
+func (d *CategorizedDeps) AddAmbient(imp ImportSpec) bool {
+	if !d.ambient[imp] {
+		return false
+	}
+	d.report.Ambient = append(d.report.Ambient, imp)
+	return true
+}
+
+// AddUnresolved records that imp could not be resolved, and reports err
+// with ReportUnresolved. from is the label of the rule being resolved.
+// The error returned by ReportUnresolved is returned.
+func (d *CategorizedDeps) AddUnresolved(c *config.Config, from label.Label, imp ImportSpec, err error) error {
+	d.report.Unresolved = append(d.report.Unresolved, imp)
+	return ReportUnresolved(c, from, imp, err)
+}
+
+// Report returns a record of the imports passed to Add, AddAmbient, and
+// AddUnresolved.
+func (d *CategorizedDeps) Report() ImportReport {
+	return d.report
+}
+
+// Add records that imp was resolved to l. l is added to each of the
+// categories imp belongs to.
+func (d *CategorizedDeps) Add(imp ImportSpec, l label.Label) {
+	var cats []string
+	if dc, ok := d.rslv.(DepCategorizer); ok {
+		cats = dc.DepCategory(imp)
+	}
+	if len(cats) == 0 {
+		cats = []string{DefaultDepCategory}
+	}
+	for _, cat := range cats {
+		d.deps[cat] = append(d.deps[cat], resolvedDep{label: l, imp: imp})
+	}
+	d.compiled[l] = true
+	d.report.Resolved = append(d.report.Resolved, imp)
+}
+
+// AddWithUsage records that imp was resolved to l, where usage describes how
+// imp is used. Imports with CompileUsage are added as with Add. Imports with
+// RuntimeUsage are added to RuntimeDepCategory, but l is omitted from that
+// category when it's also added for an import with CompileUsage.
+func (d *CategorizedDeps) AddWithUsage(imp ImportSpec, usage UsageKind, l label.Label) {
+	if usage != RuntimeUsage {
+		d.Add(imp, l)
+		return
+	}
+	d.deps[RuntimeDepCategory] = append(d.deps[RuntimeDepCategory], resolvedDep{label: l, imp: imp})
+	d.report.Resolved = append(d.report.Resolved, imp)
+}
+
+// Categories returns the sorted list of categories with at least one
+// dependency.
+func (d *CategorizedDeps) Categories() []string {
+	cats := make([]string, 0, len(d.deps))
+	for cat := range d.deps {
+		if len(d.categoryDeps(cat)) > 0 {
+			cats = append(cats, cat)
+		}
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// Labels returns the labels added to category, in the order they were added.
+func (d *CategorizedDeps) Labels(category string) []label.Label {
+	var labels []label.Label
+	for _, dep := range d.categoryDeps(category) {
+		labels = append(labels, dep.label)
+	}
+	return labels
+}
+
+// categoryDeps returns the dependencies in category. Dependencies that are
+// needed at compile time are omitted from RuntimeDepCategory.
+func (d *CategorizedDeps) categoryDeps(category string) []resolvedDep {
+	if category != RuntimeDepCategory {
+		return d.deps[category]
+	}
+	var deps []resolvedDep
+	for _, dep := range d.deps[category] {
+		if !d.compiled[dep.label] {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// Write sets an attribute on r for each category with dependencies. The
+// attribute name is determined by DepCategoryAttr. If several categories
+// map to the same attribute, their dependencies are merged. Labels are
+// written relative to from, sorted, and without duplicates. Attributes for
+// categories without dependencies are not modified; resolvers should delete
+// stale attributes before resolving.
+//
+// When -annotate_deps is set, each label is followed by a comment listing
+// the imports it was resolved from.
+func (d *CategorizedDeps) Write(c *config.Config, r *rule.Rule, from label.Label) {
+	annotate := getResolveConfig(c).annotateDeps
+	attrDeps := make(map[string]map[string][]string)
+	for cat := range d.deps {
+		deps := d.categoryDeps(cat)
+		if len(deps) == 0 {
+			continue
+		}
+		attr := DepCategoryAttr(c, cat)
+		if attrDeps[attr] == nil {
+			attrDeps[attr] = make(map[string][]string)
+		}
+		for _, dep := range deps {
+			s := dep.label.Rel(from.Repo, from.Pkg).String()
+			attrDeps[attr][s] = append(attrDeps[attr][s], dep.imp.Imp)
+		}
+	}
+	for attr, depImps := range attrDeps {
+		deps := make([]string, 0, len(depImps))
+		for dep := range depImps {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		if !annotate {
+			r.SetAttr(attr, deps)
+			continue
+		}
+		annotated := make(rule.AnnotatedStrings, 0, len(deps))
+		for _, dep := range deps {
+			annotated = append(annotated, rule.AnnotatedString{
+				Value:   dep,
+				Comment: depAnnotation(depImps[dep]),
+			})
+		}
+		r.SetAttr(attr, annotated)
+	}
+}
+
+// PrepareMerge records options on r, a generated rule, that affect how it's
+// merged with a matching rule in an existing build file by
+// merger.MergeFile. It should be called after r is resolved.
+//
+// Calls to glob in the existing rule's dependency attributes, for example,
+// written by another tool, are preserved. When the expand_glob_deps
+// directive is set, they're replaced by the resolved dependencies instead,
+// except for globs marked with "# keep". See rule.GlobsKey.
+func PrepareMerge(c *config.Config, r *rule.Rule) {
+	if getResolveConfig(c).expandGlobDeps {
+		r.SetPrivateAttr(rule.GlobsKey, rule.ExpandGlobs)
+	} else {
+		r.SetPrivateAttr(rule.GlobsKey, rule.PreserveGlobs)
+	}
+}
+
+// depAnnotation returns the text of a comment listing the imports a
+// dependency was resolved from, like `from "a", "b"`.
+func depAnnotation(imps []string) string {
+	sorted := append([]string(nil), imps...)
+	sort.Strings(sorted)
+	var b strings.Builder
+	b.WriteString("from ")
+	for i, imp := range sorted {
+		if i > 0 && imp == sorted[i-1] {
+			continue
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.Quote(imp))
+	}
+	return b.String()
+}
@@ -0,0 +1,272 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+type testCategorizer struct {
+	testResolver
+}
+
+func (*testCategorizer) DepCategory(imp ImportSpec) []string {
+	switch {
+	case strings.HasPrefix(imp.Imp, "both/"):
+		return []string{"deps", "link_deps"}
+	case strings.HasPrefix(imp.Imp, "link/"):
+		return []string{"link_deps"}
+	default:
+		return nil
+	}
+}
+
+func TestCategorizedDeps(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:dep_category_attr link_deps linkdeps
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	rslv := &testCategorizer{testResolver{name: "test"}}
+	from := label.New("", "pkg", "a")
+	deps := NewCategorizedDeps(rslv)
+	deps.Add(ImportSpec{Lang: "test", Imp: "plain/x"}, label.New("", "plain", "x"))
+	deps.Add(ImportSpec{Lang: "test", Imp: "both/y"}, label.New("", "both", "y"))
+	deps.Add(ImportSpec{Lang: "test", Imp: "link/z"}, label.New("", "pkg", "z"))
+	deps.Add(ImportSpec{Lang: "test", Imp: "plain/x2"}, label.New("", "plain", "x"))
+
+	if got, want := deps.Categories(), []string{"deps", "link_deps"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("categories: got %q; want %q", got, want)
+	}
+
+	r := rule.NewRule("test_library", "a")
+	deps.Write(c, r, from)
+	if got, want := r.AttrStrings("deps"), []string{"//both:y", "//plain:x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deps: got %q; want %q", got, want)
+	}
+	if got, want := r.AttrStrings("linkdeps"), []string{"//both:y", ":z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("linkdeps: got %q; want %q", got, want)
+	}
+	if r.Attr("link_deps") != nil {
+		t.Errorf("link_deps should not be set when the category is mapped to another attribute")
+	}
+}
+
+func TestCategorizedDepsUsage(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testResolver{name: "test"}
+	from := label.New("", "pkg", "a")
+	deps := NewCategorizedDeps(rslv)
+	deps.AddWithUsage(ImportSpec{Lang: "test", Imp: "compile"}, CompileUsage, label.New("", "compile", "x"))
+	deps.AddWithUsage(ImportSpec{Lang: "test", Imp: "runtime"}, RuntimeUsage, label.New("", "runtime", "y"))
+	deps.AddWithUsage(ImportSpec{Lang: "test", Imp: "both/runtime"}, RuntimeUsage, label.New("", "both", "z"))
+	deps.AddWithUsage(ImportSpec{Lang: "test", Imp: "both/compile"}, CompileUsage, label.New("", "both", "z"))
+
+	if got, want := deps.Categories(), []string{"deps", "runtime_deps"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("categories: got %q; want %q", got, want)
+	}
+
+	r := rule.NewRule("test_library", "a")
+	deps.Write(c, r, from)
+	if got, want := r.AttrStrings("deps"), []string{"//both:z", "//compile:x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deps: got %q; want %q", got, want)
+	}
+	if got, want := r.AttrStrings("runtime_deps"), []string{"//runtime:y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("runtime_deps: got %q; want %q", got, want)
+	}
+}
+
+type pluginCategorizer struct {
+	testResolver
+}
+
+func (*pluginCategorizer) DepCategory(imp ImportSpec) []string {
+	if strings.HasPrefix(imp.Imp, "@") {
+		return []string{PluginDepCategory}
+	}
+	return nil
+}
+
+func TestCategorizedDepsPlugins(t *testing.T) {
+	c := testConfig(t)
+	rslv := &pluginCategorizer{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "lib",
+		content: `
+test_library(
+    name = "lib",
+    provides = ["lib"],
+)
+
+test_library(
+    name = "processor",
+    provides = ["@processor"],
+)
+`,
+	}}, rslv)
+
+	from := label.New("", "pkg", "a")
+	deps := NewCategorizedDeps(rslv)
+	for _, imp := range []string{"lib", "@processor"} {
+		spec := ImportSpec{Lang: "test", Imp: imp}
+		results := ix.FindRulesByImportWithConfig(c, spec, "test")
+		if len(results) != 1 {
+			t.Fatalf("%s: got %d results; want 1", imp, len(results))
+		}
+		deps.Add(spec, results[0].Label)
+	}
+
+	if got, want := deps.Categories(), []string{"deps", "plugins"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("categories: got %q; want %q", got, want)
+	}
+	r := rule.NewRule("test_library", "a")
+	deps.Write(c, r, from)
+	if got, want := r.AttrStrings("deps"), []string{"//lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deps: got %q; want %q", got, want)
+	}
+	if got, want := r.AttrStrings("plugins"), []string{"//lib:processor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plugins: got %q; want %q", got, want)
+	}
+}
+
+func TestCategorizedDepsAnnotations(t *testing.T) {
+	c := testConfig(t, "-annotate_deps")
+	rslv := &testResolver{name: "test"}
+	from := label.New("", "pkg", "a")
+
+	generate := func(imps map[string]label.Label) *rule.Rule {
+		deps := NewCategorizedDeps(rslv)
+		for imp, l := range imps {
+			deps.Add(ImportSpec{Lang: "test", Imp: imp}, l)
+		}
+		r := rule.NewRule("test_library", "a")
+		deps.Write(c, r, from)
+		return r
+	}
+	update := func(content string, gen *rule.Rule) string {
+		f, err := rule.LoadData("BUILD.bazel", "pkg", []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Rules) == 0 {
+			gen.Insert(f)
+		} else {
+			rule.MergeRules(gen, f.Rules[0], map[string]bool{"deps": true}, f.Path)
+		}
+		return string(f.Format())
+	}
+
+	imps := map[string]label.Label{
+		"example.com/foo/bar": label.New("", "foo", "bar"),
+		"example.com/foo/baz": label.New("", "foo", "bar"),
+		"example.com/x":       label.New("", "x", "x"),
+	}
+	want := `test_library(
+    name = "a",
+    deps = [
+        "//foo:bar",  # from "example.com/foo/bar", "example.com/foo/baz"
+        "//x",  # from "example.com/x"
+    ],
+)
+`
+	got := update("", generate(imps))
+	if got != want {
+		t.Fatalf("first run: got:\n%s\nwant:\n%s", got, want)
+	}
+	if again := update(got, generate(imps)); again != want {
+		t.Errorf("second run: got:\n%s\nwant:\n%s", again, want)
+	}
+
+	delete(imps, "example.com/foo/baz")
+	want = `test_library(
+    name = "a",
+    deps = [
+        "//foo:bar",  # from "example.com/foo/bar"
+        "//x",  # from "example.com/x"
+    ],
+)
+`
+	if changed := update(got, generate(imps)); changed != want {
+		t.Errorf("after changing imports: got:\n%s\nwant:\n%s", changed, want)
+	}
+}
+
+type testAmbientResolver struct {
+	testResolver
+}
+
+func (*testAmbientResolver) AmbientImports() []ImportSpec {
+	return []ImportSpec{{Lang: "test", Imp: "runtime"}}
+}
+
+func TestCategorizedDepsAmbient(t *testing.T) {
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	c := testConfig(t)
+	rslv := &testAmbientResolver{testResolver{name: "test"}}
+	from := label.New("", "pkg", "a")
+	known := map[string]label.Label{"lib": label.New("", "lib", "lib")}
+
+	deps := NewCategorizedDeps(rslv)
+	for _, s := range []string{"runtime", "lib", "missing"} {
+		imp := ImportSpec{Lang: "test", Imp: s}
+		if deps.AddAmbient(imp) {
+			continue
+		}
+		if l, ok := known[s]; ok {
+			deps.Add(imp, l)
+		} else {
+			deps.AddUnresolved(c, from, imp, fmt.Errorf("%s: could not resolve %q", from, s))
+		}
+	}
+	r := rule.NewRule("test_library", "a")
+	deps.Write(c, r, from)
+
+	if got, want := r.AttrStrings("deps"), []string{"//lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deps: got %q; want %q", got, want)
+	}
+	wantReport := ImportReport{
+		Resolved:   []ImportSpec{{Lang: "test", Imp: "lib"}},
+		Ambient:    []ImportSpec{{Lang: "test", Imp: "runtime"}},
+		Unresolved: []ImportSpec{{Lang: "test", Imp: "missing"}},
+	}
+	if got := deps.Report(); !reflect.DeepEqual(got, wantReport) {
+		t.Errorf("report: got %#v; want %#v", got, wantReport)
+	}
+	logs := logBuf.String()
+	if strings.Contains(logs, "runtime") {
+		t.Errorf("ambient import was logged: %s", logs)
+	}
+	if !strings.Contains(logs, `"missing"`) {
+		t.Errorf("unresolved import was not logged: %s", logs)
+	}
+}
@@ -0,0 +1,46 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "github.com/bazelbuild/bazel-gazelle/label"
+
+// SetChangedLabels sets the labels of rules whose sources changed, for
+// example, in the change being tested by an incremental build. When an
+// import is ambiguous, FindRulesByImportWithConfig prefers changed rules
+// over others, so that rebuilds stay close to the change. Labels should be
+// absolute, like the labels in FindResult. Passing nil clears the set.
+func (ix *RuleIndex) SetChangedLabels(set map[label.Label]bool) {
+	ix.changed = set
+}
+
+// preferChanged returns the results whose labels are in the set passed to
+// SetChangedLabels, if there is more than one result and at least one of
+// them changed. Otherwise, results is returned unchanged.
+func (ix *RuleIndex) preferChanged(results []FindResult) []FindResult {
+	if len(results) < 2 || len(ix.changed) == 0 {
+		return results
+	}
+	var changed []FindResult
+	for _, r := range results {
+		if ix.changed[r.Label] {
+			changed = append(changed, r)
+		}
+	}
+	if len(changed) == 0 {
+		return results
+	}
+	return changed
+}
@@ -0,0 +1,79 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestSetChangedLabels(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "pkg",
+		content: `
+test_library(
+    name = "a",
+    provides = ["dup", "unique"],
+)
+
+test_library(
+    name = "b",
+    provides = ["dup"],
+)
+
+test_library(
+    name = "c",
+    provides = ["dup"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	find := func(imp string) []string {
+		return resultLabels(ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: imp}, "test"))
+	}
+	if got, want := find("dup"), []string{"//pkg:a", "//pkg:b", "//pkg:c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("no changes: got %v; want %v", got, want)
+	}
+
+	ix.SetChangedLabels(map[label.Label]bool{label.New("", "pkg", "b"): true})
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "dup", want: []string{"//pkg:b"}},
+		{imp: "unique", want: []string{"//pkg:a"}},
+	} {
+		if got := find(tc.imp); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+
+	ix.SetChangedLabels(map[label.Label]bool{
+		label.New("", "pkg", "b"): true,
+		label.New("", "pkg", "c"): true,
+	})
+	if got, want := find("dup"), []string{"//pkg:b", "//pkg:c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("two changes: got %v; want %v", got, want)
+	}
+
+	ix.SetChangedLabels(map[label.Label]bool{label.New("", "other", "x"): true})
+	if got, want := find("dup"), []string{"//pkg:a", "//pkg:b", "//pkg:c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unrelated change: got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// RuleDepChange describes how resolution changed the dependencies of a rule.
+// It may be used to review proposed changes without writing build files.
+type RuleDepChange struct {
+	// Label is the absolute label of the rule.
+	Label label.Label
+
+	// Added is the sorted list of absolute labels of new dependencies.
+	Added []label.Label
+
+	// Removed is the sorted list of absolute labels of dependencies that
+	// are no longer needed.
+	Removed []label.Label
+}
+
+// RuleDeps returns the sorted absolute labels in the "deps" attribute of r,
+// including labels in select expressions, without duplicates. from is the
+// label of r. Labels that can't be parsed are ignored.
+func RuleDeps(r *rule.Rule, from label.Label) []label.Label {
+	seen := make(map[label.Label]bool)
+	var deps []label.Label
+	for _, s := range attrLabelStrings(r, "deps") {
+		l, err := label.Parse(s)
+		if err != nil {
+			continue
+		}
+		l = l.Abs(from.Repo, from.Pkg)
+		if !seen[l] {
+			seen[l] = true
+			deps = append(deps, l)
+		}
+	}
+	sortLabels(deps)
+	return deps
+}
+
+// DiffDeps compares old and new, the dependencies of the rule from before
+// and after resolution, as returned by RuleDeps. False is returned if the
+// dependencies are the same.
+func DiffDeps(from label.Label, old, new []label.Label) (RuleDepChange, bool) {
+	change := RuleDepChange{Label: from}
+	change.Added = labelsNotIn(new, old)
+	change.Removed = labelsNotIn(old, new)
+	return change, len(change.Added) > 0 || len(change.Removed) > 0
+}
+
+// labelsNotIn returns the labels in a that are not in b.
+func labelsNotIn(a, b []label.Label) []label.Label {
+	inB := make(map[label.Label]bool, len(b))
+	for _, l := range b {
+		inB[l] = true
+	}
+	var diff []label.Label
+	for _, l := range a {
+		if !inB[l] {
+			diff = append(diff, l)
+		}
+	}
+	return diff
+}
+
+func sortLabels(labels []label.Label) {
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].String() < labels[j].String()
+	})
+}
+
+// WriteDepChanges writes changes to w as an indented JSON list of objects
+// with "label", "added", and "removed" fields. Labels are written as
+// strings.
+func WriteDepChanges(w io.Writer, changes []RuleDepChange) error {
+	type jsonChange struct {
+		Label   string   `json:"label"`
+		Added   []string `json:"added"`
+		Removed []string `json:"removed"`
+	}
+	jsonChanges := make([]jsonChange, len(changes))
+	for i, c := range changes {
+		jsonChanges[i] = jsonChange{
+			Label:   c.Label.String(),
+			Added:   labelStrings(c.Added),
+			Removed: labelStrings(c.Removed),
+		}
+	}
+	data, err := json.MarshalIndent(jsonChanges, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+func labelStrings(labels []label.Label) []string {
+	strs := make([]string, len(labels))
+	for i, l := range labels {
+		strs[i] = l.String()
+	}
+	return strs
+}
@@ -0,0 +1,62 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "strings"
+
+// ImportSpec is used as a map key, so it can't hold structured data
+// directly. Languages with structured imports (for example, a module,
+// submodule, and symbol) may build import specs from components with
+// NewCompositeImport and recover the components with Components.
+//
+// The canonical form of a composite import joins its components with "/".
+// Within each component, "%" is written as "%25" and "/" is written as "%2F",
+// so that every list of components has exactly one canonical form, and
+// components may contain any character. Composite imports whose components
+// contain neither character look like slash-separated paths, so they work
+// with directives that match import paths, like resolve_template.
+
+// NewCompositeImport returns an import spec for lang whose Imp is the
+// canonical form of components.
+func NewCompositeImport(lang string, components ...string) ImportSpec {
+	escaped := make([]string, len(components))
+	for i, c := range components {
+		escaped[i] = escapeComponent(c)
+	}
+	return ImportSpec{Lang: lang, Imp: strings.Join(escaped, "/")}
+}
+
+// Components returns the components of a composite import built with
+// NewCompositeImport. For other imports, Components splits Imp on "/".
+// Components returns nil if Imp is empty.
+func (imp ImportSpec) Components() []string {
+	if imp.Imp == "" {
+		return nil
+	}
+	components := strings.Split(imp.Imp, "/")
+	for i, c := range components {
+		components[i] = unescapeComponent(c)
+	}
+	return components
+}
+
+var (
+	componentEscaper   = strings.NewReplacer("%", "%25", "/", "%2F")
+	componentUnescaper = strings.NewReplacer("%25", "%", "%2F", "/", "%2f", "/")
+)
+
+func escapeComponent(c string) string   { return componentEscaper.Replace(c) }
+func unescapeComponent(c string) string { return componentUnescaper.Replace(c) }
@@ -0,0 +1,98 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// compositeResolver indexes rules by the symbols they export from a module
+// and submodule.
+type compositeResolver struct {
+	testResolver
+}
+
+func (cr *compositeResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	var imps []ImportSpec
+	for _, sym := range r.AttrStrings("symbols") {
+		imps = append(imps, NewCompositeImport(cr.name, r.AttrString("module"), r.AttrString("submodule"), sym))
+	}
+	return imps
+}
+
+func TestCompositeImport(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		components []string
+		key        string
+	}{
+		{desc: "plain", components: []string{"mod", "sub", "sym"}, key: "mod/sub/sym"},
+		{desc: "slash", components: []string{"a/b", "c"}, key: "a%2Fb/c"},
+		{desc: "percent", components: []string{"100%", "x"}, key: "100%25/x"},
+		{desc: "escape_like", components: []string{"%2F"}, key: "%252F"},
+		{desc: "empty_component", components: []string{"mod", "", "sym"}, key: "mod//sym"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			imp := NewCompositeImport("x", tc.components...)
+			if imp.Imp != tc.key {
+				t.Errorf("key: got %q; want %q", imp.Imp, tc.key)
+			}
+			if got := imp.Components(); !reflect.DeepEqual(got, tc.components) {
+				t.Errorf("components: got %q; want %q", got, tc.components)
+			}
+		})
+	}
+}
+
+func TestResolveCompositeImport(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "lib",
+		content: `
+x_library(
+    name = "core",
+    module = "app",
+    submodule = "core",
+    symbols = ["Start", "Stop"],
+)
+
+x_library(
+    name = "paths",
+    module = "app",
+    submodule = "io/paths",
+    symbols = ["Join"],
+)
+`,
+	}}, &compositeResolver{testResolver{name: "x"}})
+
+	for _, tc := range []struct {
+		imp  ImportSpec
+		want []string
+	}{
+		{imp: NewCompositeImport("x", "app", "core", "Stop"), want: []string{"//lib:core"}},
+		{imp: NewCompositeImport("x", "app", "io/paths", "Join"), want: []string{"//lib:paths"}},
+		{imp: ImportSpec{Lang: "x", Imp: "app/io/paths/Join"}, want: nil},
+		{imp: NewCompositeImport("x", "app", "core", "Join"), want: nil},
+	} {
+		if got := resultLabels(ix.FindRulesByImportWithConfig(c, tc.imp, "x")); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v; want %v", tc.imp.Components(), got, tc.want)
+		}
+	}
+}
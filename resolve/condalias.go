@@ -0,0 +1,75 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// conditionalAliasActuals returns the labels that r may select if r is an
+// alias rule whose "actual" attribute is a select expression, like:
+//
+//	alias(
+//	    name = "impl",
+//	    actual = select({
+//	        "//conditions:linux": ":impl_linux",
+//	        "//conditions:default": ":impl_generic",
+//	    }),
+//	)
+//
+// from is the label of r. Labels are returned in the order they appear,
+// without duplicates. False is returned if r is not such an alias, or if
+// any selected value is not a label string.
+func conditionalAliasActuals(r *rule.Rule, from label.Label) ([]label.Label, bool) {
+	if r.Kind() != "alias" {
+		return nil, false
+	}
+	call, ok := r.Attr("actual").(*bzl.CallExpr)
+	if !ok || len(call.List) != 1 {
+		return nil, false
+	}
+	if x, ok := call.X.(*bzl.Ident); !ok || x.Name != "select" {
+		return nil, false
+	}
+	dict, ok := call.List[0].(*bzl.DictExpr)
+	if !ok || len(dict.List) == 0 {
+		return nil, false
+	}
+	var actuals []label.Label
+	seen := make(map[label.Label]bool)
+	for _, e := range dict.List {
+		kv, ok := e.(*bzl.KeyValueExpr)
+		if !ok {
+			return nil, false
+		}
+		str, ok := kv.Value.(*bzl.StringExpr)
+		if !ok {
+			return nil, false
+		}
+		l, err := label.Parse(str.Value)
+		if err != nil {
+			return nil, false
+		}
+		l = l.Abs(from.Repo, from.Pkg)
+		if !seen[l] {
+			seen[l] = true
+			actuals = append(actuals, l)
+		}
+	}
+	return actuals, true
+}
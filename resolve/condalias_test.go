@@ -0,0 +1,122 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestConditionalAlias(t *testing.T) {
+	files := []testFile{{
+		rel: "net",
+		content: `
+alias(
+    name = "net",
+    actual = select({
+        "//conditions:linux": ":net_linux",
+        "//conditions:default": ":net_generic",
+    }),
+)
+
+test_library(
+    name = "net_linux",
+    provides = ["example.com/net", "example.com/net/epoll"],
+)
+
+test_library(
+    name = "net_generic",
+    provides = ["example.com/net"],
+)
+
+alias(
+    name = "partial",
+    actual = select({
+        "//conditions:linux": ":fs_linux",
+        "//conditions:default": "@ext//fs",
+    }),
+)
+
+test_library(
+    name = "fs_linux",
+    provides = ["example.com/fs"],
+)
+
+alias(
+    name = "plain",
+    actual = ":net_generic",
+)
+`,
+	}}
+
+	for _, tc := range []struct {
+		desc, directive string
+		want            map[string][]string
+	}{
+		{
+			// The plain alias is indexed in place of :net_generic, so it
+			// provides example.com/net along with the conditional alias.
+			desc: "alias",
+			want: map[string][]string{
+				"example.com/net":       {"//net", "//net:plain"},
+				"example.com/net/epoll": nil,
+				"example.com/fs":        {"//net:fs_linux"},
+			},
+		}, {
+			desc:      "actual",
+			directive: "# gazelle:alias_resolution actual",
+			want: map[string][]string{
+				"example.com/net":       {"//net"},
+				"example.com/net/epoll": nil,
+				"example.com/fs":        {"//net:fs_linux"},
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := testConfig(t)
+			f := loadTestFiles(t, []testFile{{content: tc.directive}})[0]
+			cr := &Configurer{}
+			cr.Configure(c, "", f)
+			ix := buildTestIndex(t, c, files, &testResolver{name: "test"})
+			got := make(map[string][]string)
+			for imp := range tc.want {
+				got[imp] = resultLabels(ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: imp}, "test"))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	c := testConfig(t)
+	f := loadTestFiles(t, []testFile{{content: "# gazelle:alias_resolution actual"}})[0]
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+	ix := buildTestIndex(t, c, files, &testResolver{name: "test"})
+	results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "example.com/net"}, "test")
+	if len(results) != 1 || !results[0].ConditionalAlias {
+		t.Fatalf("got %+v; want one conditional alias result", results)
+	}
+	if !results[0].IsSelfImport(label.New("", "net", "net_linux")) {
+		t.Errorf("import from a selected rule is not a self-import")
+	}
+	fsResults := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "example.com/fs"}, "test")
+	if len(fsResults) != 1 || fsResults[0].ConditionalAlias {
+		t.Errorf("got %+v; want one result that is not a conditional alias", fsResults)
+	}
+}
@@ -17,11 +17,17 @@ package resolve
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
 	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
@@ -29,31 +35,483 @@ import (
 // dependency resolution overrides. Overrides specified later (in configuration
 // files in deeper directories, or closer to the end of the file) are
 // returned first. If no override is found, label.NoLabel is returned.
+//
+// Overrides with wildcard import strings (ending with "/...") are not
+// considered; see FindRuleWithWildcardOverride.
+//
+// Aliases declared with the resolve_alias directive are followed, so an
+// import may be resolved through a chain of aliases to the label of
+// a resolve directive. If a chain of aliases is cyclic or too long, the
+// problem is logged, and no override is returned. Use
+// FindRuleWithOverrideChain to get an error instead.
+//
+// If no resolve directive matches imp, patterns from resolve_template
+// directives are tried, and the label is computed from the template of the
+// last one that matches.
+//
+// For a resolve_any directive, the last candidate label is returned. Use
+// RuleIndex.FindRuleWithOverride to pick the first candidate that exists.
 func FindRuleWithOverride(c *config.Config, imp ImportSpec, lang string) (label.Label, bool) {
+	l, ok, err := FindRuleWithOverrideChain(c, imp, lang)
+	if err != nil {
+		log.Print(err)
+		return label.NoLabel, false
+	}
+	return l, ok
+}
+
+// maxAliasDepth is the maximum number of resolve_alias directives that may
+// be followed to resolve an import.
+const maxAliasDepth = 16
+
+// FindRuleWithOverrideChain is like FindRuleWithOverride, but it returns an
+// error if imp leads to a cycle of aliases or to a chain of more than
+// maxAliasDepth aliases.
+func FindRuleWithOverrideChain(c *config.Config, imp ImportSpec, lang string) (label.Label, bool, error) {
+	o, ok, err := findOverrideChain(c, imp, lang)
+	if !ok || err != nil {
+		return label.NoLabel, false, err
+	}
+	return o.dep, true, nil
+}
+
+// FindRuleWithOverride is like the package-level FindRuleWithOverride, but
+// it can choose among the candidates of a resolve_any directive. The first
+// candidate that is the label of an indexed rule, or that a CrossResolver
+// returns for imp, is used. If no candidate is known, the last one is used.
+// Without an index, FindRuleWithOverride always uses the last candidate.
+func (ix *RuleIndex) FindRuleWithOverride(c *config.Config, imp ImportSpec, lang string) (label.Label, bool) {
+	o, ok, err := findOverrideChain(c, imp, lang)
+	if err != nil {
+		log.Print(err)
+		return label.NoLabel, false
+	}
+	if !ok {
+		return label.NoLabel, false
+	}
+	for _, l := range o.candidates {
+		if ix.isKnownCandidate(c, l, imp, lang) {
+			return l, true
+		}
+	}
+	return o.dep, true
+}
+
+// isKnownCandidate returns whether l is the label of a rule in ix or one of
+// its fallbacks, or whether a CrossResolver returns l for imp.
+func (ix *RuleIndex) isKnownCandidate(c *config.Config, l label.Label, imp ImportSpec, lang string) bool {
+	keys := []label.Label{l}
+	if isFirstParty(c, l) {
+		keys = append(keys, label.New(c.RepoName, l.Pkg, l.Name), label.New("", l.Pkg, l.Name))
+	}
+	for cur := ix; cur != nil; cur = cur.fallback {
+		for _, k := range keys {
+			if _, ok := cur.labelMap[k]; ok {
+				return true
+			}
+		}
+	}
+	if ix == nil {
+		return false
+	}
+	for _, cr := range ix.crossResolvers {
+		for _, res := range ix.crossResolve(c, cr, imp, lang) {
+			for _, k := range keys {
+				if res.Label.Equal(k) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// findOverrideChain returns the override that imp resolves to after
+// following resolve_alias directives.
+func findOverrideChain(c *config.Config, imp ImportSpec, lang string) (overrideSpec, bool, error) {
 	rc := getResolveConfig(c)
+	chain := []string{imp.Imp}
+	visited := map[string]bool{imp.Imp: true}
+	for {
+		o, ok := rc.findExactOverride(imp, lang)
+		if !ok {
+			o, ok = rc.findTemplateOverride(imp)
+		}
+		if !ok {
+			return overrideSpec{}, false, nil
+		}
+		if o.alias == "" {
+			return o, true, nil
+		}
+		imp.Imp = o.alias
+		chain = append(chain, imp.Imp)
+		if visited[imp.Imp] {
+			return overrideSpec{}, false, fmt.Errorf("gazelle:resolve_alias: cycle of aliases: %s", strings.Join(chain, " -> "))
+		}
+		if len(chain) > maxAliasDepth+1 {
+			return overrideSpec{}, false, fmt.Errorf("gazelle:resolve_alias: more than %d aliases followed from %q", maxAliasDepth, chain[0])
+		}
+		visited[imp.Imp] = true
+	}
+}
+
+// findTemplateOverride returns an override with a label computed from the
+// last resolve_template directive whose pattern matches imp.
+func (rc *resolveConfig) findTemplateOverride(imp ImportSpec) (overrideSpec, bool) {
+	for i := len(rc.templates) - 1; i >= 0; i-- {
+		t := rc.templates[i]
+		if t.lang != imp.Lang {
+			continue
+		}
+		m := t.re.FindStringSubmatch(imp.Imp)
+		if m == nil {
+			continue
+		}
+		s := t.template
+		for j, name := range t.re.SubexpNames() {
+			if j == 0 {
+				continue
+			}
+			s = strings.Replace(s, "{"+strconv.Itoa(j)+"}", m[j], -1)
+			if name != "" {
+				s = strings.Replace(s, "{"+name+"}", m[j], -1)
+			}
+		}
+		l, err := label.Parse(s)
+		if err != nil {
+			log.Printf("gazelle:resolve_template: import %q: %v", imp.Imp, err)
+			continue
+		}
+		return overrideSpec{imp: imp, dep: l.Abs("", t.rel)}, true
+	}
+	return overrideSpec{}, false
+}
+
+// RewriteImport applies the rewrites set with import_rewrite directives to
+// imp. Each rewrite replaces all matches of its regular expression with its
+// replacement, which may refer to submatches like $1. Rewrites are applied
+// in the order they were declared, from parent directories first.
+//
+// The index applies rewrites to imports returned by Resolver.Imports, and
+// FindRulesByImportWithConfig applies them to the imports it looks up, so
+// both forms of a rewritten import find the same rules.
+func RewriteImport(c *config.Config, imp ImportSpec) ImportSpec {
+	for _, rw := range getResolveConfig(c).importRewrites {
+		imp.Imp = rw.re.ReplaceAllString(imp.Imp, rw.replacement)
+	}
+	return imp
+}
+
+// ReplaceDeprecatedImport returns the import that should be resolved in
+// place of imp. If imp was deprecated with the deprecate_import directive,
+// a warning naming the replacement is logged the first time imp is seen,
+// and the replacement is returned. Replacements that are themselves
+// deprecated are followed. Otherwise, imp is returned unchanged.
+//
+// Resolvers should call this before looking up imp, so that overrides and
+// the rule index are consulted for the replacement.
+func ReplaceDeprecatedImport(c *config.Config, imp ImportSpec) ImportSpec {
+	rc := getResolveConfig(c)
+	visited := make(map[string]bool)
+	for !visited[imp.Imp] {
+		visited[imp.Imp] = true
+		replacement, ok := rc.deprecatedImports[imp]
+		if !ok {
+			break
+		}
+		if !rc.deprecationsWarned[imp] {
+			rc.deprecationsWarned[imp] = true
+			log.Printf("warning: %s import %q is deprecated; use %q instead", imp.Lang, imp.Imp, replacement)
+		}
+		imp.Imp = replacement
+	}
+	return imp
+}
+
+// findExactOverride returns the last override without a wildcard that
+// matches imp.
+func (rc *resolveConfig) findExactOverride(imp ImportSpec, lang string) (overrideSpec, bool) {
 	for i := len(rc.overrides) - 1; i >= 0; i-- {
 		o := rc.overrides[i]
-		if o.matches(imp, lang) {
-			return o.dep, true
+		if !o.wildcard && o.matches(imp, lang) {
+			return o, true
 		}
 	}
-	return label.NoLabel, false
+	return overrideSpec{}, false
+}
+
+// FindRuleWithWildcardOverride searches the current configuration for
+// user-specified overrides with wildcard import strings like
+// "example.com/foo/...", which match "example.com/foo" and any import string
+// that starts with "example.com/foo/". If several overrides match, the one
+// with the longest prefix is returned. Among overrides with equal prefixes,
+// the one specified later is returned.
+//
+// Resolvers should consult wildcard overrides after looking up imp in the
+// rule index, so that rules which actually provide imp take precedence.
+func FindRuleWithWildcardOverride(c *config.Config, imp ImportSpec, lang string) (label.Label, bool) {
+	rc := getResolveConfig(c)
+	var best *overrideSpec
+	for i := len(rc.overrides) - 1; i >= 0; i-- {
+		o := &rc.overrides[i]
+		if o.wildcard && o.matches(imp, lang) && (best == nil || len(o.imp.Imp) > len(best.imp.Imp)) {
+			best = o
+		}
+	}
+	if best == nil {
+		return label.NoLabel, false
+	}
+	return best.dep, true
+}
+
+// ResolverForKind returns the name of the resolver that should handle rules
+// of the given kind, as set with the resolver_for_kind directive in the
+// current directory or a parent. The name should match the Name method of
+// a Resolver. False is returned if no resolver was set for kind.
+func ResolverForKind(c *config.Config, kind string) (string, bool) {
+	name, ok := getResolveConfig(c).kindResolvers[kind]
+	return name, ok
+}
+
+type importTimeout struct {
+	// prefix is the import string the timeout applies to. If wildcard is
+	// true, the timeout also applies to imports beneath prefix.
+	prefix   string
+	wildcard bool
+	timeout  time.Duration
+}
+
+// crossResolveTimeoutForImport returns the maximum time CrossResolvers may
+// take to resolve imp. Patterns from cross_resolve_timeout directives are
+// matched like wildcard resolve directives: an exact match is preferred,
+// then the longest matching prefix. If no pattern matches, the value of
+// -cross_resolve_timeout is returned. Zero means there is no limit.
+func crossResolveTimeoutForImport(c *config.Config, imp ImportSpec) time.Duration {
+	rc := getResolveConfig(c)
+	var best *importTimeout
+	for i := len(rc.importTimeouts) - 1; i >= 0; i-- {
+		it := &rc.importTimeouts[i]
+		if !it.wildcard {
+			if it.prefix == imp.Imp {
+				return it.timeout
+			}
+			continue
+		}
+		if pathtools.HasPrefix(imp.Imp, it.prefix) && (best == nil || len(it.prefix) > len(best.prefix)) {
+			best = it
+		}
+	}
+	if best != nil {
+		return best.timeout
+	}
+	return rc.crossResolveTimeout
+}
+
+type resolveTemplate struct {
+	// lang is the language of imports the template applies to.
+	lang string
+
+	// re matches entire import strings. Its submatches are substituted into
+	// template.
+	re       *regexp.Regexp
+	template string
+
+	// rel is the directory where the template was declared. Relative labels
+	// are resolved in this package.
+	rel string
+}
+
+type importRewrite struct {
+	re          *regexp.Regexp
+	replacement string
 }
 
 type overrideSpec struct {
 	imp  ImportSpec
 	lang string
 	dep  label.Label
+
+	// wildcard indicates the directive's import string ended with "/...".
+	// imp.Imp is the prefix before "/...".
+	wildcard bool
+
+	// alias is the import string that imp is an alias for, set with the
+	// resolve_alias directive. If alias is set, dep is not.
+	alias string
+
+	// candidates are the labels listed by a resolve_any directive, in the
+	// order they should be tried. dep is set to the last candidate.
+	candidates []label.Label
 }
 
 func (o overrideSpec) matches(imp ImportSpec, lang string) bool {
-	return imp.Lang == o.imp.Lang &&
-		imp.Imp == o.imp.Imp &&
-		(o.lang == "" || o.lang == lang)
+	if imp.Lang != o.imp.Lang || (o.lang != "" && o.lang != lang) {
+		return false
+	}
+	if o.wildcard {
+		return pathtools.HasPrefix(imp.Imp, o.imp.Imp)
+	}
+	return imp.Imp == o.imp.Imp
 }
 
 type resolveConfig struct {
 	overrides []overrideSpec
+
+	// maxDeps is the maximum number of dependencies a rule may have after
+	// resolution. Zero means there is no limit.
+	maxDeps int
+
+	// strict indicates that problems found during resolution should be
+	// reported as errors rather than warnings.
+	strict bool
+
+	// failFast indicates that resolution should stop at the first error.
+	// It implies strict.
+	failFast bool
+
+	// firstPartyOnly indicates that imports may only be resolved to rules in
+	// the main repository. Imports that would be resolved to rules in other
+	// repositories are reported as unresolved.
+	firstPartyOnly bool
+
+	// sourceRoot is the repository-relative path of the nearest directory
+	// marked with the source_root directive, or "" if there is none.
+	sourceRoot string
+
+	// annotateDeps indicates that resolved dependencies written with
+	// CategorizedDeps should be followed by comments naming the imports they
+	// were resolved from.
+	annotateDeps bool
+
+	// expandGlobDeps indicates that calls to glob in existing dependency
+	// attributes should be replaced with resolved dependencies, unless they
+	// are marked with "# keep". Set with the expand_glob_deps directive.
+	expandGlobDeps bool
+
+	// checkOrphanDeps indicates that existing dependencies that don't
+	// correspond to any resolved import should be reported.
+	checkOrphanDeps bool
+
+	// checkDepCycles indicates that cycles among resolved dependencies
+	// should be reported.
+	checkDepCycles bool
+
+	// annotateProvenance indicates that generated rules should be marked
+	// with a comment naming the Gazelle version and the time resolution ran.
+	// provenanceTime is the time recorded in those comments; it's set once
+	// per run in CheckFlags.
+	annotateProvenance bool
+	provenanceTime     time.Time
+
+	// forbiddenRepos is the set of repository names that dependencies may
+	// never be resolved to. Set with the forbidden_repo directive.
+	forbiddenRepos map[string]bool
+
+	// allowedRepos is the set of external repository names that
+	// dependencies may be resolved to, set with the allow_repo directive.
+	// When it's nil, any repository not forbidden may be used.
+	allowedRepos map[string]bool
+
+	// kindResolvers maps rule kinds to the names of resolvers that should
+	// handle them. Set with the resolver_for_kind directive.
+	kindResolvers map[string]string
+
+	// canonicalizeSymlinks indicates that rules should be indexed with labels
+	// computed from package paths with symbolic links resolved.
+	canonicalizeSymlinks bool
+
+	// crossResolveTimeout is the maximum time a CrossResolver may take to
+	// resolve an import. Zero means there is no limit.
+	crossResolveTimeout time.Duration
+
+	// importTimeouts overrides crossResolveTimeout for imports matching
+	// patterns. Set with the cross_resolve_timeout directive. Later entries
+	// take precedence over earlier entries with the same pattern.
+	importTimeouts []importTimeout
+
+	// categoryAttrs maps dependency categories to the attributes they are
+	// written to. Set with the dep_category_attr directive.
+	categoryAttrs map[string]string
+
+	// layers records the architectural layer of each package declared with
+	// the layer directive. It is shared by the configurations for all
+	// directories, since dependencies may cross between any of them.
+	layers *layerTable
+
+	// coverage counts generated and kept dependencies in each package. Like
+	// layers, it is shared by the configurations for all directories.
+	coverage map[string]*DepsCount
+
+	// pins maps imports to the labels that should be chosen when the imports
+	// are ambiguous. Set with the pin_import directive, so pins only apply
+	// in the directory where they're declared and its subdirectories.
+	pins map[ImportSpec]label.Label
+
+	// fallbackLangs maps import languages to languages whose rules may
+	// provide imports that aren't found in the original language. Set with
+	// the resolve_fallback_lang directive.
+	fallbackLangs map[string]string
+
+	// templates compute labels for imports matching patterns. Set with the
+	// resolve_template directive. Later entries take precedence.
+	templates []resolveTemplate
+
+	// importRewrites are applied to import strings before they are indexed
+	// or looked up. Set with the import_rewrite directive.
+	importRewrites []importRewrite
+
+	// deprecatedImports maps import specs to the import strings that should
+	// be resolved in their place. Set with the deprecate_import directive.
+	deprecatedImports map[ImportSpec]string
+
+	// deprecationsWarned is the set of imports declared with the
+	// deprecate_import directive that have already been reported. It is
+	// shared by the configurations for all directories, so each import is
+	// reported once.
+	deprecationsWarned map[ImportSpec]bool
+
+	// moduleMapPath is the value of -module_map. The file is loaded into
+	// moduleMap by CheckFlags.
+	moduleMapPath string
+	moduleMap     *ModuleMap
+
+	// localRepoFlags are the values of -index_local_repository, which are
+	// parsed into localRepos by CheckFlags.
+	localRepoFlags []string
+	localRepos     []LocalRepository
+
+	// defaultDeps maps rule kinds to absolute labels of dependencies that
+	// are added to every generated rule of that kind. Set with the
+	// default_dep directive.
+	defaultDeps map[string][]label.Label
+
+	// umbrellas lists targets that re-export a set of members, in the order
+	// they were declared with the umbrella directive.
+	umbrellas []umbrella
+
+	// ruleOverrideAttr is the name of the attribute read by RuleOverride.
+	// Set with the rule_override_attr directive. Overrides are disabled
+	// when it's empty.
+	ruleOverrideAttr string
+
+	// aliasesToActual is true if plain alias rules should not be indexed,
+	// so imports resolve to their actual targets. Set with the
+	// alias_resolution directive.
+	aliasesToActual bool
+
+	// quarantinePkg is the package containing placeholder targets for
+	// unresolved imports, set with -quarantine_package. See QuarantineLabel.
+	quarantinePkg string
+
+	// indexCachePath is the value of -index_cache. See AttachIndexCache.
+	// cacheKey identifies the flags and the directives in the current
+	// directory and its parents; it's part of the key of each cached file.
+	indexCachePath string
+	cacheKey       string
+
+	// indexParallelism is the value of -index_parallelism. See
+	// SetIndexParallelism.
+	indexParallelism int
 }
 
 const resolveName = "_resolve"
@@ -65,20 +523,64 @@ func getResolveConfig(c *config.Config) *resolveConfig {
 type Configurer struct{}
 
 func (_ *Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
-	c.Exts[resolveName] = &resolveConfig{}
+	rc := &resolveConfig{
+		layers:             &layerTable{},
+		coverage:           make(map[string]*DepsCount),
+		deprecationsWarned: make(map[ImportSpec]bool),
+		ruleOverrideAttr:   DefaultRuleOverrideAttr,
+	}
+	c.Exts[resolveName] = rc
+	fs.IntVar(&rc.maxDeps, "max_deps", 0, "when positive, gazelle will warn about rules with more resolved dependencies than this")
+	fs.BoolVar(&rc.annotateDeps, "annotate_deps", false, "when true, gazelle will write a comment after each resolved dependency naming the imports it was resolved from")
+	fs.BoolVar(&rc.canonicalizeSymlinks, "canonicalize_symlinks", false, "when true, rules in directories reached through symbolic links are indexed under the label of the directory the links point to")
+	fs.DurationVar(&rc.crossResolveTimeout, "cross_resolve_timeout", 0, "when positive, results from cross-language resolvers that take longer than this to resolve an import are ignored")
+	fs.BoolVar(&rc.firstPartyOnly, "first_party_only", false, "when true, imports are only resolved to rules in the main repository, and imports that would be resolved to rules in other repositories are reported as unresolved")
+	fs.Var(&gzflag.MultiFlag{Values: &rc.localRepoFlags}, "index_local_repository", "name=path of a local repository whose rules should be indexed, so imports may be resolved to them with labels in @name. May be repeated")
+	fs.BoolVar(&rc.checkOrphanDeps, "check_orphan_deps", false, "when true, gazelle reports dependencies in existing rules that don't correspond to any resolved import, unless they are marked with # keep")
+	fs.BoolVar(&rc.checkDepCycles, "check_dep_cycles", false, "when true, gazelle reports cycles among the dependencies it resolves")
+	fs.BoolVar(&rc.annotateProvenance, "annotate_provenance", false, "when true, gazelle will write a comment before each generated rule naming the gazelle version and the time dependencies were last resolved")
+	fs.StringVar(&rc.quarantinePkg, "quarantine_package", "", "when set, unresolved imports are resolved to placeholder targets in this package, named after the mangled import string")
+	fs.StringVar(&rc.indexCachePath, "index_cache", "", "path to a file where the results of indexing build files are cached between runs. Rules in build files that haven't changed are indexed from the cache")
+	fs.IntVar(&rc.indexParallelism, "index_parallelism", 1, "number of goroutines used to index build files. When greater than 1, the indexing methods of language extensions are called concurrently and must be safe for concurrent use. 0 means the number of available CPUs")
+	fs.StringVar(&rc.moduleMapPath, "module_map", "", "path to a JSON file mapping module import path prefixes to the external repositories that provide them. Imports in these modules are resolved without network access")
+	fs.BoolVar(&rc.strict, "strict_resolve", false, "when true, problems found while resolving dependencies are reported as errors instead of warnings")
+	fs.BoolVar(&rc.failFast, "strict_resolve_fail_fast", false, "when true, gazelle stops at the first problem found while resolving dependencies and reports it as an error. Implies -strict_resolve")
 }
 
-func (_ *Configurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error { return nil }
+func (_ *Configurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
+	rc := getResolveConfig(c)
+	if rc.failFast {
+		rc.strict = true
+	}
+	rc.quarantinePkg = strings.Trim(strings.TrimPrefix(rc.quarantinePkg, "//"), "/")
+	rc.cacheKey = flagsCacheKey(fs)
+	if rc.annotateProvenance {
+		rc.provenanceTime = time.Now().UTC()
+	}
+	if rc.moduleMapPath != "" {
+		m, err := LoadModuleMap(rc.moduleMapPath)
+		if err != nil {
+			return err
+		}
+		rc.moduleMap = m
+	}
+	for _, v := range rc.localRepoFlags {
+		lr, err := parseLocalRepository(v, c.RepoRoot)
+		if err != nil {
+			return err
+		}
+		rc.localRepos = append(rc.localRepos, lr)
+	}
+	return nil
+}
 
 func (_ *Configurer) KnownDirectives() []string {
-	return []string{"resolve"}
+	return []string{"resolve", "resolve_alias", "resolve_any", "resolve_template", "resolve_fallback_lang", "pin_import", "deprecate_import", "import_rewrite", "dep_category_attr", "expand_glob_deps", "forbidden_repo", "allow_repo", "resolver_for_kind", "cross_resolve_timeout", "default_dep", "umbrella", "source_root", "rule_override_attr", "alias_resolution", "layer"}
 }
 
 func (_ *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 	rc := getResolveConfig(c)
-	rcCopy := &resolveConfig{
-		overrides: rc.overrides[:],
-	}
+	rcCopy := *rc
 
 	if f != nil {
 		for _, d := range f.Directives {
@@ -99,6 +601,13 @@ func (_ *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 					log.Printf("could not parse directive: %s\n\texpected gazelle:resolve source-language [import-language] import-string label", d.Value)
 					continue
 				}
+				if o.imp.Imp == "..." {
+					o.imp.Imp = ""
+					o.wildcard = true
+				} else if strings.HasSuffix(o.imp.Imp, "/...") {
+					o.imp.Imp = strings.TrimSuffix(o.imp.Imp, "/...")
+					o.wildcard = true
+				}
 				var err error
 				o.dep, err = label.Parse(lbl)
 				if err != nil {
@@ -106,10 +615,266 @@ func (_ *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 					continue
 				}
 				o.dep = o.dep.Abs("", rel)
-				rcCopy.overrides = append(rcCopy.overrides, o)
+				rcCopy.overrides = append(rcCopy.overrides[:len(rcCopy.overrides):len(rcCopy.overrides)], o)
+			} else if d.Key == "resolve_alias" {
+				parts := strings.Fields(d.Value)
+				o := overrideSpec{}
+				if len(parts) == 3 {
+					o.imp.Lang = parts[0]
+					o.imp.Imp = parts[1]
+					o.alias = parts[2]
+				} else if len(parts) == 4 {
+					o.imp.Lang = parts[0]
+					o.lang = parts[1]
+					o.imp.Imp = parts[2]
+					o.alias = parts[3]
+				} else {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:resolve_alias source-language [import-language] import-string target-import-string", d.Value)
+					continue
+				}
+				rcCopy.overrides = append(rcCopy.overrides[:len(rcCopy.overrides):len(rcCopy.overrides)], o)
+			} else if d.Key == "deprecate_import" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 3 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:deprecate_import source-language import-string replacement-import-string", d.Value)
+					continue
+				}
+				deprecated := make(map[ImportSpec]string)
+				for k, v := range rcCopy.deprecatedImports {
+					deprecated[k] = v
+				}
+				deprecated[ImportSpec{Lang: parts[0], Imp: parts[1]}] = parts[2]
+				rcCopy.deprecatedImports = deprecated
+			} else if d.Key == "resolve_template" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 3 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:resolve_template lang import-regexp label-template", d.Value)
+					continue
+				}
+				re, err := regexp.Compile("^(?:" + parts[1] + ")$")
+				if err != nil {
+					log.Printf("gazelle:resolve_template %s: %v", d.Value, err)
+					continue
+				}
+				t := resolveTemplate{lang: parts[0], re: re, template: parts[2], rel: rel}
+				rcCopy.templates = append(rcCopy.templates[:len(rcCopy.templates):len(rcCopy.templates)], t)
+			} else if d.Key == "resolve_fallback_lang" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:resolve_fallback_lang primary-lang fallback-lang", d.Value)
+					continue
+				}
+				langs := make(map[string]string)
+				for k, v := range rcCopy.fallbackLangs {
+					langs[k] = v
+				}
+				langs[parts[0]] = parts[1]
+				rcCopy.fallbackLangs = langs
+			} else if d.Key == "pin_import" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 3 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:pin_import lang import-string label", d.Value)
+					continue
+				}
+				l, err := label.Parse(parts[2])
+				if err != nil {
+					log.Printf("gazelle:pin_import %s: %v", d.Value, err)
+					continue
+				}
+				pins := make(map[ImportSpec]label.Label)
+				for k, v := range rcCopy.pins {
+					pins[k] = v
+				}
+				pins[ImportSpec{Lang: parts[0], Imp: parts[1]}] = l.Abs("", rel)
+				rcCopy.pins = pins
+			} else if d.Key == "import_rewrite" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 1 && len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:import_rewrite regexp [replacement]", d.Value)
+					continue
+				}
+				re, err := regexp.Compile(parts[0])
+				if err != nil {
+					log.Printf("gazelle:import_rewrite %s: %v", d.Value, err)
+					continue
+				}
+				rw := importRewrite{re: re}
+				if len(parts) == 2 {
+					rw.replacement = parts[1]
+				}
+				rcCopy.importRewrites = append(rcCopy.importRewrites[:len(rcCopy.importRewrites):len(rcCopy.importRewrites)], rw)
+			} else if d.Key == "resolve_any" {
+				parts := strings.Fields(d.Value)
+				if len(parts) < 3 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:resolve_any source-language import-string label...", d.Value)
+					continue
+				}
+				o := overrideSpec{imp: ImportSpec{Lang: parts[0], Imp: parts[1]}}
+				for _, lbl := range parts[2:] {
+					l, err := label.Parse(lbl)
+					if err != nil {
+						log.Printf("gazelle:resolve_any %s: %v", d.Value, err)
+						o.candidates = nil
+						break
+					}
+					o.candidates = append(o.candidates, l.Abs("", rel))
+				}
+				if len(o.candidates) == 0 {
+					continue
+				}
+				o.dep = o.candidates[len(o.candidates)-1]
+				rcCopy.overrides = append(rcCopy.overrides[:len(rcCopy.overrides):len(rcCopy.overrides)], o)
+			} else if d.Key == "dep_category_attr" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:dep_category_attr category attr", d.Value)
+					continue
+				}
+				attrs := make(map[string]string)
+				for k, v := range rcCopy.categoryAttrs {
+					attrs[k] = v
+				}
+				attrs[parts[0]] = parts[1]
+				rcCopy.categoryAttrs = attrs
+			} else if d.Key == "expand_glob_deps" {
+				expand, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+				if err != nil {
+					log.Printf("gazelle:expand_glob_deps %s: %v", d.Value, err)
+					continue
+				}
+				rcCopy.expandGlobDeps = expand
+			} else if d.Key == "forbidden_repo" {
+				name := strings.TrimPrefix(strings.TrimSpace(d.Value), "@")
+				if name == "" {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:forbidden_repo repo_name", d.Value)
+					continue
+				}
+				repos := make(map[string]bool)
+				for k := range rcCopy.forbiddenRepos {
+					repos[k] = true
+				}
+				repos[name] = true
+				rcCopy.forbiddenRepos = repos
+			} else if d.Key == "allow_repo" {
+				name := strings.TrimPrefix(strings.TrimSpace(d.Value), "@")
+				if name == "" {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:allow_repo repo_name", d.Value)
+					continue
+				}
+				repos := make(map[string]bool)
+				for k := range rcCopy.allowedRepos {
+					repos[k] = true
+				}
+				repos[name] = true
+				rcCopy.allowedRepos = repos
+			} else if d.Key == "resolver_for_kind" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:resolver_for_kind kind resolver_name", d.Value)
+					continue
+				}
+				resolvers := make(map[string]string)
+				for k, v := range rcCopy.kindResolvers {
+					resolvers[k] = v
+				}
+				resolvers[parts[0]] = parts[1]
+				rcCopy.kindResolvers = resolvers
+			} else if d.Key == "cross_resolve_timeout" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:cross_resolve_timeout import-pattern duration", d.Value)
+					continue
+				}
+				timeout, err := time.ParseDuration(parts[1])
+				if err != nil {
+					log.Printf("gazelle:cross_resolve_timeout %s: %v", d.Value, err)
+					continue
+				}
+				it := importTimeout{prefix: parts[0], timeout: timeout}
+				if it.prefix == "..." {
+					it.prefix = ""
+					it.wildcard = true
+				} else if strings.HasSuffix(it.prefix, "/...") {
+					it.prefix = strings.TrimSuffix(it.prefix, "/...")
+					it.wildcard = true
+				}
+				rcCopy.importTimeouts = append(rcCopy.importTimeouts[:len(rcCopy.importTimeouts):len(rcCopy.importTimeouts)], it)
+			} else if d.Key == "layer" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:layer name level", d.Value)
+					continue
+				}
+				level, err := strconv.Atoi(parts[1])
+				if err != nil {
+					log.Printf("gazelle:layer %s: invalid level: %v", d.Value, err)
+					continue
+				}
+				rcCopy.layers.add(rel, layer{name: parts[0], level: level})
+			} else if d.Key == "default_dep" {
+				parts := strings.Fields(d.Value)
+				if len(parts) != 2 {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:default_dep kind label", d.Value)
+					continue
+				}
+				l, err := label.Parse(parts[1])
+				if err != nil {
+					log.Printf("gazelle:default_dep %s: %v", d.Value, err)
+					continue
+				}
+				deps := make(map[string][]label.Label)
+				for k, v := range rcCopy.defaultDeps {
+					deps[k] = v
+				}
+				kindDeps := deps[parts[0]]
+				deps[parts[0]] = append(kindDeps[:len(kindDeps):len(kindDeps)], l.Abs("", rel))
+				rcCopy.defaultDeps = deps
+			} else if d.Key == "rule_override_attr" {
+				rcCopy.ruleOverrideAttr = strings.TrimSpace(d.Value)
+			} else if d.Key == "alias_resolution" {
+				switch v := strings.TrimSpace(d.Value); v {
+				case "alias":
+					rcCopy.aliasesToActual = false
+				case "actual":
+					rcCopy.aliasesToActual = true
+				default:
+					log.Printf("could not parse directive: %s\n\texpected gazelle:alias_resolution alias|actual", d.Value)
+				}
+			} else if d.Key == "source_root" {
+				rcCopy.sourceRoot = rel
+			} else if d.Key == "umbrella" {
+				parts := strings.Fields(d.Value)
+				if len(parts) < 3 || parts[1] != "provides" {
+					log.Printf("could not parse directive: %s\n\texpected gazelle:umbrella label provides label...", d.Value)
+					continue
+				}
+				var u umbrella
+				labels := append([]string{parts[0]}, parts[2:]...)
+				for i, s := range labels {
+					l, err := label.Parse(s)
+					if err != nil {
+						log.Printf("gazelle:umbrella %s: %v", d.Value, err)
+						labels = nil
+						break
+					}
+					l = l.Abs("", rel)
+					if i == 0 {
+						u.label = l
+					} else {
+						u.members = append(u.members, l)
+					}
+				}
+				if labels == nil {
+					continue
+				}
+				rcCopy.umbrellas = append(rcCopy.umbrellas[:len(rcCopy.umbrellas):len(rcCopy.umbrellas)], u)
 			}
 		}
 	}
 
-	c.Exts[resolveName] = rcCopy
+	if f != nil && len(f.Directives) > 0 {
+		rcCopy.cacheKey = directivesCacheKey(rc.cacheKey, f.Directives)
+	}
+
+	c.Exts[resolveName] = &rcCopy
 }
@@ -0,0 +1,339 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestFindRuleWithWildcardOverride(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve go example.com/a/... //a:all
+# gazelle:resolve go example.com/a/b/... //a/b:all
+# gazelle:resolve go example.com/exact //:exact
+# gazelle:resolve go ... //:everything_go
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	for _, tc := range []struct {
+		imp, want string
+	}{
+		{imp: "example.com/a", want: "//a:all"},
+		{imp: "example.com/a/x", want: "//a:all"},
+		{imp: "example.com/a/b", want: "//a/b:all"},
+		{imp: "example.com/a/b/c", want: "//a/b:all"},
+		{imp: "example.com/ab", want: "//:everything_go"},
+		{imp: "example.com/exact", want: "//:everything_go"},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			l, ok := FindRuleWithWildcardOverride(c, ImportSpec{Lang: "go", Imp: tc.imp}, "go")
+			if !ok {
+				t.Fatalf("no override found for %q", tc.imp)
+			}
+			if got := l.String(); got != tc.want {
+				t.Errorf("got %s; want %s", got, tc.want)
+			}
+		})
+	}
+
+	if l, ok := FindRuleWithOverride(c, ImportSpec{Lang: "go", Imp: "example.com/a/x"}, "go"); ok {
+		t.Errorf("FindRuleWithOverride: wildcard directive matched; got %s", l)
+	}
+	if l, ok := FindRuleWithOverride(c, ImportSpec{Lang: "go", Imp: "example.com/exact"}, "go"); !ok || l != label.New("", "", "exact") {
+		t.Errorf("FindRuleWithOverride: got %s, %v; want //:exact, true", l, ok)
+	}
+	if l, ok := FindRuleWithWildcardOverride(c, ImportSpec{Lang: "proto", Imp: "example.com/a"}, "go"); ok {
+		t.Errorf("wildcard matched import in different language; got %s", l)
+	}
+}
+
+func TestResolveAlias(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve_alias go example.com/p example.com/q
+# gazelle:resolve_alias go example.com/q example.com/r
+# gazelle:resolve go example.com/r //real:target
+# gazelle:resolve_alias go example.com/loop1 example.com/loop2
+# gazelle:resolve_alias go example.com/loop2 example.com/loop1
+# gazelle:resolve_alias go example.com/dangling example.com/missing
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	for _, imp := range []string{"example.com/p", "example.com/q", "example.com/r"} {
+		l, ok, err := FindRuleWithOverrideChain(c, ImportSpec{Lang: "go", Imp: imp}, "go")
+		if err != nil || !ok || l.String() != "//real:target" {
+			t.Errorf("%s: got %s, %v, %v; want //real:target, true, nil", imp, l, ok, err)
+		}
+	}
+
+	if l, ok, err := FindRuleWithOverrideChain(c, ImportSpec{Lang: "go", Imp: "example.com/dangling"}, "go"); ok || err != nil {
+		t.Errorf("dangling alias: got %s, %v, %v; want no override and no error", l, ok, err)
+	}
+
+	_, ok, err := FindRuleWithOverrideChain(c, ImportSpec{Lang: "go", Imp: "example.com/loop1"}, "go")
+	if ok || err == nil {
+		t.Fatalf("cycle: got %v, %v; want an error", ok, err)
+	}
+	if want := "example.com/loop1 -> example.com/loop2 -> example.com/loop1"; !strings.Contains(err.Error(), want) {
+		t.Errorf("cycle: error %q does not contain %q", err, want)
+	}
+	if l, ok := FindRuleWithOverride(c, ImportSpec{Lang: "go", Imp: "example.com/loop1"}, "go"); ok {
+		t.Errorf("FindRuleWithOverride with cycle: got %s; want no override", l)
+	}
+}
+
+func TestResolveAny(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve_any test moved //new:foo //old:foo
+# gazelle:resolve_any test migrated //new:bar //old:bar
+# gazelle:resolve_any test crossed //new:baz @ext//:baz //old:baz
+# gazelle:resolve_any test unknown //new:qux //old:qux
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	rslv := &testResolver{name: "test"}
+	ix := NewRuleIndex(kindResolver(rslv), &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "crossed"}: label.New("ext", "", "baz"),
+	}})
+	addTestFiles(t, c, ix, []testFile{
+		{rel: "old", content: `
+test_library(
+    name = "foo",
+    provides = ["old/foo"],
+)
+
+test_library(
+    name = "bar",
+    provides = ["old/bar"],
+)
+`},
+		{rel: "new", content: `
+test_library(
+    name = "bar",
+    provides = ["new/bar"],
+)
+`},
+	})
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp, want string
+	}{
+		{imp: "moved", want: "//old:foo"},
+		{imp: "migrated", want: "//new:bar"},
+		{imp: "crossed", want: "@ext//:baz"},
+		{imp: "unknown", want: "//old:qux"},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			l, ok := ix.FindRuleWithOverride(c, ImportSpec{Lang: "test", Imp: tc.imp}, "test")
+			if !ok || l.String() != tc.want {
+				t.Errorf("got %s, %v; want %s, true", l, ok, tc.want)
+			}
+		})
+	}
+
+	if l, ok := FindRuleWithOverride(c, ImportSpec{Lang: "test", Imp: "migrated"}, "test"); !ok || l.String() != "//old:bar" {
+		t.Errorf("without index: got %s, %v; want //old:bar, true", l, ok)
+	}
+}
+
+func TestDeprecateImport(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:deprecate_import test old/path new/path
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+	sub := c.Clone()
+	cr.Configure(sub, "sub", nil)
+
+	ix := buildTestIndex(t, c, []testFile{{rel: "new", content: `
+test_library(
+    name = "new",
+    provides = ["new/path"],
+)
+`}}, &testResolver{name: "test"})
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	for _, cfg := range []*config.Config{c, sub} {
+		imp := ReplaceDeprecatedImport(cfg, ImportSpec{Lang: "test", Imp: "old/path"})
+		if want := (ImportSpec{Lang: "test", Imp: "new/path"}); imp != want {
+			t.Fatalf("got %v; want %v", imp, want)
+		}
+		results := ix.FindRulesByImportWithConfig(cfg, imp, "test")
+		if got, want := resultLabels(results), []string{"//new"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v; want %v", got, want)
+		}
+	}
+	if imp := ReplaceDeprecatedImport(c, ImportSpec{Lang: "test", Imp: "new/path"}); imp.Imp != "new/path" {
+		t.Errorf("replacement import: got %q; want unchanged", imp.Imp)
+	}
+
+	if n := strings.Count(logBuf.String(), "is deprecated"); n != 1 {
+		t.Errorf("got %d warnings; want 1:\n%s", n, logBuf.String())
+	}
+	if want := `test import "old/path" is deprecated; use "new/path" instead`; !strings.Contains(logBuf.String(), want) {
+		t.Errorf("log %q does not contain %q", logBuf.String(), want)
+	}
+}
+
+func TestImportRewrite(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:import_rewrite \+build\.[0-9a-f]+$
+# gazelle:import_rewrite ^gen/v[0-9]+/ gen/
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "gen",
+		content: `
+test_library(
+    name = "gen",
+    provides = ["gen/v2/api+build.1a2b3c"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	if got, want := RewriteImport(c, ImportSpec{Lang: "test", Imp: "gen/v2/api+build.1a2b3c"}).Imp, "gen/api"; got != want {
+		t.Errorf("RewriteImport: got %q; want %q", got, want)
+	}
+	for _, imp := range []string{"gen/v2/api+build.1a2b3c", "gen/v3/api+build.ffff", "gen/api"} {
+		results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: imp}, "test")
+		if got, want := resultLabels(results), []string{"//gen"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v; want %v", imp, got, want)
+		}
+	}
+	if got := ix.UnambiguousImports(); !reflect.DeepEqual(got, []ImportSpec{{Lang: "test", Imp: "gen/api"}}) {
+		t.Errorf("indexed imports: got %v; want only the rewritten import", got)
+	}
+}
+
+func TestResolveTemplate(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve_template go toolchains/(?P<name>[a-z_]+) @my_toolchains//:resolved_{name}
+# gazelle:resolve_template go tools/([a-z]+)/([a-z]+) //tools/{1}:{2}_lib
+# gazelle:resolve go toolchains/exact //exact:toolchain
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	for _, tc := range []struct {
+		imp, want string
+	}{
+		{imp: "toolchains/cc", want: "@my_toolchains//:resolved_cc"},
+		{imp: "toolchains/go_sdk", want: "@my_toolchains//:resolved_go_sdk"},
+		{imp: "tools/lint/check", want: "//tools/lint:check_lib"},
+		{imp: "toolchains/exact", want: "//exact:toolchain"},
+		{imp: "toolchains/cc/sub", want: ""},
+		{imp: "other/toolchains/cc", want: ""},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			l, ok := FindRuleWithOverride(c, ImportSpec{Lang: "go", Imp: tc.imp}, "go")
+			if tc.want == "" {
+				if ok {
+					t.Errorf("got %s; want no override", l)
+				}
+				return
+			}
+			if !ok || l.String() != tc.want {
+				t.Errorf("got %s, %v; want %s, true", l, ok, tc.want)
+			}
+		})
+	}
+
+	if _, ok := FindRuleWithOverride(c, ImportSpec{Lang: "proto", Imp: "toolchains/cc"}, "proto"); ok {
+		t.Errorf("template for go should not apply to proto imports")
+	}
+}
+
+func TestOverridesInSiblingDirectories(t *testing.T) {
+	c := testConfig(t)
+	cr := &Configurer{}
+	root, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve go example.com/x //:x
+# gazelle:resolve go example.com/y //:y
+# gazelle:resolve go example.com/z //:z
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.Configure(c, "", root)
+
+	// Each sibling's overrides must be appended to its own copy of the
+	// parent's list, even if the parent's list has spare capacity.
+	siblings := map[string]*config.Config{}
+	for _, rel := range []string{"a", "b"} {
+		f, err := rule.LoadData(rel+"/BUILD.bazel", rel, []byte(`
+# gazelle:resolve go example.com/shared //`+rel+`:shared
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := c.Clone()
+		cr.Configure(sc, rel, f)
+		siblings[rel] = sc
+	}
+
+	for rel, sc := range siblings {
+		if l, ok := FindRuleWithOverride(sc, ImportSpec{Lang: "go", Imp: "example.com/shared"}, "go"); !ok || l != label.New("", rel, "shared") {
+			t.Errorf("%s: got %s, %v; want //%s:shared, true", rel, l, ok, rel)
+		}
+		if l, ok := FindRuleWithOverride(sc, ImportSpec{Lang: "go", Imp: "example.com/z"}, "go"); !ok || l != label.New("", "", "z") {
+			t.Errorf("%s: got %s, %v; want //:z, true", rel, l, ok)
+		}
+	}
+	if l, ok := FindRuleWithOverride(c, ImportSpec{Lang: "go", Imp: "example.com/shared"}, "go"); ok {
+		t.Errorf("root: got %s; want no override", l)
+	}
+}
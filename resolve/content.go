@@ -0,0 +1,57 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "github.com/bazelbuild/bazel-gazelle/rule"
+
+// ContentKeyer is an optional interface that a Resolver may implement when
+// several rules may be copies of the same library, for example, when one
+// library is vendored in several places. Rules with the same non-empty
+// content key are interchangeable, so when several of them provide an
+// import, lookups only return the representative with the label that sorts
+// first, and the import isn't ambiguous.
+type ContentKeyer interface {
+	// ContentKey returns a string that identifies the content of r, like
+	// a hash of its sources, or "" if r shouldn't be grouped with others.
+	ContentKey(r *rule.Rule) string
+}
+
+// dedupByContentKey returns matches with only the representative of each
+// group of records with the same content key. A representative takes the
+// position of the first record in its group.
+func dedupByContentKey(matches []*ruleRecord) []*ruleRecord {
+	if len(matches) < 2 {
+		return matches
+	}
+	reps := make(map[string]int)
+	var deduped []*ruleRecord
+	for _, m := range matches {
+		if m.contentKey == "" {
+			deduped = append(deduped, m)
+			continue
+		}
+		i, ok := reps[m.contentKey]
+		if !ok {
+			reps[m.contentKey] = len(deduped)
+			deduped = append(deduped, m)
+			continue
+		}
+		if m.label.String() < deduped[i].label.String() {
+			deduped[i] = m
+		}
+	}
+	return deduped
+}
@@ -0,0 +1,78 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+type contentKeyResolver struct {
+	testResolver
+}
+
+func (*contentKeyResolver) ContentKey(r *rule.Rule) string {
+	return r.AttrString("content")
+}
+
+func TestContentKey(t *testing.T) {
+	c := testConfig(t)
+	content := `
+test_library(
+    name = "lib",
+    provides = ["example.com/lib"],
+    content = "v1",
+)
+`
+	ix := buildTestIndex(t, c, []testFile{
+		{rel: "vendor_b/lib", content: content},
+		{rel: "vendor_a/lib", content: content},
+		{rel: "fork/lib", content: `
+test_library(
+    name = "lib",
+    provides = ["example.com/lib"],
+    content = "v2",
+)
+`},
+		{rel: "plain/lib", content: `
+test_library(
+    name = "lib",
+    provides = ["example.com/plain"],
+)
+`},
+		{rel: "plain/lib2", content: `
+test_library(
+    name = "lib2",
+    provides = ["example.com/plain"],
+)
+`},
+	}, &contentKeyResolver{testResolver{name: "test"}})
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "example.com/lib", want: []string{"//vendor_a/lib", "//fork/lib"}},
+		{imp: "example.com/plain", want: []string{"//plain/lib", "//plain/lib2"}},
+	} {
+		got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// DepsCount is the number of dependencies in a package that were generated
+// by Gazelle and that were kept from manually written build files with
+// "# keep" comments.
+type DepsCount struct {
+	Generated, Kept int
+}
+
+// RecordDepsCoverage counts the dependencies in the "deps" attribute of r,
+// a rule in the package pkg, after resolved attributes have been merged into
+// its build file. Dependencies with "# keep" comments, and all dependencies
+// of rules with "# keep" comments, are counted as kept. Other dependencies
+// are counted as generated. Gazelle calls RecordDepsCoverage for each
+// generated rule. Counts are available through DepsCoverage.
+func RecordDepsCoverage(c *config.Config, r *rule.Rule, pkg string) {
+	coverage := getResolveConfig(c).coverage
+	if coverage == nil {
+		return
+	}
+	expr := r.Attr("deps")
+	if expr == nil {
+		return
+	}
+	count := coverage[pkg]
+	if count == nil {
+		count = &DepsCount{}
+		coverage[pkg] = count
+	}
+	keepAll := r.ShouldKeep()
+	bzl.Walk(expr, func(x bzl.Expr, stk []bzl.Expr) {
+		if _, ok := x.(*bzl.StringExpr); !ok {
+			return
+		}
+		if len(stk) > 0 {
+			if kv, ok := stk[len(stk)-1].(*bzl.KeyValueExpr); ok && kv.Key == x {
+				// Skip select conditions.
+				return
+			}
+		}
+		if keepAll || rule.ShouldKeep(x) {
+			count.Kept++
+		} else {
+			count.Generated++
+		}
+	})
+}
+
+// DepsCoverage returns the counts of generated and kept dependencies
+// recorded with RecordDepsCoverage, keyed by package. Packages where no
+// rule has dependencies are not included.
+func DepsCoverage(c *config.Config) map[string]DepsCount {
+	coverage := make(map[string]DepsCount)
+	for pkg, count := range getResolveConfig(c).coverage {
+		coverage[pkg] = *count
+	}
+	return coverage
+}
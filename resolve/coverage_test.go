@@ -0,0 +1,85 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDepsCoverage(t *testing.T) {
+	c := testConfig(t)
+	files := loadTestFiles(t, []testFile{
+		{
+			rel: "a",
+			content: `
+test_library(
+    name = "a",
+    deps = [
+        "//gen:one",
+        "//gen:two",
+        "//manual:three",  # keep
+    ] + select({
+        "@io_bazel_rules_go//go/platform:linux": [
+            "//gen:linux",
+        ],
+        "//conditions:default": [],
+    }),
+)
+
+test_library(
+    name = "b",
+    deps = ["//gen:one"],
+)
+`,
+		}, {
+			rel: "b",
+			content: `
+# keep
+test_library(
+    name = "kept",
+    deps = ["//gen:one", "//gen:two"],
+)
+
+test_library(
+    name = "no_deps",
+)
+`,
+		}, {
+			rel: "c",
+			content: `
+test_library(
+    name = "no_deps",
+)
+`,
+		},
+	})
+	for _, f := range files {
+		dc := c.Clone()
+		for _, r := range f.Rules {
+			RecordDepsCoverage(dc, r, f.Pkg)
+		}
+	}
+
+	got := DepsCoverage(c)
+	want := map[string]DepsCount{
+		"a": {Generated: 4, Kept: 1},
+		"b": {Kept: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
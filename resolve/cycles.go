@@ -0,0 +1,249 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// DetectCycles finds cycles in the dependency graph described by edges,
+// which maps each label to the labels it depends on. Labels should be
+// absolute. One cycle is returned for each strongly connected component of
+// the graph that contains a cycle. Each cycle is a path that starts at the
+// label in the component that sorts first, and the last label in the path
+// depends on the first. Cycles are sorted by their first labels.
+// DetectCycles returns nil if the graph is acyclic.
+func DetectCycles(edges map[label.Label][]label.Label) [][]label.Label {
+	nodes := make([]label.Label, 0, len(edges))
+	for l := range edges {
+		nodes = append(nodes, l)
+	}
+	sortLabels(nodes)
+	succs := func(l label.Label) []label.Label {
+		s := append([]label.Label(nil), edges[l]...)
+		sortLabels(s)
+		return s
+	}
+
+	var cycles [][]label.Label
+	for _, component := range stronglyConnectedComponents(nodes, succs) {
+		inComponent := make(map[label.Label]bool, len(component))
+		for _, l := range component {
+			inComponent[l] = true
+		}
+		sortLabels(component)
+		start := component[0]
+		if len(component) == 1 && !dependsOn(edges[start], start) {
+			continue
+		}
+		cycles = append(cycles, findCycle(start, succs, inComponent))
+	}
+	sortCycles(cycles)
+	return cycles
+}
+
+// stronglyConnectedComponents returns the strongly connected components of
+// the graph with the given nodes and successor function, computed with
+// Tarjan's algorithm. Every component is returned, including components
+// with a single node. Nodes are visited in the order given.
+func stronglyConnectedComponents(nodes []label.Label, succs func(label.Label) []label.Label) [][]label.Label {
+	index := make(map[label.Label]int)
+	lowlink := make(map[label.Label]int)
+	onStack := make(map[label.Label]bool)
+	var stack []label.Label
+	var components [][]label.Label
+	var visit func(l label.Label)
+	visit = func(l label.Label) {
+		index[l] = len(index)
+		lowlink[l] = index[l]
+		stack = append(stack, l)
+		onStack[l] = true
+		for _, s := range succs(l) {
+			if _, ok := index[s]; !ok {
+				visit(s)
+				if lowlink[s] < lowlink[l] {
+					lowlink[l] = lowlink[s]
+				}
+			} else if onStack[s] && index[s] < lowlink[l] {
+				lowlink[l] = index[s]
+			}
+		}
+		if lowlink[l] != index[l] {
+			return
+		}
+		var component []label.Label
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			component = append(component, n)
+			if n == l {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, l := range nodes {
+		if _, ok := index[l]; !ok {
+			visit(l)
+		}
+	}
+	return components
+}
+
+// findCycle returns a path from start back to start through labels in
+// component, not including the final start. start must be in a strongly
+// connected component with a cycle.
+func findCycle(start label.Label, succs func(label.Label) []label.Label, component map[label.Label]bool) []label.Label {
+	visited := make(map[label.Label]bool)
+	var path []label.Label
+	var search func(l label.Label) bool
+	search = func(l label.Label) bool {
+		visited[l] = true
+		path = append(path, l)
+		for _, s := range succs(l) {
+			if s == start {
+				return true
+			}
+			if component[s] && !visited[s] && search(s) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	search(start)
+	return path
+}
+
+func dependsOn(deps []label.Label, l label.Label) bool {
+	for _, d := range deps {
+		if d == l {
+			return true
+		}
+	}
+	return false
+}
+
+func sortCycles(cycles [][]label.Label) {
+	firsts := make([]label.Label, len(cycles))
+	byFirst := make(map[label.Label][]label.Label, len(cycles))
+	for i, c := range cycles {
+		firsts[i] = c[0]
+		byFirst[c[0]] = c
+	}
+	sortLabels(firsts)
+	for i, l := range firsts {
+		cycles[i] = byFirst[l]
+	}
+}
+
+// EmbedSCCs returns the strongly connected components of the embed graph,
+// in which each indexed rule has an edge to each indexed rule it embeds
+// directly, as reported by Resolver.Embeds. Only components with more than
+// one rule are returned, so an empty result means the embed graph is
+// acyclic. Labels within each component are sorted, and components are
+// sorted by their first labels.
+//
+// EmbedSCCs may only be called after Finish.
+func (ix *RuleIndex) EmbedSCCs() [][]label.Label {
+	nodes := make([]label.Label, 0, len(ix.rules))
+	for _, r := range ix.rules {
+		nodes = append(nodes, r.label)
+	}
+	sortLabels(nodes)
+	succs := func(l label.Label) []label.Label {
+		r := ix.labelMap[l]
+		if r.aliasActuals != nil {
+			return nil
+		}
+		rslv := ix.mrslv(r.rule, r.file.Pkg)
+		if rslv == nil {
+			return nil
+		}
+		var embeds []label.Label
+		for _, e := range rslv.Embeds(r.rule, r.label) {
+			if er, ok := ix.findRuleByLabel(e, r.label); ok {
+				embeds = append(embeds, er.label)
+			}
+		}
+		sortLabels(embeds)
+		return embeds
+	}
+	var sccs [][]label.Label
+	for _, component := range stronglyConnectedComponents(nodes, succs) {
+		if len(component) > 1 {
+			sortLabels(component)
+			sccs = append(sccs, component)
+		}
+	}
+	sortCycles(sccs)
+	return sccs
+}
+
+// ResolvedDepEdges returns the dependency graph recorded with
+// RecordResolvedDeps, as a map from each rule to the labels it depends on.
+// It's suitable for DetectCycles. Like ProviderInDegree, the graph is only
+// complete after a resolve pass in which RecordResolvedDeps was called for
+// every rule.
+func (ix *RuleIndex) ResolvedDepEdges() map[label.Label][]label.Label {
+	edges := make(map[label.Label][]label.Label)
+	for dep, froms := range ix.importers {
+		for from := range froms {
+			edges[from] = append(edges[from], dep)
+		}
+	}
+	for _, deps := range edges {
+		sortLabels(deps)
+	}
+	return edges
+}
+
+// CheckDepCycles reports cycles in the dependency graph recorded in ix with
+// RecordResolvedDeps, when -check_dep_cycles is set. Gazelle calls it after
+// all rules have been resolved. Cycles are logged as warnings; in
+// -strict_resolve mode, an error naming each cycle's path is returned
+// instead.
+func CheckDepCycles(c *config.Config, ix *RuleIndex) error {
+	rc := getResolveConfig(c)
+	if !rc.checkDepCycles {
+		return nil
+	}
+	cycles := DetectCycles(ix.ResolvedDepEdges())
+	if len(cycles) == 0 {
+		return nil
+	}
+	paths := make([]string, len(cycles))
+	for i, cycle := range cycles {
+		strs := make([]string, 0, len(cycle)+1)
+		for _, l := range cycle {
+			strs = append(strs, l.String())
+		}
+		strs = append(strs, cycle[0].String())
+		paths[i] = strings.Join(strs, " -> ")
+	}
+	err := fmt.Errorf("resolved dependencies form cycles: %s", strings.Join(paths, "; "))
+	if rc.strict {
+		return err
+	}
+	log.Printf("warning: %v", err)
+	return nil
+}
@@ -0,0 +1,173 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestDetectCycles(t *testing.T) {
+	l := func(s string) label.Label {
+		lbl, err := label.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lbl
+	}
+	ls := func(strs ...string) []label.Label {
+		var labels []label.Label
+		for _, s := range strs {
+			labels = append(labels, l(s))
+		}
+		return labels
+	}
+
+	for _, tc := range []struct {
+		desc  string
+		edges map[label.Label][]label.Label
+		want  [][]string
+	}{
+		{
+			desc: "dag",
+			edges: map[label.Label][]label.Label{
+				l("//a"): ls("//b", "//c"),
+				l("//b"): ls("//c"),
+				l("//c"): ls("@ext//:lib"),
+			},
+		}, {
+			desc: "three",
+			edges: map[label.Label][]label.Label{
+				l("//b"): ls("//c"),
+				l("//c"): ls("//a", "//d"),
+				l("//a"): ls("//b"),
+			},
+			want: [][]string{{"//a", "//b", "//c"}},
+		}, {
+			desc: "two_cycles",
+			edges: map[label.Label][]label.Label{
+				l("//x"): ls("//y"),
+				l("//y"): ls("//x", "//a"),
+				l("//a"): ls("//b"),
+				l("//b"): ls("//a"),
+			},
+			want: [][]string{{"//a", "//b"}, {"//x", "//y"}},
+		}, {
+			desc: "self",
+			edges: map[label.Label][]label.Label{
+				l("//a"): ls("//a"),
+			},
+			want: [][]string{{"//a"}},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got [][]string
+			for _, cycle := range DetectCycles(tc.edges) {
+				got = append(got, labelStrings(cycle))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckDepCycles(t *testing.T) {
+	ix := NewRuleIndex(kindResolver())
+	ix.Finish()
+	ix.RecordResolvedDeps(label.New("", "a", "a"), []label.Label{label.New("", "b", "b")})
+	ix.RecordResolvedDeps(label.New("", "b", "b"), []label.Label{label.New("", "c", "c")})
+	ix.RecordResolvedDeps(label.New("", "c", "c"), []label.Label{label.New("", "a", "a")})
+
+	if err := CheckDepCycles(testConfig(t), ix); err != nil {
+		t.Errorf("without -check_dep_cycles: got error %v", err)
+	}
+	err := CheckDepCycles(testConfig(t, "-check_dep_cycles", "-strict_resolve"), ix)
+	want := "resolved dependencies form cycles: //a -> //b -> //c -> //a"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v; want %q", err, want)
+	}
+}
+
+func TestEmbedSCCs(t *testing.T) {
+	c := testConfig(t)
+	for _, tc := range []struct {
+		desc, content string
+		want          [][]string
+	}{
+		{
+			desc: "acyclic",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    embed = [":b", ":c"],
+)
+
+test_library(
+    name = "b",
+    embed = [":c"],
+)
+
+test_library(
+    name = "c",
+    provides = ["c"],
+)
+`,
+		}, {
+			desc: "cycle",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    embed = [":b"],
+)
+
+test_library(
+    name = "b",
+    provides = ["b"],
+    embed = [":c"],
+)
+
+test_library(
+    name = "c",
+    provides = ["c"],
+    embed = [":a"],
+)
+
+test_library(
+    name = "d",
+    provides = ["d"],
+    embed = [":a"],
+)
+`,
+			want: [][]string{{"//pkg:a", "//pkg:b", "//pkg:c"}},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ix := buildTestIndex(t, c, []testFile{{rel: "pkg", content: tc.content}}, &testResolver{name: "test"})
+			var got [][]string
+			for _, scc := range ix.EmbedSCCs() {
+				got = append(got, labelStrings(scc))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// CheckDeps inspects the dependencies of r after Resolver.Resolve has been
+// called. from is the label of r. Gazelle calls CheckDeps for each generated
+// rule before merging resolved attributes into build files.
+//
+// If r has more dependencies than allowed by -max_deps, a warning is logged.
+// In -strict_resolve mode, an error is returned instead.
+func CheckDeps(c *config.Config, r *rule.Rule, from label.Label) error {
+	rc := getResolveConfig(c)
+	if rc.maxDeps <= 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, dep := range attrLabelStrings(r, "deps") {
+		seen[dep] = true
+	}
+	if len(seen) <= rc.maxDeps {
+		return nil
+	}
+	err := fmt.Errorf("%s: rule has %d dependencies, which exceeds the limit of %d set with -max_deps", from, len(seen), rc.maxDeps)
+	if rc.strict {
+		return err
+	}
+	log.Printf("warning: %v", err)
+	return nil
+}
+
+// CheckForbiddenRepo returns an error if dep, the label imp was resolved to,
+// is in a repository named with a forbidden_repo directive, or if dep is
+// outside the main repository and -first_party_only is set. If allow_repo
+// directives apply to the current directory, an error is also returned if
+// dep is in an external repository they don't name. Resolvers should call
+// CheckForbiddenRepo for each resolved import and omit dependencies that
+// fail the check.
+func CheckForbiddenRepo(c *config.Config, imp ImportSpec, dep label.Label) error {
+	if isFirstParty(c, dep) {
+		return nil
+	}
+	if getResolveConfig(c).firstPartyOnly {
+		return fmt.Errorf("import %q resolved to %s, but only rules in the main repository may be used with -first_party_only", imp.Imp, dep)
+	}
+	rc := getResolveConfig(c)
+	if rc.forbiddenRepos[dep.Repo] {
+		return fmt.Errorf("import %q resolved to %s, but repository %q is forbidden by # gazelle:forbidden_repo", imp.Imp, dep, dep.Repo)
+	}
+	if rc.allowedRepos != nil && !rc.allowedRepos[dep.Repo] {
+		return fmt.Errorf("import %q resolved to %s, but repository %q is not allowed by # gazelle:allow_repo in this directory", imp.Imp, dep, dep.Repo)
+	}
+	return nil
+}
+
+// AddDefaultDeps adds the dependencies declared for the kind of r with
+// default_dep directives to the "deps" attribute of r, which should already
+// have been resolved. from is the label of r. Dependencies that are already
+// listed are not added again, and the list is sorted. If "deps" is set to
+// something other than a list of strings, for example, a select expression,
+// it is not modified.
+func AddDefaultDeps(c *config.Config, r *rule.Rule, from label.Label) {
+	defaults := getResolveConfig(c).defaultDeps[r.Kind()]
+	if len(defaults) == 0 {
+		return
+	}
+	var deps []string
+	if r.Attr("deps") != nil {
+		if _, ok := r.Attr("deps").(*bzl.ListExpr); !ok {
+			return
+		}
+		deps = r.AttrStrings("deps")
+	}
+	seen := make(map[label.Label]bool)
+	for _, s := range deps {
+		if l, err := label.Parse(s); err == nil {
+			seen[l.Abs(from.Repo, from.Pkg)] = true
+		}
+	}
+	added := false
+	for _, l := range defaults {
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		deps = append(deps, l.Rel(from.Repo, from.Pkg).String())
+		added = true
+	}
+	if added {
+		sort.Strings(deps)
+		r.SetAttr("deps", deps)
+	}
+}
+
+// isFirstParty returns whether l is a label in the main repository.
+func isFirstParty(c *config.Config, l label.Label) bool {
+	return l.Repo == "" || l.Repo == c.RepoName
+}
+
+// DepsFormatter is an optional interface that a Resolver may implement to
+// control how lists of dependencies are written, for example, to group
+// dependencies into sections separated by comments.
+type DepsFormatter interface {
+	// FormatDeps sets the attribute attr of r to an expression listing deps.
+	// deps are absolute labels in the order they appeared. from is the label
+	// of r. Implementations have full control over the expression, and may
+	// use rule.Rule.SetAttr with a build.Expr value.
+	FormatDeps(r *rule.Rule, attr string, deps []label.Label, from label.Label)
+}
+
+// FormatDeps calls rslv's FormatDeps method for each dependency attribute of
+// r, if rslv implements DepsFormatter. from is the label of r. Gazelle calls
+// FormatDeps after all other processing of resolved dependencies.
+//
+// The "deps" attribute and attributes named with dep_category_attr are
+// formatted. Only attributes with plain lists of strings are formatted;
+// attributes with select expressions are left alone.
+func FormatDeps(c *config.Config, rslv Resolver, r *rule.Rule, from label.Label) {
+	df, ok := rslv.(DepsFormatter)
+	if !ok {
+		return
+	}
+	attrs := map[string]bool{DefaultDepCategory: true}
+	for _, attr := range getResolveConfig(c).categoryAttrs {
+		attrs[attr] = true
+	}
+	for _, attr := range r.AttrKeys() {
+		if !attrs[attr] {
+			continue
+		}
+		list, ok := r.Attr(attr).(*bzl.ListExpr)
+		if !ok {
+			continue
+		}
+		deps := make([]label.Label, 0, len(list.List))
+		for _, e := range list.List {
+			s, ok := e.(*bzl.StringExpr)
+			if !ok {
+				deps = nil
+				break
+			}
+			l, err := label.Parse(s.Value)
+			if err != nil {
+				deps = nil
+				break
+			}
+			deps = append(deps, l.Abs(from.Repo, from.Pkg))
+		}
+		if deps == nil {
+			continue
+		}
+		df.FormatDeps(r, attr, deps, from)
+	}
+}
+
+// UnresolvedImportError describes an import that could not be resolved to
+// a dependency.
+type UnresolvedImportError struct {
+	// From is the label of the rule with the import.
+	From label.Label
+
+	// Imp is the import that could not be resolved.
+	Imp ImportSpec
+
+	// Err describes why Imp could not be resolved.
+	Err error
+
+	// Suggestions is a list of known imports similar to Imp, which may be
+	// what the user meant. See RuleIndex.SuggestImport.
+	Suggestions []ImportSpec
+
+	// DocLink is a link to documentation about Imp, returned by the
+	// resolver's DocLinker implementation, or "" if there is none.
+	DocLink string
+}
+
+func (e *UnresolvedImportError) Error() string {
+	return fmt.Sprintf("%s: import %q: %v%s%s", e.From, e.Imp.Imp, e.Err, suggestionText(e.Suggestions), docLinkText(e.DocLink))
+}
+
+const unresolvedName = "_resolve_unresolved"
+
+// ReportUnresolved should be called by a Resolver when imp, an import of the
+// rule with label from, can't be resolved. c should be the configuration
+// passed to Resolve. err describes the problem.
+//
+// Normally, err is logged. In -strict_resolve mode, an
+// UnresolvedImportError is recorded in c instead. Gazelle collects recorded
+// errors with TakeUnresolved after each rule is resolved.
+//
+// In -strict_resolve_fail_fast mode, ReportUnresolved returns
+// ErrStopResolving after recording the error. Resolvers should stop
+// resolving the rule without resolving its remaining imports. ResolverV2
+// implementations may return the error from ResolveV2. Otherwise,
+// ReportUnresolved returns nil.
+func ReportUnresolved(c *config.Config, from label.Label, imp ImportSpec, err error) error {
+	return reportUnresolved(c, &UnresolvedImportError{From: from, Imp: imp, Err: err})
+}
+
+// ErrStopResolving is returned by ReportUnresolved when Gazelle will stop
+// at the first unresolved import, as set with -strict_resolve_fail_fast.
+var ErrStopResolving = errors.New("stopped resolving at the first unresolved import")
+
+// ReportUnresolved is like the ReportUnresolved function, but the report
+// includes suggestions for known imports similar to imp, found with
+// SuggestImport. lang is the name of the resolver that imp was looked up
+// for. If that resolver implements DocLinker and was passed to
+// NewRuleIndex, the report also includes a link to documentation about imp.
+func (ix *RuleIndex) ReportUnresolved(c *config.Config, from label.Label, imp ImportSpec, lang string, err error) error {
+	uerr := &UnresolvedImportError{
+		From:        from,
+		Imp:         imp,
+		Err:         err,
+		Suggestions: ix.SuggestImport(imp, lang, DefaultSuggestDistance),
+	}
+	if dl, ok := ix.docLinkers[lang]; ok {
+		uerr.DocLink = dl.DocLinkForImport(imp)
+	}
+	return reportUnresolved(c, uerr)
+}
+
+// DocLinker is an optional interface that a Resolver may implement to
+// point users to documentation when imports can't be resolved, for example,
+// a page describing how to depend on libraries in an import's namespace.
+type DocLinker interface {
+	// DocLinkForImport returns a URL for documentation about imp, or "" if
+	// there is none.
+	DocLinkForImport(imp ImportSpec) string
+}
+
+func docLinkText(link string) string {
+	if link == "" {
+		return ""
+	}
+	return " (see " + link + ")"
+}
+
+func reportUnresolved(c *config.Config, uerr *UnresolvedImportError) error {
+	rc := getResolveConfig(c)
+	if !rc.strict {
+		log.Printf("%v%s%s", uerr.Err, suggestionText(uerr.Suggestions), docLinkText(uerr.DocLink))
+		return nil
+	}
+	errs, _ := c.Exts[unresolvedName].([]error)
+	c.Exts[unresolvedName] = append(errs, uerr)
+	if rc.failFast {
+		return ErrStopResolving
+	}
+	return nil
+}
+
+// TakeUnresolved returns the errors recorded in c by ReportUnresolved, in the
+// order they were reported, and clears them.
+func TakeUnresolved(c *config.Config) []error {
+	errs, _ := c.Exts[unresolvedName].([]error)
+	delete(c.Exts, unresolvedName)
+	return errs
+}
+
+const requiredLoadsName = "_resolve_required_loads"
+
+// RequireLoad records that the build file containing the rule being resolved
+// needs a load statement for the symbols in load. c should be the
+// configuration passed to Resolve. Gazelle collects required loads with
+// TakeRequiredLoads after each package is resolved and adds them to the
+// build file if they're missing.
+func RequireLoad(c *config.Config, load rule.LoadInfo) {
+	loads, _ := c.Exts[requiredLoadsName].([]rule.LoadInfo)
+	c.Exts[requiredLoadsName] = append(loads, load)
+}
+
+// TakeRequiredLoads returns the loads recorded in c by RequireLoad, in the
+// order they were recorded, and clears them.
+func TakeRequiredLoads(c *config.Config) []rule.LoadInfo {
+	loads, _ := c.Exts[requiredLoadsName].([]rule.LoadInfo)
+	delete(c.Exts, requiredLoadsName)
+	return loads
+}
+
+// FailFast returns whether Gazelle should stop resolving dependencies at
+// the first error, as set with -strict_resolve_fail_fast. When true,
+// ReportUnresolved returns ErrStopResolving, and Gazelle resolves no more
+// rules. When false, Gazelle resolves all rules and reports all errors
+// together.
+func FailFast(c *config.Config) bool {
+	return getResolveConfig(c).failFast
+}
+
+// PackageSetupResolver is an optional interface that a Resolver may
+// implement to prepare state that is shared by all rules it resolves in
+// a package, for example, a parsed manifest file.
+type PackageSetupResolver interface {
+	// PackageSetup is called once before any rules in the package pkg are
+	// resolved. The returned state is available during Resolve through
+	// PackageState. cleanup, if not nil, is called after all rules in the
+	// package have been resolved.
+	PackageSetup(c *config.Config, pkg string) (state interface{}, cleanup func())
+}
+
+const packageStateName = "_resolve_package_state"
+
+// SetupPackage calls PackageSetup for each resolver in rslvs that implements
+// PackageSetupResolver. Each resolver is set up at most once, even if it
+// appears multiple times in rslvs. Resolvers are identified by name. The
+// state returned by each resolver is stored in c, which should be the
+// configuration for pkg. Gazelle calls SetupPackage before resolving the
+// rules in each package.
+//
+// The returned function must be called after all rules in pkg have been
+// resolved. It calls each cleanup function in reverse order of setup and
+// removes the stored state from c.
+func SetupPackage(c *config.Config, pkg string, rslvs []Resolver) (cleanup func()) {
+	states := make(map[string]interface{})
+	var cleanups []func()
+	for _, rslv := range rslvs {
+		if rslv == nil {
+			continue
+		}
+		if _, ok := states[rslv.Name()]; ok {
+			continue
+		}
+		psr, ok := rslv.(PackageSetupResolver)
+		if !ok {
+			continue
+		}
+		state, cleanup := psr.PackageSetup(c, pkg)
+		states[rslv.Name()] = state
+		if cleanup != nil {
+			cleanups = append(cleanups, cleanup)
+		}
+	}
+	c.Exts[packageStateName] = states
+	return func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+		delete(c.Exts, packageStateName)
+	}
+}
+
+// PackageState returns the state returned by PackageSetup for the resolver
+// named lang in the package being resolved with configuration c. nil is
+// returned if there is no such state.
+func PackageState(c *config.Config, lang string) interface{} {
+	states, ok := c.Exts[packageStateName].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return states[lang]
+}
@@ -0,0 +1,440 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestCheckDepsLimit(t *testing.T) {
+	r := rule.NewRule("test_library", "lib")
+	r.SetAttr("deps", []string{":a", ":b", ":c"})
+	from := label.New("", "pkg", "lib")
+
+	for _, tc := range []struct {
+		desc              string
+		args              []string
+		wantErr, wantWarn bool
+	}{
+		{
+			desc: "no_limit",
+		}, {
+			desc: "under_limit",
+			args: []string{"-max_deps=3"},
+		}, {
+			desc:     "over_limit",
+			args:     []string{"-max_deps=2"},
+			wantWarn: true,
+		}, {
+			desc:    "over_limit_strict",
+			args:    []string{"-max_deps=2", "-strict_resolve"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := testConfig(t, tc.args...)
+			buf := &bytes.Buffer{}
+			log.SetOutput(buf)
+			defer log.SetOutput(os.Stderr)
+
+			err := CheckDeps(c, r, from)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("got error %v; want error %v", err, tc.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "//pkg:lib") {
+				t.Errorf("error %q does not identify the rule", err)
+			}
+			if gotWarn := strings.Contains(buf.String(), "//pkg:lib"); gotWarn != tc.wantWarn {
+				t.Errorf("got warning %q; want warning %v", buf.String(), tc.wantWarn)
+			}
+		})
+	}
+}
+
+// setupResolver is a testResolver that records the package state it sees
+// when resolving each rule.
+type setupResolver struct {
+	testResolver
+	events []string
+}
+
+func (sr *setupResolver) PackageSetup(c *config.Config, pkg string) (interface{}, func()) {
+	sr.events = append(sr.events, "setup "+pkg)
+	return "state " + pkg, func() {
+		sr.events = append(sr.events, "cleanup "+pkg)
+	}
+}
+
+func (sr *setupResolver) Resolve(c *config.Config, ix *RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+	state, _ := PackageState(c, sr.name).(string)
+	sr.events = append(sr.events, fmt.Sprintf("resolve %s with %q", from, state))
+}
+
+func TestSetupPackage(t *testing.T) {
+	rslv := &setupResolver{testResolver: testResolver{name: "test"}}
+	other := &testResolver{name: "other"}
+	for _, pkg := range []string{"a", "b"} {
+		c := testConfig(t)
+		rules := []*rule.Rule{
+			rule.NewRule("test_library", "x"),
+			rule.NewRule("other_library", "y"),
+			rule.NewRule("test_library", "z"),
+		}
+		rslvs := []Resolver{rslv, other, rslv}
+		cleanup := SetupPackage(c, pkg, rslvs)
+		for i, r := range rules {
+			rslvs[i].Resolve(c, nil, nil, r, nil, label.New("", pkg, r.Name()))
+		}
+		cleanup()
+		if state := PackageState(c, "test"); state != nil {
+			t.Errorf("%s: state %v still present after cleanup", pkg, state)
+		}
+	}
+
+	want := []string{
+		"setup a",
+		`resolve //a:x with "state a"`,
+		`resolve //a:z with "state a"`,
+		"cleanup a",
+		"setup b",
+		`resolve //b:x with "state b"`,
+		`resolve //b:z with "state b"`,
+		"cleanup b",
+	}
+	if !reflect.DeepEqual(rslv.events, want) {
+		t.Errorf("got events:\n%s\nwant:\n%s", strings.Join(rslv.events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckForbiddenRepo(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:forbidden_repo @gpl_lib
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	imp := ImportSpec{Lang: "go", Imp: "example.com/gpl"}
+	err = CheckForbiddenRepo(c, imp, label.New("gpl_lib", "", "go_default_library"))
+	if err == nil {
+		t.Fatal("dependency in forbidden repository: got nil error")
+	}
+	for _, want := range []string{`"example.com/gpl"`, "@gpl_lib//:go_default_library"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if err := CheckForbiddenRepo(c, imp, label.New("mit_lib", "", "go_default_library")); err != nil {
+		t.Errorf("dependency in allowed repository: got error %v", err)
+	}
+	if err := CheckForbiddenRepo(c, imp, label.New("", "gpl_lib", "go_default_library")); err != nil {
+		t.Errorf("dependency in main repository: got error %v", err)
+	}
+}
+
+func TestCheckAllowedRepo(t *testing.T) {
+	root := testConfig(t)
+	cr := &Configurer{}
+	configure := func(c *config.Config, rel, content string) *config.Config {
+		c = c.Clone()
+		f, err := rule.LoadData(rel+"/BUILD.bazel", rel, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr.Configure(c, rel, f)
+		return c
+	}
+	frontend := configure(root, "frontend", "# gazelle:allow_repo @npm")
+	frontendTools := configure(frontend, "frontend/tools", "# gazelle:allow_repo com_github_tools")
+	backend := configure(root, "backend", "# gazelle:allow_repo org_golang_x_net\n# gazelle:allow_repo com_github_tools")
+	other := configure(root, "other", "")
+
+	imp := ImportSpec{Lang: "go", Imp: "example.com/ext"}
+	for _, tc := range []struct {
+		desc    string
+		c       *config.Config
+		repo    string
+		wantErr bool
+	}{
+		{desc: "frontend_allowed", c: frontend, repo: "npm"},
+		{desc: "frontend_disallowed", c: frontend, repo: "org_golang_x_net", wantErr: true},
+		{desc: "frontend_main", c: frontend, repo: ""},
+		{desc: "subtree_inherited", c: frontendTools, repo: "npm"},
+		{desc: "subtree_added", c: frontendTools, repo: "com_github_tools"},
+		{desc: "subtree_disallowed", c: frontendTools, repo: "org_golang_x_net", wantErr: true},
+		{desc: "backend_allowed", c: backend, repo: "org_golang_x_net"},
+		{desc: "backend_disallowed", c: backend, repo: "npm", wantErr: true},
+		{desc: "no_allowlist", c: other, repo: "npm"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := CheckForbiddenRepo(tc.c, imp, label.New(tc.repo, "pkg", "lib"))
+			if tc.wantErr && err == nil {
+				t.Error("got nil error")
+			} else if !tc.wantErr && err != nil {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckForbiddenRepoFirstPartyOnly(t *testing.T) {
+	c := testConfig(t, "-first_party_only")
+	c.RepoName = "main"
+	imp := ImportSpec{Lang: "go", Imp: "example.com/ext"}
+	if err := CheckForbiddenRepo(c, imp, label.New("ext", "", "go_default_library")); err == nil {
+		t.Error("dependency in external repository: got nil error")
+	}
+	for _, l := range []label.Label{
+		label.New("", "pkg", "go_default_library"),
+		label.New("main", "pkg", "go_default_library"),
+	} {
+		if err := CheckForbiddenRepo(c, imp, l); err != nil {
+			t.Errorf("dependency %s in main repository: got error %v", l, err)
+		}
+	}
+}
+
+func TestAddDefaultDeps(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:default_dep foo_library //common:foo_runtime
+# gazelle:default_dep foo_library @ext//:support
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	for _, tc := range []struct {
+		desc, kind, pkg string
+		deps            []string
+		want            []string
+	}{
+		{
+			desc: "no_deps",
+			kind: "foo_library",
+			want: []string{"//common:foo_runtime", "@ext//:support"},
+		}, {
+			desc: "resolved",
+			kind: "foo_library",
+			deps: []string{"//common:foo_runtime", "//lib"},
+			want: []string{"//common:foo_runtime", "//lib", "@ext//:support"},
+		}, {
+			desc: "relative",
+			kind: "foo_library",
+			pkg:  "common",
+			deps: []string{":foo_runtime"},
+			want: []string{":foo_runtime", "@ext//:support"},
+		}, {
+			desc: "other_kind",
+			kind: "bar_library",
+			deps: []string{"//lib"},
+			want: []string{"//lib"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := rule.NewRule(tc.kind, "x")
+			if tc.deps != nil {
+				r.SetAttr("deps", tc.deps)
+			}
+			pkg := tc.pkg
+			if pkg == "" {
+				pkg = "app"
+			}
+			AddDefaultDeps(c, r, label.New("", pkg, "x"))
+			if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReportUnresolved(t *testing.T) {
+	from := label.New("", "a", "a")
+	imp := ImportSpec{Lang: "test", Imp: "missing"}
+	for _, tc := range []struct {
+		desc     string
+		args     []string
+		wantErrs int
+		wantLog  bool
+		wantStop bool
+	}{
+		{desc: "default", wantLog: true},
+		{desc: "strict", args: []string{"-strict_resolve"}, wantErrs: 1},
+		{desc: "fail_fast", args: []string{"-strict_resolve_fail_fast"}, wantErrs: 1, wantStop: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			log.SetOutput(&logBuf)
+			defer log.SetOutput(os.Stderr)
+
+			c := testConfig(t, tc.args...)
+			if err := ReportUnresolved(c, from, imp, fmt.Errorf("not found")); (err == ErrStopResolving) != tc.wantStop {
+				t.Errorf("got error %v; want stop %v", err, tc.wantStop)
+			}
+			errs := TakeUnresolved(c)
+			if len(errs) != tc.wantErrs {
+				t.Fatalf("got %d errors; want %d", len(errs), tc.wantErrs)
+			}
+			if tc.wantErrs > 0 {
+				if got, want := errs[0].Error(), `//a: import "missing": not found`; got != want {
+					t.Errorf("got error %q; want %q", got, want)
+				}
+			}
+			if gotLog := strings.Contains(logBuf.String(), "not found"); gotLog != tc.wantLog {
+				t.Errorf("logged: got %v; want %v", gotLog, tc.wantLog)
+			}
+			if errs := TakeUnresolved(c); len(errs) != 0 {
+				t.Errorf("errors were not cleared: %v", errs)
+			}
+		})
+	}
+}
+
+// docLinkResolver links imports in the corp.example.com namespace to
+// documentation.
+type docLinkResolver struct {
+	testResolver
+}
+
+func (dr *docLinkResolver) DocLinkForImport(imp ImportSpec) string {
+	if strings.HasPrefix(imp.Imp, "corp.example.com/") {
+		return "https://docs.corp.example.com/deps/" + strings.TrimPrefix(imp.Imp, "corp.example.com/")
+	}
+	return ""
+}
+
+func TestReportUnresolvedDocLink(t *testing.T) {
+	dr := &docLinkResolver{testResolver{name: "test"}}
+	ix := NewRuleIndex(kindResolver(dr), dr)
+	ix.Finish()
+	from := label.New("", "a", "a")
+
+	c := testConfig(t, "-strict_resolve")
+	ix.ReportUnresolved(c, from, ImportSpec{Lang: "test", Imp: "corp.example.com/db"}, "test", fmt.Errorf("not found"))
+	ix.ReportUnresolved(c, from, ImportSpec{Lang: "test", Imp: "example.com/db"}, "test", fmt.Errorf("not found"))
+	errs := TakeUnresolved(c)
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`//a: import "corp.example.com/db": not found (see https://docs.corp.example.com/deps/db)`,
+		`//a: import "example.com/db": not found`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	ix.ReportUnresolved(testConfig(t), from, ImportSpec{Lang: "test", Imp: "corp.example.com/db"}, "test", fmt.Errorf("not found"))
+	if got, want := logBuf.String(), "(see https://docs.corp.example.com/deps/db)"; !strings.Contains(got, want) {
+		t.Errorf("got log %q; want it to contain %q", got, want)
+	}
+}
+
+// groupingFormatter writes deps in two sections, internal and external,
+// each preceded by a comment.
+type groupingFormatter struct {
+	testResolver
+}
+
+func (*groupingFormatter) FormatDeps(r *rule.Rule, attr string, deps []label.Label, from label.Label) {
+	var internal, external []bzl.Expr
+	for _, l := range deps {
+		e := &bzl.StringExpr{Value: l.Rel(from.Repo, from.Pkg).String()}
+		if l.Repo == "" {
+			internal = append(internal, e)
+		} else {
+			external = append(external, e)
+		}
+	}
+	list := &bzl.ListExpr{ForceMultiLine: true}
+	for _, group := range []struct {
+		comment string
+		exprs   []bzl.Expr
+	}{{"# internal", internal}, {"# external", external}} {
+		if len(group.exprs) == 0 {
+			continue
+		}
+		group.exprs[0].Comment().Before = []bzl.Comment{{Token: group.comment}}
+		list.List = append(list.List, group.exprs...)
+	}
+	r.SetAttr(attr, list)
+}
+
+func TestFormatDeps(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("pkg/BUILD.bazel", "pkg", []byte(`
+test_library(
+    name = "a",
+    deps = [
+        ":b",
+        "//x",
+        "@ext//:y",
+        "@ext//z",
+    ],
+    data = ["@ext//:data"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.Rules[0]
+	FormatDeps(c, &groupingFormatter{testResolver{name: "test"}}, r, label.New("", "pkg", "a"))
+
+	got := strings.TrimSpace(string(f.Format()))
+	want := `test_library(
+    name = "a",
+    data = ["@ext//:data"],
+    deps = [
+        # internal
+        ":b",
+        "//x",
+        # external
+        "@ext//:y",
+        "@ext//z",
+    ],
+)`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Resolvers that don't implement DepsFormatter don't change anything.
+	before := string(f.Format())
+	FormatDeps(c, &testResolver{name: "test"}, r, label.New("", "pkg", "a"))
+	if after := string(f.Format()); after != before {
+		t.Errorf("deps changed without a DepsFormatter:\n%s", after)
+	}
+}
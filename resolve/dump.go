@@ -0,0 +1,97 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// IndexedRuleInfo describes a rule in the index, as written by WriteJSON.
+type IndexedRuleInfo struct {
+	// Label is the label of the rule.
+	Label string `json:"label"`
+
+	// Kind is the rule's kind, and Lang is the name of the resolver that
+	// indexed it.
+	Kind string `json:"kind"`
+	Lang string `json:"lang"`
+
+	// Imports lists the import specs the rule may be imported by, including
+	// imports inherited from rules it embeds or exports.
+	Imports []ImportSpecInfo `json:"imports"`
+
+	// Embeds lists the labels of rules the rule embeds, transitively.
+	Embeds []string `json:"embeds,omitempty"`
+
+	// Embedded is true if another rule embeds this rule, and EmbedOnly is
+	// true if its resolver only embeds it. Such rules are not found by
+	// import.
+	Embedded  bool `json:"embedded,omitempty"`
+	EmbedOnly bool `json:"embed_only,omitempty"`
+}
+
+// ImportSpecInfo is the JSON form of an ImportSpec.
+type ImportSpecInfo struct {
+	Lang string `json:"lang"`
+	Imp  string `json:"imp"`
+}
+
+// IndexedRules returns a description of each rule in ix, sorted by label.
+// Rules in indexes added with WithFallback are not included.
+//
+// IndexedRules may only be called after Finish.
+func (ix *RuleIndex) IndexedRules() []IndexedRuleInfo {
+	infos := make([]IndexedRuleInfo, 0, len(ix.rules))
+	for _, r := range ix.rules {
+		info := IndexedRuleInfo{
+			Label:     r.label.String(),
+			Kind:      r.rule.Kind(),
+			Lang:      r.lang,
+			Imports:   []ImportSpecInfo{},
+			Embedded:  r.embedded,
+			EmbedOnly: r.embedOnly,
+		}
+		for _, imp := range r.importedAs {
+			info.Imports = append(info.Imports, ImportSpecInfo{Lang: imp.Lang, Imp: imp.Imp})
+		}
+		if len(r.embeds) > 0 {
+			info.Embeds = labelStrings(r.embeds)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Label < infos[j].Label
+	})
+	return infos
+}
+
+// WriteJSON writes the rules returned by IndexedRules to w as an indented
+// JSON object with a "rules" field.
+//
+// WriteJSON may only be called after Finish.
+func (ix *RuleIndex) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(struct {
+		Rules []IndexedRuleInfo `json:"rules"`
+	}{ix.IndexedRules()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
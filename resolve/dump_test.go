@@ -0,0 +1,84 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "a",
+		content: `
+test_library(
+    name = "b",
+    provides = ["b"],
+)
+
+test_library(
+    name = "a",
+    provides = ["a"],
+    embed = [":b"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	var buf bytes.Buffer
+	if err := ix.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "rules": [
+    {
+      "label": "//a",
+      "kind": "test_library",
+      "lang": "test",
+      "imports": [
+        {
+          "lang": "test",
+          "imp": "a"
+        },
+        {
+          "lang": "test",
+          "imp": "b"
+        }
+      ],
+      "embeds": [
+        "//a:b"
+      ]
+    },
+    {
+      "label": "//a:b",
+      "kind": "test_library",
+      "lang": "test",
+      "imports": [
+        {
+          "lang": "test",
+          "imp": "b"
+        }
+      ],
+      "embedded": true
+    }
+  ]
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, strings.TrimSpace(want))
+	}
+}
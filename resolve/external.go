@@ -0,0 +1,60 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// RecordResolvedImport records that imp resolved to the label l. Resolvers
+// should call this for each import they resolve successfully, so that after
+// a complete resolve pass, the index knows where each import points.
+// If an import is recorded more than once, the last label wins.
+func (ix *RuleIndex) RecordResolvedImport(imp ImportSpec, l label.Label) {
+	if ix.resolvedImports == nil {
+		ix.resolvedImports = make(map[ImportSpec]label.Label)
+	}
+	ix.resolvedImports[imp] = l
+}
+
+// ExternalImports returns the imports recorded with RecordResolvedImport
+// that resolved to labels outside the main repository, grouped by the name
+// of the external repository. Imports within each group are sorted by
+// language, then by import string.
+//
+// Like ProviderInDegree, the result is only complete after a resolve pass in
+// which every resolved import was recorded.
+func (ix *RuleIndex) ExternalImports(c *config.Config) map[string][]ImportSpec {
+	external := make(map[string][]ImportSpec)
+	for imp, l := range ix.resolvedImports {
+		if isFirstParty(c, l) {
+			continue
+		}
+		external[l.Repo] = append(external[l.Repo], imp)
+	}
+	for _, imps := range external {
+		sort.Slice(imps, func(i, j int) bool {
+			if imps[i].Lang != imps[j].Lang {
+				return imps[i].Lang < imps[j].Lang
+			}
+			return imps[i].Imp < imps[j].Imp
+		})
+	}
+	return external
+}
@@ -0,0 +1,50 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestExternalImports(t *testing.T) {
+	c := testConfig(t)
+	c.RepoName = "main"
+	ix := NewRuleIndex(nil)
+	ix.Finish()
+
+	ix.RecordResolvedImport(ImportSpec{Lang: "go", Imp: "example.com/local"}, label.New("", "local", "go_default_library"))
+	ix.RecordResolvedImport(ImportSpec{Lang: "go", Imp: "example.com/self"}, label.New("main", "self", "go_default_library"))
+	ix.RecordResolvedImport(ImportSpec{Lang: "go", Imp: "github.com/a/x/b"}, label.New("com_github_a_x", "b", "go_default_library"))
+	ix.RecordResolvedImport(ImportSpec{Lang: "go", Imp: "github.com/a/x"}, label.New("com_github_a_x", "", "go_default_library"))
+	ix.RecordResolvedImport(ImportSpec{Lang: "proto", Imp: "google/protobuf/any.proto"}, label.New("com_google_protobuf", "", "any_proto"))
+
+	got := ix.ExternalImports(c)
+	want := map[string][]ImportSpec{
+		"com_github_a_x": {
+			{Lang: "go", Imp: "github.com/a/x"},
+			{Lang: "go", Imp: "github.com/a/x/b"},
+		},
+		"com_google_protobuf": {
+			{Lang: "proto", Imp: "google/protobuf/any.proto"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// Hash returns a hash of the mapping from import specs to the labels of
+// rules that provide them. The hash does not depend on the order in which
+// rules were added, so it may be used as a cache key that changes only when
+// resolution results could change.
+//
+// The hash is the 64-bit FNV-1a hash of the following sequence. For each
+// import spec in the index, sorted by language, then by import string:
+// the language, a NUL byte, the import string, and a NUL byte; then, for
+// each label providing the spec, sorted as strings: the label and a NUL
+// byte; then a newline.
+//
+// Hash may only be called after Finish.
+func (ix *RuleIndex) Hash() uint64 {
+	imps := make([]ImportSpec, 0, len(ix.importMap))
+	for imp := range ix.importMap {
+		imps = append(imps, imp)
+	}
+	sortImportSpecs(imps)
+
+	h := fnv.New64a()
+	for _, imp := range imps {
+		h.Write([]byte(imp.Lang))
+		h.Write([]byte{0})
+		h.Write([]byte(imp.Imp))
+		h.Write([]byte{0})
+		records := ix.importMap[imp]
+		labels := make([]string, len(records))
+		for i, r := range records {
+			labels[i] = r.label.String()
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			h.Write([]byte(l))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,62 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testResolver{name: "test"}
+	a := testFile{
+		rel: "a",
+		content: `
+test_library(
+    name = "a",
+    provides = ["x", "y"],
+)
+`,
+	}
+	b := testFile{
+		rel: "b",
+		content: `
+test_library(
+    name = "b",
+    provides = ["y"],
+)
+`,
+	}
+	bChanged := testFile{
+		rel: "b",
+		content: `
+test_library(
+    name = "b",
+    provides = ["z"],
+)
+`,
+	}
+
+	ab := buildTestIndex(t, c, []testFile{a, b}, rslv).Hash()
+	ba := buildTestIndex(t, c, []testFile{b, a}, rslv).Hash()
+	if ab != ba {
+		t.Errorf("hash depends on insertion order: %x != %x", ab, ba)
+	}
+	if again := buildTestIndex(t, c, []testFile{a, b}, rslv).Hash(); again != ab {
+		t.Errorf("hash is not stable: %x != %x", again, ab)
+	}
+	if changed := buildTestIndex(t, c, []testFile{a, bChanged}, rslv).Hash(); changed == ab {
+		t.Errorf("hash did not change when a mapping changed: %x", changed)
+	}
+}
@@ -0,0 +1,54 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "github.com/bazelbuild/bazel-gazelle/label"
+
+// RecordResolvedDeps records that the rule with label from depends on deps
+// after resolution. Gazelle calls this for each rule it resolves, so after
+// a complete resolve pass, the index knows the in-degree of each provider.
+// Recording the same dependency more than once has no effect.
+func (ix *RuleIndex) RecordResolvedDeps(from label.Label, deps []label.Label) {
+	if ix.importers == nil {
+		ix.importers = make(map[label.Label]map[label.Label]bool)
+	}
+	for _, dep := range deps {
+		dep = dep.Abs(from.Repo, from.Pkg)
+		if dep == from {
+			continue
+		}
+		if ix.importers[dep] == nil {
+			ix.importers[dep] = make(map[label.Label]bool)
+		}
+		ix.importers[dep][from] = true
+	}
+}
+
+// ProviderInDegree returns the number of rules that depend on each label,
+// as recorded with RecordResolvedDeps. Labels that no rule depends on are
+// not included. Dependencies on rules outside the index, for example, in
+// external repositories, are included.
+//
+// The index itself doesn't know which rules import which providers, so the
+// result is only complete after a resolve pass in which RecordResolvedDeps
+// was called for every rule.
+func (ix *RuleIndex) ProviderInDegree() map[label.Label]int {
+	inDegree := make(map[label.Label]int, len(ix.importers))
+	for dep, froms := range ix.importers {
+		inDegree[dep] = len(froms)
+	}
+	return inDegree
+}
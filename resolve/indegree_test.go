@@ -0,0 +1,47 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestProviderInDegree(t *testing.T) {
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}))
+	ix.Finish()
+
+	common := label.New("", "common", "common")
+	util := label.New("", "util", "util")
+	for i := 0; i < 10; i++ {
+		from := label.New("", fmt.Sprintf("app%d", i), "app")
+		ix.RecordResolvedDeps(from, []label.Label{common})
+	}
+	ix.RecordResolvedDeps(label.New("", "app0", "app"), []label.Label{common, util})
+	ix.RecordResolvedDeps(util, []label.Label{common, util})
+
+	got := ix.ProviderInDegree()
+	want := map[label.Label]int{
+		common: 11,
+		util:   1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
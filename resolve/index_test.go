@@ -0,0 +1,1913 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// testResolver is a Resolver for rules with kinds that start with its name.
+// Rules declare the imports they provide in a "provides" attribute and the
+// rules they embed in an "embed" attribute. Rules without a "provides"
+// attribute are not importable.
+type testResolver struct {
+	name string
+}
+
+func (tr *testResolver) Name() string { return tr.name }
+
+func (tr *testResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	if r.Attr("provides") == nil {
+		return nil
+	}
+	imps := []ImportSpec{}
+	for _, imp := range r.AttrStrings("provides") {
+		imps = append(imps, ImportSpec{Lang: tr.name, Imp: imp})
+	}
+	return imps
+}
+
+func (tr *testResolver) Embeds(r *rule.Rule, from label.Label) []label.Label {
+	var embeds []label.Label
+	for _, s := range r.AttrStrings("embed") {
+		l, err := label.Parse(s)
+		if err != nil {
+			continue
+		}
+		embeds = append(embeds, l.Abs(from.Repo, from.Pkg))
+	}
+	return embeds
+}
+
+func (tr *testResolver) Resolve(c *config.Config, ix *RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+}
+
+// groupResolver is a testResolver that groups rules by their "group"
+// attribute.
+type groupResolver struct {
+	testResolver
+}
+
+func (gr *groupResolver) Group(r *rule.Rule) string {
+	return r.AttrString("group")
+}
+
+// testFile is the content of a build file in the package rel.
+type testFile struct {
+	rel, content string
+}
+
+func testConfig(t testing.TB, args ...string) *config.Config {
+	c := config.New()
+	cr := &Configurer{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cr.RegisterFlags(fs, "update", c)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := cr.CheckFlags(fs, c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// kindResolver returns a function suitable for NewRuleIndex which selects a
+// resolver from rslvs whose name is a prefix of the rule's kind.
+func kindResolver(rslvs ...Resolver) func(r *rule.Rule, pkgRel string) Resolver {
+	return func(r *rule.Rule, pkgRel string) Resolver {
+		for _, rslv := range rslvs {
+			if strings.HasPrefix(r.Kind(), rslv.Name()) {
+				return rslv
+			}
+		}
+		return nil
+	}
+}
+
+func loadTestFiles(t *testing.T, files []testFile) []*rule.File {
+	var fs []*rule.File
+	for _, tf := range files {
+		f, err := rule.LoadData(path.Join(tf.rel, "BUILD.bazel"), tf.rel, []byte(tf.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// buildTestIndex creates an index containing all rules in files and calls
+// Finish.
+func buildTestIndex(t *testing.T, c *config.Config, files []testFile, rslvs ...Resolver) *RuleIndex {
+	ix := NewRuleIndex(kindResolver(rslvs...))
+	addTestFiles(t, c, ix, files)
+	ix.Finish()
+	return ix
+}
+
+// addTestFiles adds all rules in files to ix.
+func addTestFiles(t *testing.T, c *config.Config, ix *RuleIndex, files []testFile) {
+	for _, f := range loadTestFiles(t, files) {
+		for _, r := range f.Rules {
+			ix.AddRule(c, r, f)
+		}
+	}
+}
+
+func resultLabels(results []FindResult) []string {
+	var labels []string
+	for _, r := range results {
+		labels = append(labels, r.Label.String())
+	}
+	return labels
+}
+
+func TestFindRulesByImportInGroup(t *testing.T) {
+	c := testConfig(t)
+	rslv := &groupResolver{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{
+		{
+			rel: "frontend",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a", "b"],
+    group = "frontend",
+)
+`,
+		}, {
+			rel: "backend",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    group = "backend",
+)
+`,
+		}, {
+			rel: "common",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a", "b", "c"],
+)
+`,
+		},
+	}, rslv)
+
+	for _, tc := range []struct {
+		desc, imp, group string
+		want             []string
+	}{
+		{
+			desc:  "same_group",
+			imp:   "a",
+			group: "frontend",
+			want:  []string{"//frontend:a"},
+		}, {
+			desc:  "other_group",
+			imp:   "a",
+			group: "backend",
+			want:  []string{"//backend:a"},
+		}, {
+			desc:  "ungrouped_fallback",
+			imp:   "c",
+			group: "frontend",
+			want:  []string{"//common:a"},
+		}, {
+			desc:  "other_group_excluded",
+			imp:   "b",
+			group: "backend",
+			want:  []string{"//common:a"},
+		}, {
+			desc:  "no_group",
+			imp:   "a",
+			group: "",
+			want:  []string{"//common:a"},
+		}, {
+			desc:  "missing",
+			imp:   "d",
+			group: "frontend",
+			want:  nil,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			results := ix.FindRulesByImportInGroup(ImportSpec{Lang: "test", Imp: tc.imp}, "test", tc.group)
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// testSelfImportResolver is a testResolver that allows test rules to import
+// themselves.
+type testSelfImportResolver struct {
+	testResolver
+}
+
+func (tr *testSelfImportResolver) AllowSelfImport(from label.Label, r *rule.Rule) bool {
+	return strings.HasSuffix(r.Kind(), "_test")
+}
+
+func TestIsSelfImportAllowed(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testSelfImportResolver{testResolver{name: "test"}}
+	files := []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "foo",
+    provides = ["foo"],
+)
+
+test_test(
+    name = "foo_test",
+    provides = [],
+    embed = [":foo"],
+)
+`,
+	}}
+	ix := buildTestIndex(t, c, files, rslv)
+	f := loadTestFiles(t, files)[0]
+	results := ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: "foo"}, "test")
+	if len(results) != 1 {
+		t.Fatalf("got %d results; want 1", len(results))
+	}
+	res := results[0]
+
+	for _, r := range f.Rules {
+		from := label.New("", "foo", r.Name())
+		if !res.IsSelfImport(from) {
+			t.Errorf("%s: FindResult.IsSelfImport = false; want true", from)
+		}
+		got := ix.IsSelfImport(res, r, from)
+		want := r.Kind() == "test_library"
+		if got != want {
+			t.Errorf("%s: RuleIndex.IsSelfImport = %v; want %v", from, got, want)
+		}
+	}
+}
+
+// testCrossResolver resolves imports in imps to fixed labels.
+type testCrossResolver struct {
+	imps map[ImportSpec]label.Label
+}
+
+func (cr *testCrossResolver) CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	if l, ok := cr.imps[imp]; ok {
+		return []FindResult{{Label: l}}
+	}
+	return nil
+}
+
+func TestFindRulesByImportWithFallback(t *testing.T) {
+	rslv := &testResolver{name: "test"}
+	cr := &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "b"}: label.New("cross", "", "b"),
+		{Lang: "test", Imp: "c"}: label.New("cross", "", "c"),
+	}}
+	local := NewRuleIndex(kindResolver(rslv), cr)
+	addTestFiles(t, testConfig(t), local, []testFile{{
+		rel: "local",
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+)
+`,
+	}})
+	local.Finish()
+	sharedConfig := testConfig(t)
+	sharedConfig.RepoName = "shared"
+	shared := buildTestIndex(t, sharedConfig, []testFile{{
+		rel: "lib",
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+)
+
+test_library(
+    name = "b",
+    provides = ["b"],
+)
+`,
+	}}, rslv)
+	local.WithFallback(shared)
+
+	c := testConfig(t)
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "a", want: []string{"//local:a"}},
+		{imp: "b", want: []string{"@shared//lib:b"}},
+		{imp: "c", want: []string{"@cross//:c"}},
+		{imp: "d", want: nil},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			results := local.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: tc.imp}, "test")
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithFallbackCycle(t *testing.T) {
+	a, b, c := NewRuleIndex(nil), NewRuleIndex(nil), NewRuleIndex(nil)
+	a.WithFallback(b).WithFallback(c)
+
+	// Adding an index that's already in the chain, including ix itself,
+	// does nothing.
+	a.WithFallback(a)
+	a.WithFallback(b)
+	a.WithFallback(c)
+	if a.fallback != b || b.fallback != c || c.fallback != nil {
+		t.Errorf("chain was modified by adding indexes already in it")
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		ix, next *RuleIndex
+	}{
+		{desc: "back", ix: c, next: a},
+		{desc: "middle", ix: b, next: a},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("WithFallback did not panic")
+				}
+			}()
+			tc.ix.WithFallback(tc.next)
+		})
+	}
+}
+
+// priorityCrossResolver is a testCrossResolver with a priority that may be
+// authoritative for imports it resolves.
+type priorityCrossResolver struct {
+	testCrossResolver
+	priority      int
+	authoritative bool
+}
+
+func (cr *priorityCrossResolver) CrossResolvePriority() int { return cr.priority }
+
+func (cr *priorityCrossResolver) IsAuthoritative(imp ImportSpec, lang string) bool {
+	return cr.authoritative
+}
+
+func TestCrossResolverPriority(t *testing.T) {
+	imp := ImportSpec{Lang: "test", Imp: "x"}
+	newResolver := func(name string, priority int, authoritative bool) *priorityCrossResolver {
+		return &priorityCrossResolver{
+			testCrossResolver: testCrossResolver{imps: map[ImportSpec]label.Label{imp: label.New(name, "", "x")}},
+			priority:          priority,
+			authoritative:     authoritative,
+		}
+	}
+	unprioritized := &testCrossResolver{imps: map[ImportSpec]label.Label{imp: label.New("default", "", "x")}}
+	for _, tc := range []struct {
+		desc string
+		exts []interface{}
+		want []string
+	}{
+		{
+			desc: "priority order",
+			exts: []interface{}{newResolver("late", -1, false), unprioritized, newResolver("early", 1, false)},
+			want: []string{"@early//:x", "@default//:x", "@late//:x"},
+		}, {
+			desc: "stable",
+			exts: []interface{}{newResolver("a", 1, false), newResolver("b", 1, false)},
+			want: []string{"@a//:x", "@b//:x"},
+		}, {
+			desc: "authoritative",
+			exts: []interface{}{unprioritized, newResolver("early", 1, false), newResolver("auth", 1, true), newResolver("late", -1, false)},
+			want: []string{"@auth//:x"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ix := NewRuleIndex(kindResolver(), tc.exts...)
+			ix.Finish()
+			got := resultLabels(ix.FindRulesByImportWithConfig(testConfig(t), imp, "test"))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFirstPartyOnly(t *testing.T) {
+	rslv := &testResolver{name: "test"}
+	cr := &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "cross"}: label.New("cross", "", "cross"),
+	}}
+	ix := NewRuleIndex(kindResolver(rslv), cr)
+	addTestFiles(t, testConfig(t), ix, []testFile{{
+		rel: "local",
+		content: `
+test_library(
+    name = "local",
+    provides = ["local"],
+)
+`,
+	}})
+	ix.Finish()
+	sharedConfig := testConfig(t)
+	sharedConfig.RepoName = "shared"
+	ix.WithFallback(buildTestIndex(t, sharedConfig, []testFile{{
+		rel: "lib",
+		content: `
+test_library(
+    name = "shared",
+    provides = ["shared"],
+)
+`,
+	}}, rslv))
+
+	for _, tc := range []struct {
+		desc string
+		args []string
+		want map[string][]string
+	}{
+		{
+			desc: "default",
+			want: map[string][]string{
+				"local":  {"//local"},
+				"shared": {"@shared//lib:shared"},
+				"cross":  {"@cross//:cross"},
+			},
+		}, {
+			desc: "first_party_only",
+			args: []string{"-first_party_only"},
+			want: map[string][]string{
+				"local":  {"//local"},
+				"shared": nil,
+				"cross":  nil,
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := testConfig(t, tc.args...)
+			for imp, want := range tc.want {
+				results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: imp}, "test")
+				if got := resultLabels(results); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %q; want %q", imp, got, want)
+				}
+			}
+		})
+	}
+}
+
+// testFromNormalizer is a testResolver that treats rules with names ending
+// in "_gen" as generated by a macro named without the suffix.
+type testFromNormalizer struct {
+	testResolver
+}
+
+func (tr *testFromNormalizer) NormalizeFrom(from label.Label, r *rule.Rule) label.Label {
+	from.Name = strings.TrimSuffix(from.Name, "_gen")
+	return from
+}
+
+func TestIsSelfImportNormalizeFrom(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testFromNormalizer{testResolver{name: "test"}}
+	files := []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "foo",
+    provides = ["foo"],
+)
+
+test_library(
+    name = "foo_gen",
+)
+
+test_library(
+    name = "bar_gen",
+)
+`,
+	}}
+	ix := buildTestIndex(t, c, files, rslv)
+	f := loadTestFiles(t, files)[0]
+	res := ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: "foo"}, "test")[0]
+
+	for _, tc := range []struct {
+		r    *rule.Rule
+		want bool
+	}{
+		{r: f.Rules[1], want: true},
+		{r: f.Rules[2], want: false},
+	} {
+		from := label.New("", "foo", tc.r.Name())
+		if res.IsSelfImport(from) {
+			t.Errorf("%s: FindResult.IsSelfImport = true; want false", from)
+		}
+		if got := ix.IsSelfImport(res, tc.r, from); got != tc.want {
+			t.Errorf("%s: RuleIndex.IsSelfImport = %v; want %v", from, got, tc.want)
+		}
+	}
+	if got, want := ix.NormalizeFrom(label.New("", "foo", "foo_gen"), f.Rules[1]), label.New("", "foo", "foo"); !got.Equal(want) {
+		t.Errorf("NormalizeFrom: got %s; want %s", got, want)
+	}
+}
+
+// testExporter is a testResolver that reads exported labels from an
+// "exports" attribute.
+type testExporter struct {
+	testResolver
+}
+
+func (tr *testExporter) Exports(r *rule.Rule, from label.Label) []label.Label {
+	var exports []label.Label
+	for _, s := range r.AttrStrings("exports") {
+		if l, err := label.Parse(s); err == nil {
+			exports = append(exports, l.Abs(from.Repo, from.Pkg))
+		}
+	}
+	return exports
+}
+
+func TestExportsAreNotEmbeds(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testExporter{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "exporter",
+    provides = ["exporter"],
+    exports = [":exported"],
+)
+
+test_library(
+    name = "exported",
+    provides = ["exported"],
+)
+
+test_library(
+    name = "embedder",
+    provides = ["embedder"],
+    embed = [":embedded"],
+)
+
+test_library(
+    name = "embedded",
+    provides = ["embedded"],
+)
+`,
+	}}, rslv)
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "exporter", want: []string{"//foo:exporter"}},
+		{imp: "exported", want: []string{"//foo:exporter", "//foo:exported"}},
+		{imp: "embedder", want: []string{"//foo:embedder"}},
+		{imp: "embedded", want: []string{"//foo:embedder"}},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			results := ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: tc.imp}, "test")
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// testPreferrer is a testResolver that reads a preferred import from a
+// "preferred" attribute.
+type testPreferrer struct {
+	testResolver
+}
+
+func (tr *testPreferrer) PreferredImport(r *rule.Rule) (ImportSpec, bool) {
+	if imp := r.AttrString("preferred"); imp != "" {
+		return ImportSpec{Lang: tr.name, Imp: imp}, true
+	}
+	return ImportSpec{}, false
+}
+
+func TestCanonicalImport(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testPreferrer{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "preferred",
+    provides = ["a/b", "a", "example.com/a/b/c"],
+    preferred = "example.com/a/b/c",
+)
+
+test_library(
+    name = "shortest",
+    provides = ["c/d", "c", "b"],
+)
+
+test_library(
+    name = "none",
+    provides = [],
+)
+`,
+	}}, rslv)
+
+	for _, tc := range []struct {
+		name   string
+		want   string
+		wantOk bool
+	}{
+		{name: "preferred", want: "example.com/a/b/c", wantOk: true},
+		{name: "shortest", want: "b", wantOk: true},
+		{name: "none", wantOk: false},
+		{name: "missing", wantOk: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := ix.CanonicalImport(label.New("", "foo", tc.name))
+			if ok != tc.wantOk {
+				t.Fatalf("got ok %v; want %v", ok, tc.wantOk)
+			}
+			if ok && got.Imp != tc.want {
+				t.Errorf("got %q; want %q", got.Imp, tc.want)
+			}
+		})
+	}
+}
+
+func TestVendorVisible(t *testing.T) {
+	for _, tc := range []struct {
+		desc, from, target string
+		want               bool
+	}{
+		{
+			desc:   "not_vendored",
+			from:   "//a:a",
+			target: "//b:b",
+			want:   true,
+		}, {
+			desc:   "root_vendor",
+			from:   "//a:a",
+			target: "//third_party/b:b",
+			want:   true,
+		}, {
+			desc:   "in_subtree",
+			from:   "//a/b:b",
+			target: "//a/third_party/c:c",
+			want:   true,
+		}, {
+			desc:   "vendor_root",
+			from:   "//a:a",
+			target: "//a/third_party/c:c",
+			want:   true,
+		}, {
+			desc:   "out_of_subtree",
+			from:   "//b:b",
+			target: "//a/third_party/c:c",
+			want:   false,
+		}, {
+			desc:   "innermost_vendor",
+			from:   "//a/third_party/b:b",
+			target: "//a/third_party/c/third_party/d:d",
+			want:   false,
+		}, {
+			desc:   "other_repo",
+			from:   "//a:a",
+			target: "@ext//third_party/c:c",
+			want:   false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			from, err := label.Parse(tc.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			target, err := label.Parse(tc.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := VendorVisible(from, target, "third_party"); got != tc.want {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnambiguousImports(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "a",
+    provides = ["one", "two"],
+)
+
+test_library(
+    name = "b",
+    provides = ["two", "also_one"],
+)
+
+test_library(
+    name = "c",
+    provides = [],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	want := []ImportSpec{
+		{Lang: "test", Imp: "also_one"},
+		{Lang: "test", Imp: "one"},
+	}
+	if got := ix.UnambiguousImports(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestInheritedImportOrder(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "top",
+    provides = ["top", "shared"],
+    embed = [":b", ":a"],
+)
+
+test_library(
+    name = "a",
+    provides = ["a", "shared", "ab"],
+    embed = [":c"],
+)
+
+test_library(
+    name = "b",
+    provides = ["b", "ab", "c"],
+)
+
+test_library(
+    name = "c",
+    provides = ["c", "a"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	r := ix.labelMap[label.New("", "foo", "top")]
+	var got []string
+	for _, imp := range r.importedAs {
+		got = append(got, imp.Imp)
+	}
+	want := []string{"top", "shared", "b", "ab", "c", "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestLangForLabel(t *testing.T) {
+	c := testConfig(t)
+	testRslv := &testResolver{name: "test"}
+	otherRslv := &testResolver{name: "other"}
+	// Rules of kind "custom_library" in package "mapped" were mapped from
+	// "test_library", so they are resolved by testRslv only there.
+	mrslv := func(r *rule.Rule, pkgRel string) Resolver {
+		if r.Kind() == "custom_library" && pkgRel == "mapped" {
+			return testRslv
+		}
+		return kindResolver(testRslv, otherRslv)(r, pkgRel)
+	}
+	ix := NewRuleIndex(mrslv)
+	addTestFiles(t, c, ix, []testFile{
+		{
+			rel: "mapped",
+			content: `
+custom_library(
+    name = "a",
+    provides = ["a"],
+)
+`,
+		}, {
+			rel: "plain",
+			content: `
+other_library(
+    name = "b",
+    provides = ["b"],
+)
+`,
+		},
+	})
+	ix.Finish()
+
+	for _, tc := range []struct {
+		label, want string
+		wantOk      bool
+	}{
+		{label: "//mapped:a", want: "test", wantOk: true},
+		{label: "//plain:b", want: "other", wantOk: true},
+		{label: "//missing:c", wantOk: false},
+	} {
+		l, err := label.Parse(tc.label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := ix.LangForLabel(l)
+		if got != tc.want || ok != tc.wantOk {
+			t.Errorf("%s: got %q, %v; want %q, %v", tc.label, got, ok, tc.want, tc.wantOk)
+		}
+	}
+	if got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: "a"}, "test")); !reflect.DeepEqual(got, []string{"//mapped:a"}) {
+		t.Errorf("FindRulesByImport for mapped kind: got %q", got)
+	}
+}
+
+func TestFindResultTags(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "foo",
+		content: `
+test_library(
+    name = "manual",
+    provides = ["x"],
+    tags = ["manual", "local"],
+)
+
+test_library(
+    name = "normal",
+    provides = ["x"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	results := ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: "x"}, "test")
+	if len(results) != 2 {
+		t.Fatalf("got %d results; want 2", len(results))
+	}
+	tags := make(map[string][]string)
+	for _, r := range results {
+		tags[r.Label.String()] = r.Tags
+	}
+	wantTags := map[string][]string{
+		"//foo:manual": {"manual", "local"},
+		"//foo:normal": nil,
+	}
+	if !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("got tags %v; want %v", tags, wantTags)
+	}
+
+	var kept []FindResult
+	for _, r := range results {
+		if !r.HasTag("manual") {
+			kept = append(kept, r)
+		}
+	}
+	if got, want := resultLabels(kept), []string{"//foo:normal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after excluding manual rules: got %q; want %q", got, want)
+	}
+}
+
+func TestEachRuleOrder(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "z",
+		content: `
+test_library(
+    name = "b",
+    provides = [],
+)
+
+test_library(
+    name = "a",
+    provides = [],
+)
+`,
+	}, {
+		rel: "m",
+		content: `
+test_library(
+    name = "c",
+    provides = [],
+)
+
+other_rule(name = "skipped")
+`,
+	}}, &testResolver{name: "test"})
+
+	for _, tc := range []struct {
+		desc  string
+		order IterOrder
+		want  []string
+	}{
+		{
+			desc:  "sorted",
+			order: SortedOrder,
+			want:  []string{"//m:c", "//z:a", "//z:b"},
+		}, {
+			desc:  "insertion",
+			order: InsertionOrder,
+			want:  []string{"//z:b", "//z:a", "//m:c"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got []string
+			ix.EachRule(tc.order, func(r *rule.Rule, l label.Label, f *rule.File) {
+				if r.Name() != l.Name || f.Pkg != l.Pkg {
+					t.Errorf("rule %s visited with label %s in file %s", r.Name(), l, f.Pkg)
+				}
+				got = append(got, l.String())
+			})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+type testRelativeResolver struct {
+	testResolver
+}
+
+func (*testRelativeResolver) ResolveRelative(imp string, from label.Label) string {
+	return path.Join(from.Pkg, imp)
+}
+
+func TestFindRulesByImportFrom(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testRelativeResolver{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "a/b/sibling",
+		content: `
+test_library(
+    name = "sibling",
+    provides = ["a/b/sibling"],
+)
+`,
+	}, {
+		rel: "a/other",
+		content: `
+test_library(
+    name = "other",
+    provides = ["a/other"],
+)
+`,
+	}}, rslv)
+
+	from := label.New("", "a/b", "lib")
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "./sibling", want: []string{"//a/b/sibling"}},
+		{imp: "../other", want: []string{"//a/other"}},
+		{imp: "a/b/sibling", want: []string{"//a/b/sibling"}},
+		{imp: "sibling", want: nil},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			results := ix.FindRulesByImportFrom(c, rslv, ImportSpec{Lang: "test", Imp: tc.imp}, "test", from)
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+
+	// Resolvers that don't implement RelativeImportResolver look up relative
+	// imports as they are.
+	plain := &testResolver{name: "test"}
+	if got := ix.FindRulesByImportFrom(c, plain, ImportSpec{Lang: "test", Imp: "./sibling"}, "test", from); len(got) != 0 {
+		t.Errorf("without RelativeImportResolver: got %q; want no results", resultLabels(got))
+	}
+}
+
+func TestRulesInPackage(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "a",
+		content: `
+test_library(
+    name = "lib",
+    provides = ["a"],
+    embed = [":embedded"],
+)
+
+test_library(
+    name = "embedded",
+    provides = ["a/embedded"],
+)
+`,
+	}, {
+		rel: "a/b",
+		content: `
+test_library(
+    name = "b",
+    provides = ["a/b"],
+)
+`,
+	}, {
+		rel: "c",
+		content: `
+test_library(
+    name = "c",
+    provides = ["c"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	for _, tc := range []struct {
+		repo, pkg    string
+		want         []string
+		wantEmbedded []bool
+	}{
+		{
+			pkg:          "a",
+			want:         []string{"//a:lib", "//a:embedded"},
+			wantEmbedded: []bool{false, true},
+		}, {
+			pkg:          "a/b",
+			want:         []string{"//a/b"},
+			wantEmbedded: []bool{false},
+		}, {
+			pkg: "missing",
+		}, {
+			repo: "other",
+			pkg:  "a",
+		},
+	} {
+		t.Run(tc.repo+"/"+tc.pkg, func(t *testing.T) {
+			results := ix.RulesInPackage(c, tc.repo, tc.pkg)
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+			var gotEmbedded []bool
+			for _, r := range results {
+				gotEmbedded = append(gotEmbedded, r.Embedded)
+			}
+			if !reflect.DeepEqual(gotEmbedded, tc.wantEmbedded) {
+				t.Errorf("embedded: got %v; want %v", gotEmbedded, tc.wantEmbedded)
+			}
+		})
+	}
+}
+
+func TestRulesInPackageNamedRepo(t *testing.T) {
+	c := testConfig(t)
+	c.RepoName = "main"
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "a",
+		content: `
+test_library(
+    name = "lib",
+    provides = ["a"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	for _, tc := range []struct {
+		repo string
+		want []string
+	}{
+		{repo: "", want: []string{"@main//a:lib"}},
+		{repo: "main", want: []string{"@main//a:lib"}},
+		{repo: "other"},
+	} {
+		t.Run(tc.repo, func(t *testing.T) {
+			if got := resultLabels(ix.RulesInPackage(c, tc.repo, "a")); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+type testEmbedsCrossResolver struct{}
+
+func (testEmbedsCrossResolver) CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	if imp != (ImportSpec{Lang: "test", Imp: "ext/lib"}) {
+		return nil
+	}
+	return []FindResult{{
+		Label:  label.New("ext", "lib", "lib"),
+		Embeds: []label.Label{label.New("ext", "lib", "lib_proto")},
+	}}
+}
+
+func TestCrossResolvedEmbedsSelfImport(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testResolver{name: "test"}
+	ix := NewRuleIndex(kindResolver(rslv), testEmbedsCrossResolver{})
+	ix.Finish()
+
+	results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "ext/lib"}, "test")
+	if len(results) != 1 {
+		t.Fatalf("got %d results; want 1", len(results))
+	}
+	res := results[0]
+	r := rule.NewRule("test_library", "lib_proto")
+	for _, tc := range []struct {
+		from string
+		want bool
+	}{
+		{from: "@ext//lib:lib_proto", want: true},
+		{from: "@ext//lib:lib", want: true},
+		{from: "@ext//lib:other", want: false},
+		{from: "//lib:lib_proto", want: false},
+	} {
+		from, err := label.Parse(tc.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ix.IsSelfImport(res, r, from); got != tc.want {
+			t.Errorf("IsSelfImport from %s: got %v; want %v", tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestDedupResultsByLabel(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testResolver{name: "test"}
+	imp := ImportSpec{Lang: "proto", Imp: "ext/lib.proto"}
+	lib := label.New("ext", "", "lib")
+	goCross := &testCrossResolver{imps: map[ImportSpec]label.Label{imp: lib}}
+	protoCross := &testCrossResolver{imps: map[ImportSpec]label.Label{imp: lib}}
+
+	for _, tc := range []struct {
+		desc string
+		opts []interface{}
+		want []string
+	}{
+		{
+			desc: "default",
+			opts: []interface{}{goCross, protoCross},
+			want: []string{"@ext//:lib", "@ext//:lib"},
+		}, {
+			desc: "dedup",
+			opts: []interface{}{goCross, protoCross, DedupResultsByLabel()},
+			want: []string{"@ext//:lib"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ix := NewRuleIndex(kindResolver(rslv), tc.opts...)
+			ix.Finish()
+			got := resultLabels(ix.FindRulesByImportWithConfig(c, imp, "go"))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+type testExpander struct {
+	testResolver
+}
+
+func (*testExpander) ExpandImport(imp ImportSpec) []ImportSpec {
+	if imp.Imp != "bundle" {
+		return nil
+	}
+	return []ImportSpec{
+		{Lang: imp.Lang, Imp: "bundle/x"},
+		{Lang: imp.Lang, Imp: "bundle/y"},
+		{Lang: imp.Lang, Imp: "bundle/z"},
+	}
+}
+
+func TestExpandImport(t *testing.T) {
+	c := testConfig(t)
+	rslv := &testExpander{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "bundle",
+		content: `
+test_library(
+    name = "x",
+    provides = ["bundle/x"],
+)
+
+test_library(
+    name = "y",
+    provides = ["bundle/y"],
+)
+
+test_library(
+    name = "z",
+    provides = ["bundle/z", "bundle/y"],
+)
+
+test_library(
+    name = "bundle",
+    provides = ["bundle"],
+)
+`,
+	}}, rslv)
+	from := label.New("", "app", "app")
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "bundle", want: []string{"//bundle:x", "//bundle:y", "//bundle:z"}},
+		{imp: "bundle/x", want: []string{"//bundle:x"}},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			results := ix.FindRulesByImportFrom(c, rslv, ImportSpec{Lang: "test", Imp: tc.imp}, "test", from)
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// slowCrossResolver resolves every import to a label in @slow after a delay.
+type slowCrossResolver struct {
+	delay time.Duration
+}
+
+func (cr slowCrossResolver) CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	time.Sleep(cr.delay)
+	return []FindResult{{Label: label.New("slow", imp.Imp, "lib")}}
+}
+
+func TestCrossResolveTimeout(t *testing.T) {
+	c := testConfig(t, "-cross_resolve_timeout=1ms")
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:cross_resolve_timeout slow/... 10s
+# gazelle:cross_resolve_timeout slow/fast 1ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	if got := crossResolveTimeoutForImport(c, ImportSpec{Lang: "test", Imp: "slow/a"}); got != 10*time.Second {
+		t.Errorf("timeout for slow/a: got %v; want 10s", got)
+	}
+	if got := crossResolveTimeoutForImport(c, ImportSpec{Lang: "test", Imp: "slow/fast"}); got != time.Millisecond {
+		t.Errorf("timeout for slow/fast: got %v; want 1ms", got)
+	}
+	if got := crossResolveTimeoutForImport(c, ImportSpec{Lang: "test", Imp: "other"}); got != time.Millisecond {
+		t.Errorf("timeout for other: got %v; want 1ms", got)
+	}
+
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), slowCrossResolver{delay: 100 * time.Millisecond})
+	ix.Finish()
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "slow/a", want: []string{"@slow//slow/a:lib"}},
+		{imp: "other", want: nil},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: tc.imp}, "test")
+			if got := resultLabels(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// configReadingCrossResolver reads c.Exts after a delay, which would race
+// with later imports being resolved if it weren't called with a copy of c.
+type configReadingCrossResolver struct {
+	delay time.Duration
+	done  chan struct{}
+}
+
+func (cr configReadingCrossResolver) CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	time.Sleep(cr.delay)
+	for range c.Exts {
+	}
+	ix.FindRulesByImport(imp, lang)
+	close(cr.done)
+	return nil
+}
+
+// contextCrossResolver blocks until its context is done.
+type contextCrossResolver struct {
+	stopped chan struct{}
+}
+
+func (cr contextCrossResolver) CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	panic("CrossResolve called instead of CrossResolveContext")
+}
+
+func (cr contextCrossResolver) CrossResolveContext(ctx context.Context, c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	<-ctx.Done()
+	close(cr.stopped)
+	return []FindResult{{Label: label.New("late", "", "lib")}}
+}
+
+// TestCrossResolveTimeoutBackground checks that CrossResolvers still running
+// after a timeout don't race with later resolution. Run with -race.
+func TestCrossResolveTimeoutBackground(t *testing.T) {
+	c := testConfig(t, "-cross_resolve_timeout=1ms", "-strict_resolve")
+	from := label.New("", "pkg", "a")
+
+	t.Run("copy_config", func(t *testing.T) {
+		cr := configReadingCrossResolver{delay: 10 * time.Millisecond, done: make(chan struct{})}
+		ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), cr)
+		ix.Finish()
+		if results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "a"}, "test"); len(results) > 0 {
+			t.Errorf("got %d results; want none", len(results))
+		}
+		for i := 0; i < 100; i++ {
+			ReportUnresolved(c, from, ImportSpec{Lang: "test", Imp: "a"}, errors.New("not found"))
+			TakeUnresolved(c)
+			time.Sleep(100 * time.Microsecond)
+		}
+		<-cr.done
+	})
+
+	t.Run("context", func(t *testing.T) {
+		cr := contextCrossResolver{stopped: make(chan struct{})}
+		ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), cr)
+		ix.Finish()
+		if results := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "a"}, "test"); len(results) > 0 {
+			t.Errorf("got %d results; want none", len(results))
+		}
+		select {
+		case <-cr.stopped:
+		case <-time.After(10 * time.Second):
+			t.Fatal("CrossResolveContext was not canceled after the timeout")
+		}
+	})
+}
+
+// pkgResolver is a testResolver whose rules provide the path of the
+// package they were loaded from, like proto_library.
+type pkgResolver struct {
+	testResolver
+}
+
+func (*pkgResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	return []ImportSpec{{Lang: "test", Imp: f.Pkg}}
+}
+
+func TestCanonicalizeSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TEMPDIR"), "resolve_symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "shared", "lib"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tree"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "shared", "lib"), filepath.Join(dir, "tree", "lib")); err != nil {
+		t.Skipf("could not create symbolic link: %v", err)
+	}
+
+	content := `
+test_library(name = "lib")
+`
+	files := []testFile{
+		{rel: "tree/lib", content: content},
+		{rel: "shared/lib", content: content},
+	}
+	for _, tc := range []struct {
+		desc string
+		args []string
+		want map[string][]string
+	}{
+		{
+			desc: "default",
+			want: map[string][]string{
+				"shared/lib": {"//shared/lib"},
+				"tree/lib":   {"//tree/lib"},
+			},
+		}, {
+			desc: "canonicalize",
+			args: []string{"-canonicalize_symlinks"},
+			want: map[string][]string{
+				"shared/lib": {"//shared/lib"},
+				"tree/lib":   {"//shared/lib"},
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := testConfig(t, tc.args...)
+			c.RepoRoot = dir
+			ix := buildTestIndex(t, c, files, &pkgResolver{testResolver{name: "test"}})
+			for imp, want := range tc.want {
+				got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: imp}, "test"))
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %q; want %q", imp, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddOverlayFile(t *testing.T) {
+	c := testConfig(t)
+	disk := []testFile{{
+		rel: "a",
+		content: `
+test_library(
+    name = "a",
+    provides = ["x"],
+)
+`,
+	}}
+	overlay := loadTestFiles(t, []testFile{{
+		rel: "a",
+		content: `
+test_library(
+    name = "a",
+    provides = ["y"],
+)
+
+test_library(
+    name = "b",
+    provides = ["z"],
+)
+`,
+	}})[0]
+
+	for _, tc := range []struct {
+		desc          string
+		overlayBefore bool
+	}{
+		{desc: "overlay_after_disk"},
+		{desc: "overlay_before_disk", overlayBefore: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}))
+			if tc.overlayBefore {
+				ix.AddOverlayFile(c, overlay)
+			}
+			addTestFiles(t, c, ix, disk)
+			if !tc.overlayBefore {
+				ix.AddOverlayFile(c, overlay)
+			}
+			ix.Finish()
+
+			for imp, want := range map[string][]string{
+				"x": nil,
+				"y": {"//a"},
+				"z": {"//a:b"},
+			} {
+				got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: imp}, "test"))
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %q; want %q", imp, got, want)
+				}
+			}
+		})
+	}
+}
+
+// embedOnlyResolver is a testResolver whose rules are only used by being
+// embedded.
+type embedOnlyResolver struct {
+	testResolver
+}
+
+func (*embedOnlyResolver) EmbedOnly() bool { return true }
+
+func TestEmbedOnly(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    embed = [":b"],
+)
+
+embed_library(
+    name = "b",
+    provides = ["b"],
+    embed = [":c"],
+)
+
+embed_library(
+    name = "c",
+)
+
+embed_library(
+    name = "unembedded",
+    provides = ["unembedded"],
+)
+`,
+	}}, &testResolver{name: "test"}, &embedOnlyResolver{testResolver{name: "embed"}})
+
+	for _, tc := range []struct {
+		imp  ImportSpec
+		want []string
+	}{
+		{imp: ImportSpec{Lang: "test", Imp: "a"}, want: []string{"//:a"}},
+		{imp: ImportSpec{Lang: "embed", Imp: "b"}, want: []string{"//:a"}},
+		{imp: ImportSpec{Lang: "embed", Imp: "unembedded"}},
+	} {
+		got := resultLabels(ix.FindRulesByImport(tc.imp, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q; want %q", tc.imp.Imp, got, tc.want)
+		}
+	}
+
+	results := ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: "a"}, "test")
+	if len(results) != 1 {
+		t.Fatalf("got %d results; want 1", len(results))
+	}
+	var embeds []string
+	for _, l := range results[0].Embeds {
+		embeds = append(embeds, l.String())
+	}
+	if want := []string{"//:b", "//:c"}; !reflect.DeepEqual(embeds, want) {
+		t.Errorf("embeds: got %q; want %q", embeds, want)
+	}
+}
+
+func TestIsSelfImportCanonical(t *testing.T) {
+	mustParse := func(s string) label.Label {
+		l, err := label.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	for _, tc := range []struct {
+		desc string
+		res  FindResult
+		from label.Label
+		want bool
+	}{
+		{
+			desc: "empty_repo_syntax",
+			res:  FindResult{Label: mustParse("@//foo:lib")},
+			from: mustParse("//foo:lib"),
+			want: true,
+		}, {
+			desc: "embed_empty_repo_syntax",
+			res:  FindResult{Label: mustParse("//foo:lib_test"), Embeds: []label.Label{mustParse("@//foo:lib")}},
+			from: label.New("", "foo", "lib"),
+			want: true,
+		}, {
+			desc: "relative_embed",
+			res:  FindResult{Label: mustParse("//foo:lib_test"), Embeds: []label.Label{mustParse(":lib")}},
+			from: mustParse("@//foo:lib"),
+			want: true,
+		}, {
+			desc: "omitted_name",
+			res:  FindResult{Label: label.New("", "foo", "")},
+			from: mustParse("@//foo"),
+			want: true,
+		}, {
+			desc: "relative_embed_other_package",
+			res:  FindResult{Label: mustParse("//foo:lib_test"), Embeds: []label.Label{mustParse(":lib")}},
+			from: mustParse("//bar:lib"),
+			want: false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := tc.res.IsSelfImport(tc.from); got != tc.want {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsLocallyResolvable(t *testing.T) {
+	c := testConfig(t)
+	cr := &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "remote"}: label.New("cross", "", "remote"),
+	}}
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), cr)
+	addTestFiles(t, c, ix, []testFile{{
+		rel: "local",
+		content: `
+test_library(
+    name = "local",
+    provides = ["local"],
+)
+`,
+	}})
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp, lang string
+		want      bool
+	}{
+		{imp: "local", lang: "test", want: true},
+		{imp: "local", lang: "other", want: false},
+		{imp: "remote", lang: "test", want: false},
+		{imp: "missing", lang: "test", want: false},
+	} {
+		if got := ix.IsLocallyResolvable(ImportSpec{Lang: "test", Imp: tc.imp}, tc.lang); got != tc.want {
+			t.Errorf("%s (%s): got %v; want %v", tc.imp, tc.lang, got, tc.want)
+		}
+	}
+	if len(ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: "remote"}, "test")) == 0 {
+		t.Errorf("remote import should be resolvable with cross resolvers")
+	}
+}
+
+func TestResolveFallbackLang(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve_fallback_lang test bindings
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	(&Configurer{}).Configure(c, "", f)
+
+	cr := &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "generated"}: label.New("cross", "", "generated"),
+		{Lang: "test", Imp: "remote"}:    label.New("cross", "", "remote"),
+	}}
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}, &testResolver{name: "bindings"}), cr)
+	addTestFiles(t, c, ix, []testFile{{
+		rel: "pkg",
+		content: `
+test_library(
+    name = "native",
+    provides = ["native"],
+)
+
+bindings_library(
+    name = "generated",
+    provides = ["generated", "native"],
+)
+`,
+	}})
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "native", want: []string{"//pkg:native"}},
+		{imp: "generated", want: []string{"//pkg:generated"}},
+		{imp: "remote", want: []string{"@cross//:remote"}},
+	} {
+		got := resultLabels(ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+}
+
+type ruleNameImporter struct {
+	testResolver
+}
+
+func (*ruleNameImporter) ImportsFromRule(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	if r.Kind() != "test_wrapper" {
+		return nil
+	}
+	return []ImportSpec{{Lang: "test", Imp: path.Join(f.Pkg, r.Name())}}
+}
+
+func TestImportsFromRule(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "wrap",
+		content: `
+test_wrapper(name = "thin")
+
+test_wrapper(
+    name = "both",
+    provides = ["explicit"],
+)
+
+test_library(name = "plain")
+`,
+	}}, &ruleNameImporter{testResolver{name: "test"}})
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "wrap/thin", want: []string{"//wrap:thin"}},
+		{imp: "wrap/both", want: []string{"//wrap:both"}},
+		{imp: "explicit", want: []string{"//wrap:both"}},
+		{imp: "wrap/plain", want: nil},
+	} {
+		got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+}
+
+func TestRemoveRulesUnder(t *testing.T) {
+	c := testConfig(t)
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}))
+	addTestFiles(t, c, ix, []testFile{
+		{rel: "old", content: `
+test_library(
+    name = "a",
+    provides = ["old/a"],
+)
+`},
+		{rel: "old/sub", content: `
+test_library(
+    name = "b",
+    provides = ["old/sub/b"],
+)
+`},
+		{rel: "older", content: `
+test_library(
+    name = "c",
+    provides = ["older/c"],
+)
+`},
+		{rel: "keep", content: `
+test_library(
+    name = "d",
+    provides = ["keep/d"],
+)
+`},
+	})
+
+	if n := ix.RemoveRulesUnder(label.New("", "old", "")); n != 2 {
+		t.Errorf("removed %d rules; want 2", n)
+	}
+	if n := ix.RemoveRulesUnder(label.New("other_repo", "", "")); n != 0 {
+		t.Errorf("removed %d rules from another repository; want 0", n)
+	}
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "old/a", want: nil},
+		{imp: "old/sub/b", want: nil},
+		{imp: "older/c", want: []string{"//older:c"}},
+		{imp: "keep/d", want: []string{"//keep:d"}},
+	} {
+		got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+	if _, ok := ix.findRuleByLabel(label.New("", "old", "a"), label.NoLabel); ok {
+		t.Errorf("//old:a is still in the label index")
+	}
+}
+
+type suffixTransformer struct {
+	testResolver
+}
+
+func (*suffixTransformer) ExpandImport(imp ImportSpec) []ImportSpec {
+	i := strings.Index(imp.Imp, "#")
+	if i < 0 {
+		return nil
+	}
+	return []ImportSpec{{Lang: imp.Lang, Imp: imp.Imp[:i]}}
+}
+
+func (*suffixTransformer) TransformResolvedLabel(imp ImportSpec, base label.Label) label.Label {
+	i := strings.Index(imp.Imp, "#")
+	if i < 0 {
+		return base
+	}
+	base.Name = base.Name + "_" + imp.Imp[i+1:]
+	return base
+}
+
+func TestTransformResolvedLabel(t *testing.T) {
+	c := testConfig(t)
+	rslv := &suffixTransformer{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "foo/bar",
+		content: `
+test_library(
+    name = "bar",
+    provides = ["foo/bar"],
+)
+`,
+	}}, rslv)
+
+	from := label.New("", "app", "app")
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "foo/bar", want: []string{"//foo/bar"}},
+		{imp: "foo/bar#grpc", want: []string{"//foo/bar:bar_grpc"}},
+		{imp: "foo/bar#proto", want: []string{"//foo/bar:bar_proto"}},
+		{imp: "missing#grpc", want: nil},
+	} {
+		got := resultLabels(ix.FindRulesByImportFrom(c, rslv, ImportSpec{Lang: "test", Imp: tc.imp}, "test", from))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+}
+
+type packageLocalResolver struct {
+	testResolver
+}
+
+func (*packageLocalResolver) PackageLocalImports() []ImportSpec {
+	return []ImportSpec{{Lang: "test", Imp: "sibling"}}
+}
+
+func TestPackageLocalImports(t *testing.T) {
+	c := testConfig(t)
+	rslv := &packageLocalResolver{testResolver{name: "test"}}
+	cr := &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "sibling"}: label.New("cross", "", "sibling"),
+	}}
+	ix := NewRuleIndex(kindResolver(rslv), cr)
+	addTestFiles(t, c, ix, []testFile{
+		{rel: "a", content: `
+test_library(
+    name = "sibling",
+    provides = ["sibling", "shared"],
+)
+`},
+		{rel: "b", content: `
+test_library(
+    name = "sibling",
+    provides = ["sibling", "shared"],
+)
+`},
+	})
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp  string
+		from label.Label
+		want []string
+	}{
+		{imp: "sibling", from: label.New("", "a", "user"), want: []string{"//a:sibling"}},
+		{imp: "sibling", from: label.New("", "b", "user"), want: []string{"//b:sibling"}},
+		{imp: "sibling", from: label.New("", "c", "user"), want: nil},
+		{imp: "shared", from: label.New("", "a", "user"), want: []string{"//a:sibling", "//b:sibling"}},
+	} {
+		got := resultLabels(ix.FindRulesByImportFrom(c, rslv, ImportSpec{Lang: "test", Imp: tc.imp}, "test", tc.from))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s from %s: got %v; want %v", tc.imp, tc.from, got, tc.want)
+		}
+	}
+}
+
+// errResolver is a testResolver that implements ResolverV2. It resolves
+// each rule by setting a "resolved" attribute and returns err.
+type errResolver struct {
+	testResolver
+	err error
+}
+
+func (er *errResolver) ResolveV2(c *config.Config, ix *RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) error {
+	r.SetAttr("resolved", true)
+	return er.err
+}
+
+func TestResolveRule(t *testing.T) {
+	c := testConfig(t)
+	ix := NewRuleIndex(kindResolver())
+	ix.Finish()
+	from := label.New("", "pkg", "lib")
+
+	r := rule.NewRule("test_library", "lib")
+	if err := ResolveRule(c, &testResolver{name: "test"}, ix, nil, r, nil, from); err != nil {
+		t.Errorf("Resolver: got error %v; want nil", err)
+	}
+
+	wantErr := errors.New("could not resolve")
+	r = rule.NewRule("test_library", "lib")
+	if err := ResolveRule(c, &errResolver{testResolver{name: "test"}, wantErr}, ix, nil, r, nil, from); err != wantErr {
+		t.Errorf("ResolverV2: got error %v; want %v", err, wantErr)
+	}
+	if r.Attr("resolved") == nil {
+		t.Error("ResolverV2: ResolveV2 was not called")
+	}
+}
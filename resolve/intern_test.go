@@ -0,0 +1,143 @@
+//go:build !purego
+// +build !purego
+
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// joinResolver is a testResolver that computes import strings with
+// path.Join, so equal strings from different rules don't share storage.
+type joinResolver struct {
+	testResolver
+}
+
+func (jr *joinResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	return []ImportSpec{{Lang: jr.name, Imp: path.Join("shared", r.AttrString("provides_file"))}}
+}
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInternImportStrings(t *testing.T) {
+	c := testConfig(t)
+	files := []testFile{
+		{rel: "a", content: `test_library(name = "a", provides_file = "x.proto")`},
+		{rel: "b", content: `test_library(name = "b", provides_file = "x.proto")`},
+	}
+	for _, tc := range []struct {
+		desc       string
+		opts       []interface{}
+		wantShared bool
+	}{
+		{desc: "default", wantShared: false},
+		{desc: "interned", opts: []interface{}{InternImportStrings()}, wantShared: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ix := NewRuleIndex(kindResolver(&joinResolver{testResolver{name: "test"}}), tc.opts...)
+			addTestFiles(t, c, ix, files)
+			ix.Finish()
+			a := ix.labelMap[label.New("", "a", "a")].importedAs[0].Imp
+			b := ix.labelMap[label.New("", "b", "b")].importedAs[0].Imp
+			if a != b {
+				t.Fatalf("got different import strings %q and %q", a, b)
+			}
+			if shared := stringData(a) == stringData(b); shared != tc.wantShared {
+				t.Errorf("got shared storage %v; want %v", shared, tc.wantShared)
+			}
+		})
+	}
+}
+
+// manyJoinResolver is a testResolver that computes an import string with
+// path.Join for each element of the provides_files attribute.
+type manyJoinResolver struct {
+	testResolver
+}
+
+func (mr *manyJoinResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	var imps []ImportSpec
+	for _, p := range r.AttrStrings("provides_files") {
+		imps = append(imps, ImportSpec{Lang: mr.name, Imp: path.Join("third_party/googleapis/google", p)})
+	}
+	return imps
+}
+
+// BenchmarkInternImportStrings builds an index of 10000 rules in 1000
+// packages. Each rule provides 10 of 100 distinct import strings, built
+// with path.Join, so each string is computed 1000 times. retained-B/op is
+// the heap still in use after the index is built and garbage is collected.
+func BenchmarkInternImportStrings(b *testing.B) {
+	const pkgs, rulesPerPkg, importsPerRule, distinct = 1000, 10, 10, 100
+	c := testConfig(b)
+	var files []*rule.File
+	for i := 0; i < pkgs; i++ {
+		f := rule.EmptyFile(fmt.Sprintf("pkg%d/BUILD.bazel", i), fmt.Sprintf("pkg%d", i))
+		for j := 0; j < rulesPerPkg; j++ {
+			r := rule.NewRule("test_library", fmt.Sprintf("r%d", j))
+			var provides []string
+			for k := 0; k < importsPerRule; k++ {
+				provides = append(provides, fmt.Sprintf("api/v%d/annotations.proto", (j*importsPerRule+k)%distinct))
+			}
+			r.SetAttr("provides_files", provides)
+			r.Insert(f)
+		}
+		files = append(files, f)
+	}
+
+	for _, bc := range []struct {
+		desc string
+		opts []interface{}
+	}{
+		{desc: "default"},
+		{desc: "interned", opts: []interface{}{InternImportStrings()}},
+	} {
+		b.Run(bc.desc, func(b *testing.B) {
+			b.ReportAllocs()
+			var retained uint64
+			for n := 0; n < b.N; n++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				ix := NewRuleIndex(kindResolver(&manyJoinResolver{testResolver{name: "test"}}), bc.opts...)
+				for _, f := range files {
+					for _, r := range f.Rules {
+						ix.AddRule(c, r, f)
+					}
+				}
+				ix.Finish()
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(ix)
+				retained += after.HeapAlloc - before.HeapAlloc
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
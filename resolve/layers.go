@@ -0,0 +1,83 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+)
+
+// layer is an architectural layer declared with the layer directive.
+// Packages in a layer may depend on packages in layers with the same or
+// lower levels.
+type layer struct {
+	name  string
+	level int
+}
+
+// layerTable maps package path prefixes to layers.
+type layerTable struct {
+	byPrefix map[string]layer
+}
+
+func (t *layerTable) add(prefix string, l layer) {
+	if t.byPrefix == nil {
+		t.byPrefix = make(map[string]layer)
+	}
+	t.byPrefix[prefix] = l
+}
+
+// find returns the layer for the package pkg, declared in pkg or the
+// closest parent directory.
+func (t *layerTable) find(pkg string) (layer, bool) {
+	var best string
+	var bestLayer layer
+	found := false
+	for prefix, l := range t.byPrefix {
+		if !pathtools.HasPrefix(pkg, prefix) {
+			continue
+		}
+		if !found || len(prefix) > len(best) {
+			best, bestLayer, found = prefix, l, true
+		}
+	}
+	return bestLayer, found
+}
+
+// CheckLayering returns an error if dep, the label imp was resolved to, is
+// in a higher layer than from, the label of the importing rule. Layers are
+// declared with the layer directive, which applies to the directory where
+// it appears and its subdirectories. Packages without a layer and labels
+// outside the main repository are not checked. Resolvers should call CheckLayering
+// for each resolved import and omit dependencies that fail the check.
+func CheckLayering(c *config.Config, imp ImportSpec, from, dep label.Label) error {
+	layers := getResolveConfig(c).layers
+	if layers == nil || !isFirstParty(c, from) || !isFirstParty(c, dep) {
+		return nil
+	}
+	fromLayer, ok := layers.find(from.Pkg)
+	if !ok {
+		return nil
+	}
+	depLayer, ok := layers.find(dep.Pkg)
+	if !ok || depLayer.level <= fromLayer.level {
+		return nil
+	}
+	return fmt.Errorf("import %q resolved to %s in layer %s (%d), but %s is in lower layer %s (%d)", imp.Imp, dep, depLayer.name, depLayer.level, from, fromLayer.name, fromLayer.level)
+}
@@ -0,0 +1,63 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestCheckLayering(t *testing.T) {
+	c := testConfig(t)
+	cr := &Configurer{}
+	root := c
+	for _, dir := range []struct {
+		rel, content string
+	}{
+		{rel: "ui", content: "# gazelle:layer ui 2"},
+		{rel: "core", content: "# gazelle:layer core 1"},
+	} {
+		f, err := rule.LoadData(dir.rel+"/BUILD.bazel", dir.rel, []byte(dir.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc := root.Clone()
+		cr.Configure(dc, dir.rel, f)
+	}
+
+	imp := ImportSpec{Lang: "go", Imp: "example.com/x"}
+	for _, tc := range []struct {
+		desc, from, dep string
+		wantErr         bool
+	}{
+		{desc: "down", from: "ui/view", dep: "core/model"},
+		{desc: "same", from: "core/a", dep: "core/b"},
+		{desc: "up", from: "core/model", dep: "ui/view", wantErr: true},
+		{desc: "unlayered", from: "tools", dep: "ui"},
+		{desc: "to_unlayered", from: "core", dep: "tools"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			from := label.New("", tc.from, "lib")
+			dep := label.New("", tc.dep, "lib")
+			err := CheckLayering(root, imp, from, dep)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("got error %v; want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
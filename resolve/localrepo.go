@@ -0,0 +1,109 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// LocalRepository is a repository in a local directory, for example, one
+// declared with local_repository, whose rules should be indexed so imports
+// may be resolved to them.
+type LocalRepository struct {
+	// Name is the name of the external repository. Rules in the repository
+	// are indexed with labels like "@Name//pkg:target".
+	Name string
+
+	// Path is the absolute path to the repository's root directory.
+	Path string
+}
+
+// parseLocalRepository parses a value of the -index_local_repository flag,
+// which has the form name=path. Relative paths are relative to repoRoot.
+func parseLocalRepository(value, repoRoot string) (LocalRepository, error) {
+	i := strings.Index(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return LocalRepository{}, fmt.Errorf("-index_local_repository %q: expected name=path", value)
+	}
+	name, dir := strings.TrimPrefix(value[:i], "@"), value[i+1:]
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repoRoot, dir)
+	}
+	return LocalRepository{Name: name, Path: dir}, nil
+}
+
+// LocalRepositories returns the repositories registered with the
+// -index_local_repository flag.
+func LocalRepositories(c *config.Config) []LocalRepository {
+	return getResolveConfig(c).localRepos
+}
+
+// IndexLocalRepositories adds the rules in build files of each repository
+// registered with -index_local_repository to ix. Rules are added with
+// a copy of c whose RepoName is the name of the repository, so their labels
+// refer to the external repository. Directories starting with "." or
+// "bazel-" are skipped. IndexLocalRepositories must be called before Finish.
+func IndexLocalRepositories(c *config.Config, ix *RuleIndex) error {
+	for _, lr := range getResolveConfig(c).localRepos {
+		if err := indexLocalRepository(c, ix, lr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexLocalRepository(c *config.Config, ix *RuleIndex, lr LocalRepository) error {
+	lc := c.Clone()
+	lc.RepoName = lr.Name
+	lc.RepoRoot = lr.Path
+	return filepath.Walk(lr.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			base := info.Name()
+			if path != lr.Path && (strings.HasPrefix(base, ".") || strings.HasPrefix(base, "bazel-")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !lc.IsValidBuildFileName(info.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(lr.Path, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		pkg := filepath.ToSlash(rel)
+		if pkg == "." {
+			pkg = ""
+		}
+		f, err := rule.LoadFile(path, pkg)
+		if err != nil {
+			return fmt.Errorf("indexing local repository %s: %v", lr.Name, err)
+		}
+		for _, r := range f.Rules {
+			ix.AddRule(lc, r, f)
+		}
+		return nil
+	})
+}
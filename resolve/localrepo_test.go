@@ -0,0 +1,122 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndexLocalRepositories(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TEMPDIR"), "resolve_local_repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for path, content := range map[string]string{
+		"WORKSPACE": "",
+		"lib/BUILD.bazel": `
+test_library(
+    name = "lib",
+    provides = ["sibling/lib"],
+)
+`,
+		"lib/sub/BUILD": `
+test_library(
+    name = "sub",
+    provides = ["sibling/lib/sub"],
+)
+`,
+		"bazel-out/BUILD.bazel": `
+test_library(
+    name = "out",
+    provides = ["sibling/out"],
+)
+`,
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := testConfig(t, "-index_local_repository=@sibling="+dir)
+	if got, want := LocalRepositories(c), []LocalRepository{{Name: "sibling", Path: dir}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LocalRepositories: got %v; want %v", got, want)
+	}
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}))
+	addTestFiles(t, c, ix, []testFile{{
+		rel: "app",
+		content: `
+test_library(
+    name = "app",
+    provides = ["app"],
+)
+`,
+	}})
+	if err := IndexLocalRepositories(c, ix); err != nil {
+		t.Fatal(err)
+	}
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "app", want: []string{"//app"}},
+		{imp: "sibling/lib", want: []string{"@sibling//lib"}},
+		{imp: "sibling/lib/sub", want: []string{"@sibling//lib/sub"}},
+		{imp: "sibling/out", want: nil},
+	} {
+		got := resultLabels(ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+}
+
+func TestParseLocalRepository(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    LocalRepository
+		wantErr bool
+	}{
+		{value: "foo=../foo", want: LocalRepository{Name: "foo", Path: filepath.Join("/root", "..", "foo")}},
+		{value: "@foo=/abs/foo", want: LocalRepository{Name: "foo", Path: "/abs/foo"}},
+		{value: "foo", wantErr: true},
+		{value: "=path", wantErr: true},
+		{value: "foo=", wantErr: true},
+	} {
+		got, err := parseLocalRepository(tc.value, "/root")
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%q: got %v; want error", tc.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+		} else if got != tc.want {
+			t.Errorf("%q: got %v; want %v", tc.value, got, tc.want)
+		}
+	}
+}
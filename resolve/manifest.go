@@ -0,0 +1,78 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// DepsManifest maps the absolute label of each resolved rule to the sorted
+// absolute labels of its dependencies. It may be used to report dependency
+// edges computed by Resolver.Resolve without writing build files.
+type DepsManifest map[string][]string
+
+// AddRule records the dependencies of r, which should already have been
+// resolved. from is the label of r. All labels in the "deps" attribute are
+// recorded, including labels in select expressions. Labels that can't be
+// parsed are ignored.
+func (m DepsManifest) AddRule(r *rule.Rule, from label.Label) {
+	deps := []string{}
+	for _, l := range RuleDeps(r, from) {
+		deps = append(deps, l.String())
+	}
+	m[from.String()] = deps
+}
+
+// Write writes the manifest to w as an indented JSON object.
+func (m DepsManifest) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// attrLabelStrings returns all string literals in the attribute named attr,
+// in the order they appear. This includes strings in lists, select
+// expressions, and concatenations of those.
+func attrLabelStrings(r *rule.Rule, attr string) []string {
+	expr := r.Attr(attr)
+	if expr == nil {
+		return nil
+	}
+	var strs []string
+	bzl.Walk(expr, func(x bzl.Expr, stk []bzl.Expr) {
+		str, ok := x.(*bzl.StringExpr)
+		if !ok {
+			return
+		}
+		if len(stk) > 0 {
+			if kv, ok := stk[len(stk)-1].(*bzl.KeyValueExpr); ok && kv.Key == x {
+				// Skip select conditions.
+				return
+			}
+		}
+		strs = append(strs, str.Value)
+	})
+	return strs
+}
@@ -0,0 +1,135 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+)
+
+// ModuleMap maps modules, identified by import path prefixes, to the
+// external repositories that provide them. It's usually generated from
+// a lock file, so that imports may be resolved without network access.
+// A module map may be loaded with -module_map or set with SetModuleMap,
+// and it's consulted by ModuleMapResolver.
+type ModuleMap struct {
+	Modules []ModuleMapEntry `json:"modules"`
+}
+
+// ModuleMapEntry describes one module in a ModuleMap.
+type ModuleMapEntry struct {
+	// Module is the import path prefix of the module.
+	Module string `json:"module"`
+
+	// Lang is the language of imports the module provides. If empty, the
+	// module may provide imports in any language.
+	Lang string `json:"lang,omitempty"`
+
+	// Repo is the name of the repository that provides the module.
+	Repo string `json:"repo"`
+
+	// Packages lists the packages in the module, relative to Module. ""
+	// is the module's root package. If Packages is empty, any import within
+	// the module is resolved.
+	Packages []string `json:"packages,omitempty"`
+
+	// Label is a template for the label of a package within Repo, as
+	// described in repo.PrefixRepoTable.Add. It defaults to "//{rel}".
+	Label string `json:"label,omitempty"`
+}
+
+// LoadModuleMap reads a ModuleMap from a JSON file.
+func LoadModuleMap(path string) (*ModuleMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &ModuleMap{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// SetModuleMap sets the module map consulted by ModuleMapResolver. It
+// replaces any map loaded with -module_map.
+func SetModuleMap(c *config.Config, m *ModuleMap) {
+	getResolveConfig(c).moduleMap = m
+}
+
+// GetModuleMap returns the module map set with -module_map or SetModuleMap,
+// or nil if there is none.
+func GetModuleMap(c *config.Config) *ModuleMap {
+	return getResolveConfig(c).moduleMap
+}
+
+// ModuleMapResolver is a CrossResolver that resolves imports using the
+// module map in the configuration. The module with the longest import path
+// prefix matching an import is chosen. Gazelle gives ModuleMapResolver
+// precedence over other CrossResolvers, and since results from the index
+// are used before any network lookups, a module map can resolve external
+// imports without network access.
+type ModuleMapResolver struct{}
+
+var _ CrossResolver = ModuleMapResolver{}
+
+func (ModuleMapResolver) CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult {
+	m := GetModuleMap(c)
+	if m == nil {
+		return nil
+	}
+	var best *ModuleMapEntry
+	for i := range m.Modules {
+		e := &m.Modules[i]
+		if e.Lang != "" && e.Lang != imp.Lang {
+			continue
+		}
+		if !pathtools.HasPrefix(imp.Imp, e.Module) {
+			continue
+		}
+		if best == nil || len(e.Module) > len(best.Module) {
+			best = e
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	if len(best.Packages) > 0 {
+		rel := pathtools.TrimPrefix(imp.Imp, best.Module)
+		found := false
+		for _, p := range best.Packages {
+			if p == rel {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	var t repo.PrefixRepoTable
+	t.Add(best.Module, best.Repo, best.Label)
+	l, ok := t.Resolve(imp.Imp)
+	if !ok {
+		return nil
+	}
+	return []FindResult{{Label: l}}
+}
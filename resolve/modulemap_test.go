@@ -0,0 +1,69 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestModuleMapResolver(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TEMPDIR"), "resolve_module_map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mapPath := filepath.Join(dir, "modules.json")
+	if err := ioutil.WriteFile(mapPath, []byte(`{
+  "modules": [
+    {"module": "example.com/mod", "repo": "com_example_mod", "label": "//{rel}:go_default_library"},
+    {"module": "example.com/mod/v2", "repo": "com_example_mod_v2", "label": "//{rel}:go_default_library", "packages": ["", "api"]},
+    {"module": "example.com/data", "lang": "proto", "repo": "com_example_data", "label": "//{rel}:{base}_proto"}
+  ]
+}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c := testConfig(t, "-module_map="+mapPath)
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), ModuleMapResolver{})
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp  ImportSpec
+		want []string
+	}{
+		{imp: ImportSpec{Lang: "go", Imp: "example.com/mod"}, want: []string{"@com_example_mod//:go_default_library"}},
+		{imp: ImportSpec{Lang: "go", Imp: "example.com/mod/sub/pkg"}, want: []string{"@com_example_mod//sub/pkg:go_default_library"}},
+		{imp: ImportSpec{Lang: "go", Imp: "example.com/mod/v2/api"}, want: []string{"@com_example_mod_v2//api:go_default_library"}},
+		{imp: ImportSpec{Lang: "go", Imp: "example.com/mod/v2/missing"}, want: nil},
+		{imp: ImportSpec{Lang: "proto", Imp: "example.com/data/types"}, want: []string{"@com_example_data//types:types_proto"}},
+		{imp: ImportSpec{Lang: "go", Imp: "example.com/data/types"}, want: nil},
+		{imp: ImportSpec{Lang: "go", Imp: "example.com/other"}, want: nil},
+	} {
+		got := resultLabels(ix.FindRulesByImportWithConfig(c, tc.imp, "test"))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+
+	SetModuleMap(c, nil)
+	if got := ix.FindRulesByImportWithConfig(c, ImportSpec{Lang: "go", Imp: "example.com/mod"}, "test"); len(got) > 0 {
+		t.Errorf("without a module map: got %v; want no results", got)
+	}
+}
@@ -0,0 +1,55 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "strings"
+
+// ImportNormalizer is an optional interface that a Resolver may implement
+// when different import strings in its language refer to the same thing,
+// for example, when package paths are case-insensitive. Imports of rules
+// handled by the resolver are normalized before they are indexed, and
+// imports looked up with the resolver's name as lang are normalized before
+// they are looked up, so equivalent import strings find the same rules.
+//
+// Normalization only affects index keys. Import strings returned by methods
+// like CanonicalImport are the ones returned by Imports.
+type ImportNormalizer interface {
+	// NormalizeImportComponents returns the normalized form of imp.
+	// NormalizeImportComponents must be idempotent.
+	NormalizeImportComponents(imp string) string
+}
+
+// normalizeImport normalizes imp with the ImportNormalizer for the resolver
+// named lang, if there is one.
+func (ix *RuleIndex) normalizeImport(imp ImportSpec, lang string) ImportSpec {
+	if n, ok := ix.importNormalizers[lang]; ok {
+		imp.Imp = n.NormalizeImportComponents(imp.Imp)
+	}
+	return imp
+}
+
+// FoldPackageCase returns imp with the package components, everything before
+// the last occurrence of sep, converted to lower case. The final component,
+// which usually names a symbol or target, keeps its case. Resolvers for
+// languages with case-insensitive package paths may use this to implement
+// ImportNormalizer.
+func FoldPackageCase(imp, sep string) string {
+	i := strings.LastIndex(imp, sep)
+	if i < 0 {
+		return imp
+	}
+	return strings.ToLower(imp[:i]) + imp[i:]
+}
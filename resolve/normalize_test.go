@@ -0,0 +1,80 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+)
+
+type packageCaseResolver struct {
+	testResolver
+}
+
+func (*packageCaseResolver) NormalizeImportComponents(imp string) string {
+	return FoldPackageCase(imp, ".")
+}
+
+func TestFoldPackageCase(t *testing.T) {
+	for _, tc := range []struct {
+		imp, want string
+	}{
+		{imp: "Com.Example.Widget", want: "com.example.Widget"},
+		{imp: "com.example.Widget", want: "com.example.Widget"},
+		{imp: "Widget", want: "Widget"},
+		{imp: "", want: ""},
+	} {
+		if got := FoldPackageCase(tc.imp, "."); got != tc.want {
+			t.Errorf("FoldPackageCase(%q): got %q; want %q", tc.imp, got, tc.want)
+		}
+	}
+}
+
+func TestImportNormalizer(t *testing.T) {
+	c := testConfig(t)
+	rslv := &packageCaseResolver{testResolver{name: "test"}}
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "widget",
+		content: `
+test_library(
+    name = "widget",
+    provides = ["Com.Example.Widget"],
+)
+`,
+	}}, rslv)
+
+	for _, tc := range []struct {
+		imp  string
+		want []string
+	}{
+		{imp: "Com.Example.Widget", want: []string{"//widget"}},
+		{imp: "com.example.Widget", want: []string{"//widget"}},
+		{imp: "COM.EXAMPLE.Widget", want: []string{"//widget"}},
+		{imp: "com.example.widget", want: nil},
+		{imp: "Com.Example.WIDGET", want: nil},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			got := resultLabels(ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	if imp, ok := ix.CanonicalImport(ix.rules[0].label); !ok || imp.Imp != "Com.Example.Widget" {
+		t.Errorf("CanonicalImport: got %v, %v; want the import string returned by Imports", imp, ok)
+	}
+}
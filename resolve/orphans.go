@@ -0,0 +1,95 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// OrphanDeps returns the dependencies in the "deps" attribute of existing,
+// a rule in a build file before resolved attributes are merged into it,
+// that are not dependencies of resolved, the generated rule with the same
+// name after its imports were resolved. These are usually stale dependencies
+// that were added by hand. Dependencies with "# keep" comments, and all
+// dependencies of rules with "# keep" comments, are not orphans.
+// from is the label of both rules.
+func OrphanDeps(existing, resolved *rule.Rule, from label.Label) []label.Label {
+	expr := existing.Attr("deps")
+	if expr == nil || existing.ShouldKeep() {
+		return nil
+	}
+	needed := make(map[label.Label]bool)
+	for _, l := range RuleDeps(resolved, from) {
+		needed[l] = true
+	}
+	seen := make(map[label.Label]bool)
+	var orphans []label.Label
+	bzl.Walk(expr, func(x bzl.Expr, stk []bzl.Expr) {
+		str, ok := x.(*bzl.StringExpr)
+		if !ok || rule.ShouldKeep(x) {
+			return
+		}
+		if len(stk) > 0 {
+			if kv, ok := stk[len(stk)-1].(*bzl.KeyValueExpr); ok && kv.Key == x {
+				// Skip select conditions.
+				return
+			}
+		}
+		l, err := label.Parse(str.Value)
+		if err != nil {
+			return
+		}
+		l = l.Abs(from.Repo, from.Pkg)
+		if !needed[l] && !seen[l] {
+			seen[l] = true
+			orphans = append(orphans, l)
+		}
+	})
+	sortLabels(orphans)
+	return orphans
+}
+
+// CheckOrphanDeps reports the orphan dependencies of existing, as returned
+// by OrphanDeps, when -check_orphan_deps is set. Gazelle calls it for each
+// generated rule that matches a rule in an existing build file. Orphans are
+// logged as warnings; in -strict_resolve mode, an error is returned instead.
+func CheckOrphanDeps(c *config.Config, existing, resolved *rule.Rule, from label.Label) error {
+	rc := getResolveConfig(c)
+	if !rc.checkOrphanDeps {
+		return nil
+	}
+	orphans := OrphanDeps(existing, resolved, from)
+	if len(orphans) == 0 {
+		return nil
+	}
+	strs := make([]string, len(orphans))
+	for i, l := range orphans {
+		strs[i] = l.String()
+	}
+	err := fmt.Errorf("%s: dependencies not needed by any import: %s", from, strings.Join(strs, ", "))
+	if rc.strict {
+		return err
+	}
+	log.Printf("warning: %v", err)
+	return nil
+}
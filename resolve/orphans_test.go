@@ -0,0 +1,84 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestOrphanDeps(t *testing.T) {
+	f, err := rule.LoadData("pkg/BUILD.bazel", "pkg", []byte(`
+test_library(
+    name = "a",
+    deps = [
+        ":local",
+        "//needed",
+        "//stale",
+        "//manual",  # keep
+    ] + select({
+        "@platforms//os:linux": ["//stale/linux"],
+        "//conditions:default": [],
+    }),
+)
+
+# keep
+test_library(
+    name = "kept",
+    deps = ["//stale"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := rule.NewRule("test_library", "a")
+	resolved.SetAttr("deps", []string{"//needed", ":local"})
+	from := label.New("", "pkg", "a")
+
+	got := OrphanDeps(f.Rules[0], resolved, from)
+	want := []label.Label{label.New("", "stale", "stale"), label.New("", "stale/linux", "linux")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got := OrphanDeps(f.Rules[1], rule.NewRule("test_library", "kept"), label.New("", "pkg", "kept")); len(got) > 0 {
+		t.Errorf("kept rule: got %v; want no orphans", got)
+	}
+
+	if err := CheckOrphanDeps(testConfig(t), f.Rules[0], resolved, from); err != nil {
+		t.Errorf("check disabled: got error %v", err)
+	}
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	if err := CheckOrphanDeps(testConfig(t, "-check_orphan_deps"), f.Rules[0], resolved, from); err != nil {
+		t.Errorf("warning mode: got error %v", err)
+	}
+	if !strings.Contains(logBuf.String(), "//pkg:a: dependencies not needed by any import: //stale, //stale/linux") {
+		t.Errorf("warning mode: unexpected log %q", logBuf.String())
+	}
+	err = CheckOrphanDeps(testConfig(t, "-check_orphan_deps", "-strict_resolve"), f.Rules[0], resolved, from)
+	if err == nil || strings.Contains(err.Error(), "//manual") {
+		t.Errorf("strict mode: got error %v; want an error without kept dependencies", err)
+	}
+}
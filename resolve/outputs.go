@@ -0,0 +1,67 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"log"
+	"path"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// OutputDeclarer is an optional interface that a Resolver may implement to
+// declare the files its rules generate, so that imports of generated files
+// can be resolved to the rules that produce them with
+// RuleIndex.FindRuleByOutput. Rules with outputs are indexed even if
+// Imports returns nil.
+type OutputDeclarer interface {
+	// Outputs returns the paths of files generated by r, relative to the
+	// directory of the build file that declares r, for example, the values
+	// of its "outs" attribute.
+	Outputs(r *rule.Rule) []string
+}
+
+func (ix *RuleIndex) buildOutputIndex() {
+	ix.outputMap = make(map[string]*ruleRecord)
+	for _, r := range ix.rules {
+		od, ok := ix.mrslv(r.rule, r.file.Pkg).(OutputDeclarer)
+		if !ok {
+			continue
+		}
+		for _, out := range od.Outputs(r.rule) {
+			p := path.Join(r.label.Pkg, out)
+			if other, ok := ix.outputMap[p]; ok && other != r {
+				log.Printf("multiple rules produce %s: %s and %s", p, other.label, r.label)
+				continue
+			}
+			ix.outputMap[p] = r
+		}
+	}
+}
+
+// FindRuleByOutput returns the rule that produces the file at p, a path
+// relative to the repository root, as declared by OutputDeclarer. If several
+// rules declare the same output, the first one added to the index is
+// returned. False is returned if no indexed rule produces p.
+//
+// FindRuleByOutput may only be called after Finish.
+func (ix *RuleIndex) FindRuleByOutput(p string) (FindResult, bool) {
+	r, ok := ix.outputMap[path.Clean(p)]
+	if !ok {
+		return FindResult{}, false
+	}
+	return r.findResult(), true
+}
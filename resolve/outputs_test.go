@@ -0,0 +1,81 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// outputResolver is a testResolver whose rules generate the files listed in
+// their "outs" attribute.
+type outputResolver struct {
+	testResolver
+}
+
+func (*outputResolver) Outputs(r *rule.Rule) []string {
+	return r.AttrStrings("outs")
+}
+
+func TestFindRuleByOutput(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "gen",
+		content: `
+test_codegen(
+    name = "headers",
+    outs = ["api.h", "sub/types.h"],
+)
+
+test_codegen(
+    name = "lib",
+    provides = ["lib"],
+    outs = ["lib.h"],
+)
+
+test_codegen(
+    name = "nothing",
+)
+`,
+	}}, &outputResolver{testResolver{name: "test"}})
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{path: "gen/api.h", want: "//gen:headers"},
+		{path: "gen/sub/types.h", want: "//gen:headers"},
+		{path: "gen/./lib.h", want: "//gen:lib"},
+		{path: "api.h"},
+		{path: "gen/missing.h"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			r, ok := ix.FindRuleByOutput(tc.path)
+			if tc.want == "" {
+				if ok {
+					t.Errorf("got %s; want no match", r.Label)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("got no match; want %s", tc.want)
+			}
+			if got := r.Label.String(); got != tc.want {
+				t.Errorf("got %s; want %s", got, tc.want)
+			}
+		})
+	}
+}
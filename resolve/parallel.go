@@ -0,0 +1,116 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// Parallelism returns an option that lets AddFiles and Finish use up to n
+// goroutines. With n > 1, the function passed to NewRuleIndex and the
+// Imports, ImportsFromRule, Embeds, and other indexing methods of resolvers
+// may be called concurrently, so they must not modify shared state. The
+// contents of the index don't depend on n. By default, n is 1.
+func Parallelism(n int) IndexOption {
+	return func(ix *RuleIndex) {
+		ix.parallelism = n
+	}
+}
+
+// SetIndexParallelism applies the value of -index_parallelism to ix, as
+// Parallelism does. A value less than 1 means runtime.GOMAXPROCS(0).
+// SetIndexParallelism must be called before rules are added to ix.
+func SetIndexParallelism(c *config.Config, ix *RuleIndex) {
+	n := getResolveConfig(c).indexParallelism
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	Parallelism(n)(ix)
+}
+
+// parallelFor calls f for each integer in [0, n), using up to the number
+// of goroutines set with Parallelism. It returns after all calls return.
+func (ix *RuleIndex) parallelFor(n int, f func(i int)) {
+	workers := ix.parallelism
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	next := int64(-1)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// IndexedFile is a build file to be added with AddFiles, together with the
+// configuration for its directory.
+type IndexedFile struct {
+	Config *config.Config
+	File   *rule.File
+}
+
+// AddFiles adds the rules in each file to the index, like calling AddRule
+// for each rule in order. Files are indexed concurrently if Parallelism
+// was set, but rules are added in order, so the index is the same as if
+// AddRule were called. AddRule and AddFiles must not be called concurrently.
+//
+// AddFiles may only be called before Finish.
+func (ix *RuleIndex) AddFiles(files []IndexedFile) {
+	type indexedRule struct {
+		rslv Resolver
+		info cachedRule
+	}
+	keys := make([]string, len(files))
+	indexed := make([][]indexedRule, len(files))
+	ix.parallelFor(len(files), func(i int) {
+		c, f := files[i].Config, files[i].File
+		if ix.cache != nil {
+			keys[i] = cacheFileKey(c, f)
+		}
+		indexed[i] = make([]indexedRule, len(f.Rules))
+		for j, r := range f.Rules {
+			indexed[i][j].rslv, indexed[i][j].info = ix.ruleIndexInfo(c, r, f, keys[i])
+		}
+	})
+	for i, file := range files {
+		for j, r := range file.File.Rules {
+			ir := indexed[i][j]
+			ix.insertRule(file.Config, r, file.File, false, ir.rslv, ir.info, keys[i])
+		}
+	}
+}
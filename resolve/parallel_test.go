@@ -0,0 +1,99 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParallelIndex(t *testing.T) {
+	c := testConfig(t)
+	var files []testFile
+	var imps []string
+	for i := 0; i < 50; i++ {
+		var b strings.Builder
+		fmt.Fprintf(&b, `
+test_library(
+    name = "lib",
+    provides = ["lib%[1]d", "shared"],
+    embed = [":embedded"],
+)
+
+test_library(
+    name = "embedded",
+    provides = ["embedded%[1]d"],
+)
+`, i)
+		if i > 0 {
+			fmt.Fprintf(&b, `
+test_library(
+    name = "wrapper",
+    embed = ["//p%d:lib"],
+)
+`, i-1)
+		}
+		files = append(files, testFile{rel: fmt.Sprintf("p%d", i), content: b.String()})
+		imps = append(imps, fmt.Sprintf("lib%d", i), fmt.Sprintf("embedded%d", i))
+	}
+	imps = append(imps, "shared")
+
+	lookup := func(ix *RuleIndex) map[string][]string {
+		got := make(map[string][]string)
+		for _, imp := range imps {
+			for _, r := range ix.FindRulesByImport(ImportSpec{Lang: "test", Imp: imp}, "test") {
+				got[imp] = append(got[imp], fmt.Sprintf("%s%v", r.Label, r.Embeds))
+			}
+		}
+		return got
+	}
+	want := lookup(buildTestIndex(t, c, files, &testResolver{name: "test"}))
+
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), Parallelism(8))
+	var indexed []IndexedFile
+	for _, f := range loadTestFiles(t, files) {
+		indexed = append(indexed, IndexedFile{Config: c, File: f})
+	}
+	ix.AddFiles(indexed)
+	ix.Finish()
+	if got := lookup(ix); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if got := len(want["shared"]); got != 50 {
+		t.Errorf("got %d rules providing shared; want 50", got)
+	}
+}
+
+func TestSetIndexParallelism(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{want: 1},
+		{args: []string{"-index_parallelism=4"}, want: 4},
+		{args: []string{"-index_parallelism=0"}, want: runtime.GOMAXPROCS(0)},
+	} {
+		c := testConfig(t, tc.args...)
+		ix := NewRuleIndex(nil)
+		SetIndexParallelism(c, ix)
+		if ix.parallelism != tc.want {
+			t.Errorf("%v: got parallelism %d; want %d", tc.args, ix.parallelism, tc.want)
+		}
+	}
+}
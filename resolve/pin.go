@@ -0,0 +1,60 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// breakTies narrows down ambiguous results for imp. A rule named by
+// a pin_import directive in scope is preferred, followed by rules in the
+// same source root as the importing package, followed by rules passed to
+// SetChangedLabels.
+func (ix *RuleIndex) breakTies(c *config.Config, imp ImportSpec, results []FindResult) []FindResult {
+	if pinned, ok := pinnedResult(c, imp, results); ok {
+		return []FindResult{pinned}
+	}
+	return ix.preferChanged(ix.preferSourceRoot(c, results))
+}
+
+// pinnedResult returns the result whose label was pinned for imp with
+// a pin_import directive in the current directory or a parent. Pins only
+// break ties, so false is returned unless there are several results.
+func pinnedResult(c *config.Config, imp ImportSpec, results []FindResult) (FindResult, bool) {
+	if len(results) < 2 {
+		return FindResult{}, false
+	}
+	pin, ok := getResolveConfig(c).pins[imp]
+	if !ok {
+		return FindResult{}, false
+	}
+	for _, r := range results {
+		if sameTarget(c, r.Label, pin) {
+			return r, true
+		}
+	}
+	return FindResult{}, false
+}
+
+// sameTarget returns whether two absolute labels name the same target,
+// treating the empty repository name and c.RepoName as the main repository.
+func sameTarget(c *config.Config, a, b label.Label) bool {
+	if isFirstParty(c, a) && isFirstParty(c, b) {
+		a.Repo, b.Repo = "", ""
+	}
+	return a.Equal(b)
+}
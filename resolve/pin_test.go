@@ -0,0 +1,76 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestPinImport(t *testing.T) {
+	root := testConfig(t)
+	root.RepoName = "main"
+	cr := &Configurer{}
+	cr.Configure(root, "", nil)
+
+	pinned := root.Clone()
+	f, err := rule.LoadData("consumer/BUILD.bazel", "consumer", []byte(`
+# gazelle:pin_import test dup //a:target
+# gazelle:pin_import test unique //b:target
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.Configure(pinned, "consumer", f)
+	nested := pinned.Clone()
+	cr.Configure(nested, "consumer/nested", nil)
+
+	ix := buildTestIndex(t, root, []testFile{
+		{rel: "a", content: `
+test_library(
+    name = "target",
+    provides = ["dup", "unique"],
+)
+`},
+		{rel: "b", content: `
+test_library(
+    name = "target",
+    provides = ["dup"],
+)
+`},
+	}, &testResolver{name: "test"})
+
+	for _, tc := range []struct {
+		desc, imp string
+		c         *config.Config
+		want      []string
+	}{
+		{desc: "out_of_scope", imp: "dup", c: root, want: []string{"@main//a:target", "@main//b:target"}},
+		{desc: "in_scope", imp: "dup", c: pinned, want: []string{"@main//a:target"}},
+		{desc: "subdirectory", imp: "dup", c: nested, want: []string{"@main//a:target"}},
+		{desc: "unambiguous", imp: "unique", c: pinned, want: []string{"@main//a:target"}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := resultLabels(ix.FindRulesByImportWithConfig(tc.c, ImportSpec{Lang: "test", Imp: tc.imp}, "test"))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
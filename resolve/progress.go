@@ -0,0 +1,53 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+// Phases of Finish reported to the function passed to OnProgress.
+const (
+	// ProgressEmbeds is reported while embedded rules are collected.
+	ProgressEmbeds = "embeds"
+
+	// ProgressImports is reported while the import index is built.
+	ProgressImports = "imports"
+)
+
+// progressInterval is the number of rules processed between calls to the
+// function passed to OnProgress.
+const progressInterval = 1000
+
+// OnProgress returns an option that causes Finish to call f periodically
+// while it runs, so that drivers can show progress on large indexes. phase
+// is ProgressEmbeds or ProgressImports; phases are reported in that order.
+// done is the number of rules processed so far in the phase, and total is
+// the number of rules in the index. Within a phase, done increases with
+// each call, and the last call has done == total. f is called from the
+// goroutine that called Finish.
+func OnProgress(f func(phase string, done, total int)) IndexOption {
+	return func(ix *RuleIndex) {
+		ix.progress = f
+	}
+}
+
+// reportProgress calls the function passed to OnProgress after every
+// progressInterval rules and after the last rule.
+func (ix *RuleIndex) reportProgress(phase string, done int) {
+	if ix.progress == nil {
+		return
+	}
+	if total := len(ix.rules); done%progressInterval == 0 || done == total {
+		ix.progress(phase, done, total)
+	}
+}
@@ -0,0 +1,55 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestOnProgress(t *testing.T) {
+	const n = 2*progressInterval + 5
+	c := testConfig(t)
+	type call struct {
+		phase       string
+		done, total int
+	}
+	var calls []call
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "test"}), OnProgress(func(phase string, done, total int) {
+		calls = append(calls, call{phase, done, total})
+	}))
+	f := rule.EmptyFile("BUILD.bazel", "")
+	for i := 0; i < n; i++ {
+		r := rule.NewRule("test_library", fmt.Sprintf("r%d", i))
+		r.SetAttr("provides", []string{fmt.Sprintf("imp%d", i)})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	var want []call
+	for _, phase := range []string{ProgressEmbeds, ProgressImports} {
+		want = append(want,
+			call{phase, progressInterval, n},
+			call{phase, 2 * progressInterval, n},
+			call{phase, n, n})
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got %v; want %v", calls, want)
+	}
+}
@@ -0,0 +1,55 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// Version is the Gazelle version recorded in provenance comments written
+// with -annotate_provenance. It may be set at link time with
+// -ldflags "-X github.com/bazelbuild/bazel-gazelle/resolve.Version=...".
+var Version = "unknown"
+
+// provenancePrefix starts each provenance comment. It must not start with
+// "# gazelle:", since that would be read as a directive.
+const provenancePrefix = "# Dependencies resolved by Gazelle "
+
+// AnnotateProvenance writes a comment before r naming the Gazelle version
+// and the time dependencies were resolved, when -annotate_provenance is set.
+// A provenance comment written by an earlier run is replaced, so repeated
+// runs don't add more comments. Rules with "# keep" comments are not
+// modified. Gazelle calls AnnotateProvenance for each generated rule after
+// resolved attributes have been merged into its build file.
+func AnnotateProvenance(c *config.Config, r *rule.Rule) {
+	rc := getResolveConfig(c)
+	if !rc.annotateProvenance || r.ShouldKeep() {
+		return
+	}
+	var comments []string
+	for _, tok := range r.Comments() {
+		if !strings.HasPrefix(tok, provenancePrefix) {
+			comments = append(comments, tok)
+		}
+	}
+	comments = append(comments, fmt.Sprintf("%s%s at %s", provenancePrefix, Version, rc.provenanceTime.Format(time.RFC3339)))
+	r.SetComments(comments)
+}
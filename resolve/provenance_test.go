@@ -0,0 +1,80 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestAnnotateProvenance(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# A library.
+go_library(name = "a")
+
+# keep
+go_library(name = "b")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(t, "-annotate_provenance")
+	rc := getResolveConfig(c)
+	oldVersion := Version
+	defer func() { Version = oldVersion }()
+
+	Version = "0.1.0"
+	rc.provenanceTime = time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, r := range f.Rules {
+		AnnotateProvenance(c, r)
+	}
+	want := `# A library.
+# Dependencies resolved by Gazelle 0.1.0 at 2019-01-02T03:04:05Z
+go_library(name = "a")
+
+# keep
+go_library(name = "b")
+`
+	if got := string(f.Format()); got != want {
+		t.Errorf("first run: got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A second run replaces the comment instead of adding another.
+	f, err = rule.LoadData("BUILD.bazel", "", f.Format())
+	if err != nil {
+		t.Fatal(err)
+	}
+	Version = "0.2.0"
+	rc.provenanceTime = time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, r := range f.Rules {
+		AnnotateProvenance(c, r)
+	}
+	want = strings.Replace(want, "0.1.0 at 2019-01-02T03:04:05Z", "0.2.0 at 2019-02-03T04:05:06Z", 1)
+	if got := string(f.Format()); got != want {
+		t.Errorf("second run: got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without the flag, rules are not annotated.
+	c = testConfig(t)
+	r := rule.NewRule("go_library", "c")
+	AnnotateProvenance(c, r)
+	if got := r.Comments(); len(got) != 0 {
+		t.Errorf("without -annotate_provenance: got comments %q", got)
+	}
+}
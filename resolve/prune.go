@@ -0,0 +1,94 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// PruneRedundantDeps removes direct dependencies of r that are already
+// provided by another direct dependency, since they are in the transitive
+// closure of rules it embeds. from is the label of r. The pruned labels are
+// returned in the order they appeared.
+//
+// Pruning is conservative. Only a plain list of strings in the "deps"
+// attribute is considered; deps expressed with select or concatenation are
+// left alone. A dependency is only pruned if both it and the dependency that
+// embeds it are rules in ix, and the two rules don't embed each other.
+// Dependencies marked with "# keep" are never pruned.
+//
+// PruneRedundantDeps may only be called after Finish.
+func PruneRedundantDeps(ix *RuleIndex, r *rule.Rule, from label.Label) []label.Label {
+	list, ok := r.Attr("deps").(*bzl.ListExpr)
+	if !ok {
+		return nil
+	}
+
+	records := make([]*ruleRecord, len(list.List))
+	for i, e := range list.List {
+		s, ok := e.(*bzl.StringExpr)
+		if !ok {
+			continue
+		}
+		l, err := label.Parse(s.Value)
+		if err != nil {
+			continue
+		}
+		if rec, ok := ix.labelMap[l.Abs(from.Repo, from.Pkg)]; ok {
+			records[i] = rec
+		}
+	}
+
+	embeds := func(r, e *ruleRecord) bool {
+		for _, l := range r.embeds {
+			if l.Equal(e.label) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept []bzl.Expr
+	var pruned []label.Label
+	for i, e := range list.List {
+		redundant := false
+		if rec := records[i]; rec != nil && !rule.ShouldKeep(e) {
+			for j, other := range records {
+				if j != i && other != nil && other != rec && embeds(other, rec) && !embeds(rec, other) {
+					redundant = true
+					break
+				}
+			}
+		}
+		if redundant {
+			pruned = append(pruned, records[i].label)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	if len(kept) == 0 {
+		r.DelAttr("deps")
+	} else {
+		list.List = kept
+		r.SetAttr("deps", list)
+	}
+	return pruned
+}
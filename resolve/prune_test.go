@@ -0,0 +1,105 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestPruneRedundantDeps(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "a",
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    embed = ["//b"],
+)
+`,
+	}, {
+		rel: "b",
+		content: `
+test_library(
+    name = "b",
+    provides = ["b"],
+)
+`,
+	}, {
+		rel: "c",
+		content: `
+test_library(
+    name = "c",
+    provides = ["c"],
+)
+`,
+	}}, &testResolver{name: "test"})
+	from := label.New("", "pkg", "x")
+
+	for _, tc := range []struct {
+		desc, deps string
+		want       []string
+		wantPruned []string
+	}{
+		{
+			desc:       "redundant",
+			deps:       `["//a", "//b", "//c"]`,
+			want:       []string{"//a", "//c"},
+			wantPruned: []string{"//b"},
+		}, {
+			desc: "not_redundant",
+			deps: `["//b", "//c"]`,
+			want: []string{"//b", "//c"},
+		}, {
+			desc: "keep",
+			deps: `[
+        "//a",
+        "//b",  # keep
+    ]`,
+			want: []string{"//a", "//b"},
+		}, {
+			desc: "not_indexed",
+			deps: `["//a", "@ext//b"]`,
+			want: []string{"//a", "@ext//b"},
+		}, {
+			desc: "select",
+			deps: `["//a"] + select({"//conditions:default": ["//b"]})`,
+			want: []string{"//a", "//b"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			f, err := rule.LoadData("pkg/BUILD.bazel", "pkg", []byte("test_binary(\n    name = \"x\",\n    deps = "+tc.deps+",\n)\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := f.Rules[0]
+			var gotPruned []string
+			for _, l := range PruneRedundantDeps(ix, r, from) {
+				gotPruned = append(gotPruned, l.String())
+			}
+			if !reflect.DeepEqual(gotPruned, tc.wantPruned) {
+				t.Errorf("pruned: got %q; want %q", gotPruned, tc.wantPruned)
+			}
+			if got := attrLabelStrings(r, "deps"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("deps: got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// QuarantineLabel returns a placeholder label for imp, an import that
+// couldn't be resolved, in the package named with -quarantine_package.
+// The label's name is MangleImport(imp.Imp), so the same import always has
+// the same label, and a separate tool can create the placeholder targets.
+// False is returned if -quarantine_package is not set.
+//
+// Resolvers should call QuarantineLabel before reporting an import as
+// unresolved with ReportUnresolved. If a label is returned, the resolver
+// should add a dependency on it instead of reporting the import.
+func QuarantineLabel(c *config.Config, imp ImportSpec) (label.Label, bool) {
+	pkg := getResolveConfig(c).quarantinePkg
+	if pkg == "" {
+		return label.NoLabel, false
+	}
+	return label.New("", pkg, MangleImport(imp.Imp)), true
+}
+
+// MangleImport converts an import string into a valid target name. Letters,
+// digits, "-", and "." are kept, "/" is replaced with "_", and every other
+// byte (including "_" and "~") is replaced with "~" and two upper case hex
+// digits. Distinct import strings always have distinct names. Names that
+// would only contain dots, which Bazel doesn't allow, are escaped entirely.
+func MangleImport(imp string) string {
+	if strings.Trim(imp, ".") == "" {
+		var b strings.Builder
+		for i := 0; i < len(imp); i++ {
+			fmt.Fprintf(&b, "~%02X", imp[i])
+		}
+		if b.Len() == 0 {
+			return "~"
+		}
+		return b.String()
+	}
+	var b strings.Builder
+	for i := 0; i < len(imp); i++ {
+		switch ch := imp[i]; {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9', ch == '-', ch == '.':
+			b.WriteByte(ch)
+		case ch == '/':
+			b.WriteByte('_')
+		default:
+			fmt.Fprintf(&b, "~%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestMangleImport(t *testing.T) {
+	for _, tc := range []struct {
+		imp, want string
+	}{
+		{imp: "github.com/x/y", want: "github.com_x_y"},
+		{imp: "github.com/x/y-z/v2", want: "github.com_x_y-z_v2"},
+		{imp: "@scope/pkg", want: "~40scope_pkg"},
+		{imp: "a_b", want: "a~5Fb"},
+		{imp: "a/b", want: "a_b"},
+		{imp: "100~", want: "100~7E"},
+		{imp: "foo bar:baz", want: "foo~20bar~3Abaz"},
+		{imp: "../up", want: ".._up"},
+		{imp: "..", want: "~2E~2E"},
+		{imp: ".", want: "~2E"},
+		{imp: "", want: "~"},
+		{imp: "café", want: "caf~C3~A9"},
+	} {
+		if got := MangleImport(tc.imp); got != tc.want {
+			t.Errorf("MangleImport(%q): got %q; want %q", tc.imp, got, tc.want)
+		}
+		if _, err := label.Parse("//quarantine:" + MangleImport(tc.imp)); err != nil {
+			t.Errorf("MangleImport(%q) is not a valid target name: %v", tc.imp, err)
+		}
+	}
+
+	// Import strings that differ only in characters that are replaced must
+	// still have different names.
+	seen := make(map[string]string)
+	for _, imp := range []string{"a/b", "a_b", "a~5Fb", "a~2Fb", "a.b", "a-b", "a b"} {
+		m := MangleImport(imp)
+		if other, ok := seen[m]; ok {
+			t.Errorf("%q and %q both mangle to %q", imp, other, m)
+		}
+		seen[m] = imp
+	}
+}
+
+func TestQuarantineLabel(t *testing.T) {
+	imp := ImportSpec{Lang: "go", Imp: "example.com/missing/pkg"}
+	if l, ok := QuarantineLabel(testConfig(t), imp); ok {
+		t.Errorf("without -quarantine_package: got %s", l)
+	}
+	for _, arg := range []string{"quarantine/deps", "//quarantine/deps"} {
+		c := testConfig(t, "-quarantine_package="+arg)
+		l, ok := QuarantineLabel(c, imp)
+		if want := "//quarantine/deps:example.com_missing_pkg"; !ok || l.String() != want {
+			t.Errorf("-quarantine_package=%s: got %s, %v; want %s", arg, l, ok, want)
+		}
+	}
+}
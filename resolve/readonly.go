@@ -0,0 +1,118 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// ReadOnlyIndex is a view of a finished RuleIndex that exposes only methods
+// that don't modify the index. Since lookups don't modify the index, a view
+// may be shared by several goroutines, as long as nothing modifies the
+// underlying index at the same time.
+//
+// Methods behave like the RuleIndex methods with the same names. Methods
+// that hand out mutable rules, like EachRule, are not included.
+type ReadOnlyIndex interface {
+	FindRulesByImport(imp ImportSpec, lang string) []FindResult
+	FindRulesByImportWithConfig(c *config.Config, imp ImportSpec, lang string) []FindResult
+	FindRulesByImportFrom(c *config.Config, rslv Resolver, imp ImportSpec, lang string, from label.Label) []FindResult
+	FindRulesByImportInGroup(imp ImportSpec, lang, group string) []FindResult
+	FindRuleByLabel(l label.Label) (FindResult, bool)
+	FindRuleByAttr(attr, value string) []FindResult
+	FindRuleByOutput(p string) (FindResult, bool)
+	FindNearestProvider(imp ImportSpec, lang string, from label.Label) (FindResult, bool)
+	IsLocallyResolvable(imp ImportSpec, lang string) bool
+	CanonicalImport(l label.Label) (ImportSpec, bool)
+	UnambiguousImports() []ImportSpec
+	SuggestImport(imp ImportSpec, lang string, maxDistance int) []ImportSpec
+	LangForLabel(l label.Label) (string, bool)
+	RulesInPackage(c *config.Config, repo, pkg string) []FindResult
+	Hash() uint64
+}
+
+// ReadOnly returns a read-only view of ix. It should be called after
+// Finish. The view can't be converted back to a *RuleIndex.
+func (ix *RuleIndex) ReadOnly() ReadOnlyIndex {
+	return readOnlyIndex{ix: ix}
+}
+
+// readOnlyIndex wraps a RuleIndex so that callers of ReadOnly can't reach
+// its mutating methods with a type assertion.
+type readOnlyIndex struct {
+	ix *RuleIndex
+}
+
+func (v readOnlyIndex) FindRulesByImport(imp ImportSpec, lang string) []FindResult {
+	return v.ix.FindRulesByImport(imp, lang)
+}
+
+func (v readOnlyIndex) FindRulesByImportWithConfig(c *config.Config, imp ImportSpec, lang string) []FindResult {
+	return v.ix.FindRulesByImportWithConfig(c, imp, lang)
+}
+
+func (v readOnlyIndex) FindRulesByImportFrom(c *config.Config, rslv Resolver, imp ImportSpec, lang string, from label.Label) []FindResult {
+	return v.ix.FindRulesByImportFrom(c, rslv, imp, lang, from)
+}
+
+func (v readOnlyIndex) FindRulesByImportInGroup(imp ImportSpec, lang, group string) []FindResult {
+	return v.ix.FindRulesByImportInGroup(imp, lang, group)
+}
+
+func (v readOnlyIndex) FindRuleByLabel(l label.Label) (FindResult, bool) {
+	return v.ix.FindRuleByLabel(l)
+}
+
+func (v readOnlyIndex) FindRuleByAttr(attr, value string) []FindResult {
+	return v.ix.FindRuleByAttr(attr, value)
+}
+
+func (v readOnlyIndex) FindRuleByOutput(p string) (FindResult, bool) {
+	return v.ix.FindRuleByOutput(p)
+}
+
+func (v readOnlyIndex) FindNearestProvider(imp ImportSpec, lang string, from label.Label) (FindResult, bool) {
+	return v.ix.FindNearestProvider(imp, lang, from)
+}
+
+func (v readOnlyIndex) IsLocallyResolvable(imp ImportSpec, lang string) bool {
+	return v.ix.IsLocallyResolvable(imp, lang)
+}
+
+func (v readOnlyIndex) CanonicalImport(l label.Label) (ImportSpec, bool) {
+	return v.ix.CanonicalImport(l)
+}
+
+func (v readOnlyIndex) UnambiguousImports() []ImportSpec {
+	return v.ix.UnambiguousImports()
+}
+
+func (v readOnlyIndex) SuggestImport(imp ImportSpec, lang string, maxDistance int) []ImportSpec {
+	return v.ix.SuggestImport(imp, lang, maxDistance)
+}
+
+func (v readOnlyIndex) LangForLabel(l label.Label) (string, bool) {
+	return v.ix.LangForLabel(l)
+}
+
+func (v readOnlyIndex) RulesInPackage(c *config.Config, repo, pkg string) []FindResult {
+	return v.ix.RulesInPackage(c, repo, pkg)
+}
+
+func (v readOnlyIndex) Hash() uint64 {
+	return v.ix.Hash()
+}
@@ -0,0 +1,85 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestReadOnly(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		rel: "pkg",
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+)
+
+test_library(
+    name = "b",
+    provides = ["b"],
+)
+`,
+	}}, &testResolver{name: "test"})
+	view := ix.ReadOnly()
+
+	// The view must not expose methods that modify the index, even through
+	// a type assertion.
+	if _, ok := view.(*RuleIndex); ok {
+		t.Fatal("read-only view is a *RuleIndex")
+	}
+	if _, ok := view.(interface {
+		AddRule(c *config.Config, r *rule.Rule, f *rule.File)
+	}); ok {
+		t.Fatal("read-only view has an AddRule method")
+	}
+	if _, ok := view.(interface{ Finish() }); ok {
+		t.Fatal("read-only view has a Finish method")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, imp := range []string{"a", "b"} {
+				spec := ImportSpec{Lang: "test", Imp: imp}
+				got := view.FindRulesByImportWithConfig(c, spec, "test")
+				if want := ix.FindRulesByImportWithConfig(c, spec, "test"); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %v; want %v", imp, got, want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if res, ok := view.FindRuleByLabel(label.New("", "pkg", "a")); !ok || res.Label != label.New("", "pkg", "a") {
+		t.Errorf("FindRuleByLabel: got %v, %v; want //pkg:a", res, ok)
+	}
+	if _, ok := view.FindRuleByLabel(label.New("", "pkg", "missing")); ok {
+		t.Errorf("FindRuleByLabel: found a rule that isn't indexed")
+	}
+	if got, want := view.Hash(), ix.Hash(); got != want {
+		t.Errorf("Hash: got %d; want %d", got, want)
+	}
+}
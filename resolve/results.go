@@ -0,0 +1,139 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// PreferByBasename returns a copy of results, reordered so that results
+// whose package base name equals the last path segment of imp come first.
+// The relative order of results is otherwise preserved. This may be used
+// by resolvers to break ties between rules in different packages that
+// provide the same import.
+func PreferByBasename(results []FindResult, imp string) []FindResult {
+	base := path.Base(imp)
+	sorted := make([]FindResult, 0, len(results))
+	var rest []FindResult
+	for _, r := range results {
+		if path.Base(r.Label.Pkg) == base {
+			sorted = append(sorted, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+	return append(sorted, rest...)
+}
+
+// FindNearestProvider returns the rule providing imp whose package shares
+// the longest path prefix with the package of from, measured in whole path
+// components. Rules in a different repository than from share no prefix.
+// Ties are broken by choosing the label that sorts first. False is returned
+// if no rule provides imp.
+func (ix *RuleIndex) FindNearestProvider(imp ImportSpec, lang string, from label.Label) (FindResult, bool) {
+	var best FindResult
+	bestLen := -1
+	for _, r := range ix.FindRulesByImport(imp, lang) {
+		n := 0
+		if r.Label.Repo == from.Repo {
+			n = commonPathPrefixLen(r.Label.Pkg, from.Pkg)
+		}
+		if n > bestLen || n == bestLen && r.Label.String() < best.Label.String() {
+			best = r
+			bestLen = n
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// commonPathPrefixLen returns the number of leading path components a and b
+// have in common.
+func commonPathPrefixLen(a, b string) int {
+	if a == "" || b == "" {
+		return 0
+	}
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return n
+}
+
+// MergeFindResults returns the union of several sets of results, for
+// example, from lookups of different forms of the same import. Results are
+// returned in the order each label first appears. When a label appears more
+// than once, its results are merged: Embeds and Tags are the union of the
+// values of each result, in the order they first appear, Embedded is true
+// if it's true for any result, and Load is the first non-nil Load. The input
+// slices are not modified.
+func MergeFindResults(sets ...[]FindResult) []FindResult {
+	var merged []FindResult
+	index := make(map[label.Label]int)
+	for _, set := range sets {
+		for _, r := range set {
+			i, ok := index[r.Label]
+			if !ok {
+				index[r.Label] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+			m := &merged[i]
+			m.Embeds = unionLabels(m.Embeds, r.Embeds)
+			m.Tags = unionStrings(m.Tags, r.Tags)
+			m.Embedded = m.Embedded || r.Embedded
+			if m.Load == nil {
+				m.Load = r.Load
+			}
+		}
+	}
+	return merged
+}
+
+// unionLabels returns a new slice containing the labels in a followed by
+// the labels in b that aren't in a, without duplicates.
+func unionLabels(a, b []label.Label) []label.Label {
+	seen := make(map[label.Label]bool)
+	var union []label.Label
+	for _, ls := range [][]label.Label{a, b} {
+		for _, l := range ls {
+			if !seen[l] {
+				seen[l] = true
+				union = append(union, l)
+			}
+		}
+	}
+	return union
+}
+
+// unionStrings is like unionLabels, but for strings.
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool)
+	var union []string
+	for _, ss := range [][]string{a, b} {
+		for _, s := range ss {
+			if !seen[s] {
+				seen[s] = true
+				union = append(union, s)
+			}
+		}
+	}
+	return union
+}
@@ -0,0 +1,146 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestPreferByBasename(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		results []FindResult
+		imp     string
+		want    []string
+	}{
+		{
+			desc: "basename_second",
+			results: []FindResult{
+				{Label: label.New("", "x/impl", "lib")},
+				{Label: label.New("", "y/foo", "lib")},
+			},
+			imp:  "example.com/foo",
+			want: []string{"//y/foo:lib", "//x/impl:lib"},
+		}, {
+			desc: "basename_first",
+			results: []FindResult{
+				{Label: label.New("", "y/foo", "lib")},
+				{Label: label.New("", "x/impl", "lib")},
+			},
+			imp:  "example.com/foo",
+			want: []string{"//y/foo:lib", "//x/impl:lib"},
+		}, {
+			desc: "no_match",
+			results: []FindResult{
+				{Label: label.New("", "b", "lib")},
+				{Label: label.New("", "a", "lib")},
+			},
+			imp:  "example.com/foo",
+			want: []string{"//b:lib", "//a:lib"},
+		}, {
+			desc: "stable",
+			results: []FindResult{
+				{Label: label.New("", "a", "lib")},
+				{Label: label.New("", "x/foo", "lib")},
+				{Label: label.New("", "b", "lib")},
+				{Label: label.New("", "y/foo", "lib")},
+			},
+			imp:  "foo",
+			want: []string{"//x/foo:lib", "//y/foo:lib", "//a:lib", "//b:lib"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := resultLabels(PreferByBasename(tc.results, tc.imp)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFindNearestProvider(t *testing.T) {
+	c := testConfig(t)
+	lib := `
+test_library(
+    name = "lib",
+    provides = ["x"],
+)
+`
+	ix := buildTestIndex(t, c, []testFile{
+		{rel: "common", content: lib},
+		{rel: "team_a", content: lib},
+		{rel: "team_a/sub/deep", content: lib},
+		{rel: "team_b/p", content: lib},
+		{rel: "team_b/q", content: lib},
+	}, &testResolver{name: "test"})
+
+	for _, tc := range []struct {
+		from, want string
+		wantOk     bool
+	}{
+		{from: "//team_a/sub/deep/app:app", want: "//team_a/sub/deep:lib", wantOk: true},
+		{from: "//team_a/sub/other:app", want: "//team_a/sub/deep:lib", wantOk: true},
+		{from: "//team_a:app", want: "//team_a/sub/deep:lib", wantOk: true}, // tie broken by label
+		{from: "//team_b:app", want: "//team_b/p:lib", wantOk: true},
+		{from: "//team_b/r:app", want: "//team_b/p:lib", wantOk: true},
+		{from: "//unrelated:app", want: "//common:lib", wantOk: true},
+		{from: "@other//team_a/sub/deep:app", want: "//common:lib", wantOk: true},
+	} {
+		t.Run(tc.from, func(t *testing.T) {
+			from, err := label.Parse(tc.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := ix.FindNearestProvider(ImportSpec{Lang: "test", Imp: "x"}, "test", from)
+			if ok != tc.wantOk || got.Label.String() != tc.want {
+				t.Errorf("got %s, %v; want %s, %v", got.Label, ok, tc.want, tc.wantOk)
+			}
+		})
+	}
+
+	if _, ok := ix.FindNearestProvider(ImportSpec{Lang: "test", Imp: "missing"}, "test", label.New("", "a", "a")); ok {
+		t.Errorf("missing import: got ok; want not ok")
+	}
+}
+
+func TestMergeFindResults(t *testing.T) {
+	a := label.New("", "a", "a")
+	b := label.New("", "b", "b")
+	c := label.New("", "c", "c")
+	exact := []FindResult{
+		{Label: a},
+		{Label: b, Tags: []string{"manual"}},
+	}
+	expanded := []FindResult{
+		{Label: c},
+		{Label: a, Embeds: []label.Label{c}, Tags: []string{"x"}},
+		{Label: b, Tags: []string{"manual", "y"}, Embedded: true},
+	}
+	got := MergeFindResults(exact, nil, expanded)
+	want := []FindResult{
+		{Label: a, Embeds: []label.Label{c}, Tags: []string{"x"}},
+		{Label: b, Tags: []string{"manual", "y"}, Embedded: true},
+		{Label: c},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+	if len(exact[1].Tags) != 1 {
+		t.Errorf("input was modified: %#v", exact[1])
+	}
+}
@@ -0,0 +1,76 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "github.com/bazelbuild/bazel-gazelle/label"
+
+// ReverseDeps returns the sorted labels of rules that depend on the rule
+// with label l. A rule depends on l if l is in the "deps" attribute of the
+// indexed rule, including labels in select expressions, or if a dependency
+// on l was recorded with RecordResolvedDeps. l must be absolute, and it's
+// compared with labels written in "deps" after they're made absolute.
+//
+// Only indexed rules are checked for "deps" attributes, so rules that
+// can't be imported, like binaries and tests, are only found if their
+// dependencies were recorded with RecordResolvedDeps. Gazelle records
+// dependencies of each rule it resolves.
+//
+// ReverseDeps may only be called after Finish.
+func (ix *RuleIndex) ReverseDeps(l label.Label) []label.Label {
+	l = canonicalLabel(l, l)
+	seen := make(map[label.Label]bool)
+	for from := range ix.importers[l] {
+		seen[from] = true
+	}
+	for _, r := range ix.rules {
+		if seen[r.label] {
+			continue
+		}
+		for _, dep := range RuleDeps(r.rule, r.label) {
+			if canonicalLabel(dep, r.label) == l {
+				seen[r.label] = true
+				break
+			}
+		}
+	}
+	delete(seen, l)
+	froms := make([]label.Label, 0, len(seen))
+	for from := range seen {
+		froms = append(froms, from)
+	}
+	sortLabels(froms)
+	return froms
+}
+
+// FindRulesImporting returns the sorted labels of rules that depend on any
+// rule that provides imp in the index, as reported by ReverseDeps. lang is
+// the language of the importing rules, as for FindRulesByImport.
+//
+// FindRulesImporting may only be called after Finish.
+func (ix *RuleIndex) FindRulesImporting(imp ImportSpec, lang string) []label.Label {
+	seen := make(map[label.Label]bool)
+	var froms []label.Label
+	for _, res := range ix.FindRulesByImport(imp, lang) {
+		for _, from := range ix.ReverseDeps(res.Label) {
+			if !seen[from] {
+				seen[from] = true
+				froms = append(froms, from)
+			}
+		}
+	}
+	sortLabels(froms)
+	return froms
+}
@@ -0,0 +1,92 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestReverseDeps(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{
+		{
+			rel: "foo",
+			content: `
+test_library(
+    name = "bar",
+    provides = ["foo/bar"],
+)
+`,
+		}, {
+			rel: "a",
+			content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+    deps = ["//foo:bar"],
+)
+
+test_library(
+    name = "local",
+    provides = ["a/local"],
+    deps = select({
+        "//conditions:default": [":a"],
+        "@io_bazel_rules_go//go/platform:linux": ["//foo:bar"],
+    }),
+)
+`,
+		}, {
+			rel: "b",
+			content: `
+test_library(
+    name = "b",
+    provides = ["b"],
+    deps = ["//a"],
+)
+`,
+		},
+	}, &testResolver{name: "test"})
+	// Binaries aren't indexed, but their resolved dependencies are recorded.
+	ix.RecordResolvedDeps(label.New("", "cmd", "tool"), []label.Label{label.New("", "foo", "bar")})
+
+	for _, tc := range []struct {
+		l    label.Label
+		want []string
+	}{
+		{l: label.New("", "foo", "bar"), want: []string{"//a", "//a:local", "//cmd:tool"}},
+		{l: label.New("", "a", "a"), want: []string{"//a:local", "//b"}},
+		{l: label.New("", "b", "b"), want: nil},
+	} {
+		var got []string
+		for _, l := range ix.ReverseDeps(tc.l) {
+			got = append(got, l.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ReverseDeps(%s): got %v; want %v", tc.l, got, tc.want)
+		}
+	}
+
+	var got []string
+	for _, l := range ix.FindRulesImporting(ImportSpec{Lang: "test", Imp: "foo/bar"}, "test") {
+		got = append(got, l.String())
+	}
+	if want := []string{"//a", "//a:local", "//cmd:tool"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindRulesImporting: got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"log"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// DefaultRuleOverrideAttr is the name of the attribute read by RuleOverride
+// unless the rule_override_attr directive names another one.
+const DefaultRuleOverrideAttr = "gazelle_deps_override"
+
+// ruleOverridesKey is a private attribute that holds overrides copied from
+// an existing rule with CopyRuleOverrides, as a map[string]string.
+const ruleOverridesKey = "_gazelle_rule_overrides"
+
+// RuleOverride returns the label that imp should be resolved to for r,
+// according to r's override attribute. The attribute is named with the
+// rule_override_attr directive, or DefaultRuleOverrideAttr by default. It
+// must be a dict that maps import strings to labels, like:
+//
+//	go_library(
+//	    name = "server",
+//	    gazelle_deps_override = {"github.com/x/y": "//vendor:y"},
+//	)
+//
+// Overrides only apply to the rule that declares them, and they take
+// precedence over resolve directives and the index, so resolvers should
+// call RuleOverride before anything else. from is the label of r; relative
+// labels are resolved against it. Overrides copied from an existing rule
+// with CopyRuleOverrides are consulted if r doesn't have the attribute.
+func RuleOverride(c *config.Config, r *rule.Rule, imp ImportSpec, from label.Label) (label.Label, bool) {
+	overrides, ok := r.PrivateAttr(ruleOverridesKey).(map[string]string)
+	if !ok {
+		overrides = readRuleOverrides(c, r)
+	}
+	s, ok := overrides[imp.Imp]
+	if !ok {
+		return label.NoLabel, false
+	}
+	l, err := label.Parse(s)
+	if err != nil {
+		log.Printf("%s: %s: %q: %v", from, getResolveConfig(c).ruleOverrideAttr, imp.Imp, err)
+		return label.NoLabel, false
+	}
+	return l.Abs(from.Repo, from.Pkg), true
+}
+
+// CopyRuleOverrides copies the overrides declared in the override attribute
+// of existing, a rule in a build file, to r, the generated rule with the
+// same name, so that RuleOverride finds them when r is resolved. Generated
+// rules don't have override attributes; merging keeps the attribute on the
+// existing rule. Gazelle calls CopyRuleOverrides before resolving each
+// generated rule that matches an existing rule.
+func CopyRuleOverrides(c *config.Config, existing, r *rule.Rule) {
+	if existing == nil {
+		return
+	}
+	if overrides := readRuleOverrides(c, existing); overrides != nil {
+		r.SetPrivateAttr(ruleOverridesKey, overrides)
+	}
+}
+
+// readRuleOverrides returns the string entries of r's override attribute,
+// or nil if r doesn't have one. Entries with keys or values that aren't
+// strings are skipped.
+func readRuleOverrides(c *config.Config, r *rule.Rule) map[string]string {
+	attr := getResolveConfig(c).ruleOverrideAttr
+	if attr == "" {
+		return nil
+	}
+	dict, ok := r.Attr(attr).(*bzl.DictExpr)
+	if !ok {
+		return nil
+	}
+	overrides := make(map[string]string)
+	for _, e := range dict.List {
+		kv, ok := e.(*bzl.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		k, kok := kv.Key.(*bzl.StringExpr)
+		v, vok := kv.Value.(*bzl.StringExpr)
+		if !kok || !vok {
+			continue
+		}
+		overrides[k.Value] = v.Value
+	}
+	return overrides
+}
@@ -0,0 +1,90 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestRuleOverride(t *testing.T) {
+	f, err := rule.LoadData("pkg/BUILD.bazel", "pkg", []byte(`
+# gazelle:rule_override_attr my_overrides
+
+x_library(
+    name = "a",
+    my_overrides = {
+        "example.com/y": "//vendor:y",
+        "example.com/local": ":local",
+    },
+)
+
+x_library(
+    name = "b",
+    gazelle_deps_override = {"example.com/y": "//other:y"},
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(t)
+	cr := &Configurer{}
+	cr.Configure(c, "pkg", f)
+	a, b := f.Rules[0], f.Rules[1]
+	fromA := label.New("", "pkg", "a")
+	fromB := label.New("", "pkg", "b")
+
+	for _, tc := range []struct {
+		desc string
+		r    *rule.Rule
+		from label.Label
+		imp  string
+		want string
+	}{
+		{desc: "absolute", r: a, from: fromA, imp: "example.com/y", want: "//vendor:y"},
+		{desc: "relative", r: a, from: fromA, imp: "example.com/local", want: "//pkg:local"},
+		{desc: "missing", r: a, from: fromA, imp: "example.com/z"},
+		{desc: "other_attr", r: b, from: fromB, imp: "example.com/y"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			l, ok := RuleOverride(c, tc.r, ImportSpec{Lang: "x", Imp: tc.imp}, tc.from)
+			if tc.want == "" {
+				if ok {
+					t.Errorf("got %s; want no override", l)
+				}
+				return
+			}
+			if !ok || l.String() != tc.want {
+				t.Errorf("got %s, %v; want %s", l, ok, tc.want)
+			}
+		})
+	}
+
+	// Overrides are copied from existing rules to generated rules, and only
+	// to the rule with the same name.
+	genA := rule.NewRule("x_library", "a")
+	genB := rule.NewRule("x_library", "b")
+	CopyRuleOverrides(c, a, genA)
+	CopyRuleOverrides(c, b, genB)
+	if l, ok := RuleOverride(c, genA, ImportSpec{Lang: "x", Imp: "example.com/y"}, fromA); !ok || l.String() != "//vendor:y" {
+		t.Errorf("copied override: got %s, %v; want //vendor:y", l, ok)
+	}
+	if l, ok := RuleOverride(c, genB, ImportSpec{Lang: "x", Imp: "example.com/y"}, fromB); ok {
+		t.Errorf("rule without overrides: got %s; want no override", l)
+	}
+}
@@ -0,0 +1,52 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+// ShadowLanguages returns an option that marks rules indexed by the named
+// resolvers as shadow rules. Shadow rules are indexed so they can be
+// queried with FindShadowRulesByImport, for example, to produce reports,
+// but they are never returned by FindRulesByImport or the lookup methods
+// built on it, so they can't contribute dependencies to generated rules.
+// Shadow rules don't embed or export ordinary rules, and ordinary rules
+// don't embed or export shadow rules.
+func ShadowLanguages(langs ...string) IndexOption {
+	return func(ix *RuleIndex) {
+		if ix.shadowLangs == nil {
+			ix.shadowLangs = make(map[string]bool)
+		}
+		for _, lang := range langs {
+			ix.shadowLangs[lang] = true
+		}
+	}
+}
+
+// IsShadowLanguage returns true if rules indexed by the resolver named lang
+// are shadow rules. See ShadowLanguages.
+func (ix *RuleIndex) IsShadowLanguage(lang string) bool {
+	return ix.shadowLangs[lang]
+}
+
+// FindShadowRulesByImport is like FindRulesByImport, but it only returns
+// shadow rules, indexed by the resolvers named with ShadowLanguages.
+// Indexes added with WithFallback and CrossResolvers are not consulted.
+func (ix *RuleIndex) FindShadowRulesByImport(imp ImportSpec, lang string) []FindResult {
+	matches := ix.findRecordsInMap(ix.shadowImportMap, ix.normalizeImport(imp, lang), lang)
+	results := make([]FindResult, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, m.findResult())
+	}
+	return ix.dedup(results)
+}
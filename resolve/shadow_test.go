@@ -0,0 +1,91 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShadowLanguages(t *testing.T) {
+	c := testConfig(t)
+	ix := NewRuleIndex(kindResolver(&testResolver{name: "a"}, &testResolver{name: "s"}), ShadowLanguages("s"))
+	addTestFiles(t, c, ix, []testFile{{
+		rel: "pkg",
+		content: `
+a_library(
+    name = "lib",
+    provides = ["lib"],
+)
+
+s_library(
+    name = "report",
+    provides = ["report"],
+    embed = [":s_inner"],
+)
+
+s_library(
+    name = "s_inner",
+    provides = ["inner"],
+)
+
+s_library(
+    name = "s_wrapper",
+    embed = [":lib"],
+)
+`,
+	}})
+	ix.Finish()
+
+	if !ix.IsShadowLanguage("s") || ix.IsShadowLanguage("a") {
+		t.Errorf("IsShadowLanguage: got s=%v, a=%v; want true, false", ix.IsShadowLanguage("s"), ix.IsShadowLanguage("a"))
+	}
+	for _, tc := range []struct {
+		desc             string
+		imp              ImportSpec
+		lang             string
+		want, wantShadow []string
+	}{
+		{
+			desc:       "ordinary",
+			imp:        ImportSpec{Lang: "a", Imp: "lib"},
+			lang:       "a",
+			want:       []string{"//pkg:lib"},
+			wantShadow: nil,
+		}, {
+			desc:       "shadow",
+			imp:        ImportSpec{Lang: "s", Imp: "report"},
+			lang:       "s",
+			want:       nil,
+			wantShadow: []string{"//pkg:report"},
+		}, {
+			desc:       "shadow_embed",
+			imp:        ImportSpec{Lang: "s", Imp: "inner"},
+			lang:       "s",
+			want:       nil,
+			wantShadow: []string{"//pkg:report"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := resultLabels(ix.FindRulesByImportWithConfig(c, tc.imp, tc.lang)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FindRulesByImportWithConfig: got %v; want %v", got, tc.want)
+			}
+			if got := resultLabels(ix.FindShadowRulesByImport(tc.imp, tc.lang)); !reflect.DeepEqual(got, tc.wantShadow) {
+				t.Errorf("FindShadowRulesByImport: got %v; want %v", got, tc.wantShadow)
+			}
+		})
+	}
+}
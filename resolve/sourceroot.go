@@ -0,0 +1,76 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+// SourceRoot returns the repository-relative path of the source root that
+// contains the directory c was configured for. Source roots are marked with
+// the source_root directive; the nearest marked directory at or above the
+// current directory is returned. "" is returned if no directory is marked,
+// which means the repository root is the source root.
+func SourceRoot(c *config.Config) string {
+	return getResolveConfig(c).sourceRoot
+}
+
+// SourceRootRel returns rel, a repository-relative directory path, relative
+// to the source root that contains it, as returned by SourceRoot. c should
+// be configured for rel. Resolvers for languages whose import paths are
+// relative to a source root may use this to compute import specs in
+// Imports. The top of a source root is "".
+func SourceRootRel(c *config.Config, rel string) string {
+	root := SourceRoot(c)
+	if root == "" {
+		return rel
+	}
+	if rel == root {
+		return ""
+	}
+	return strings.TrimPrefix(rel, root+"/")
+}
+
+// preferSourceRoot returns the results for rules in the same source root
+// as the directory c was configured for. If there are none, results are
+// returned unchanged. Rules are looked up in ix and indexes added with
+// WithFallback; rules that aren't found are treated as being outside any
+// source root.
+func (ix *RuleIndex) preferSourceRoot(c *config.Config, results []FindResult) []FindResult {
+	if len(results) < 2 {
+		return results
+	}
+	root := SourceRoot(c)
+	var same []FindResult
+	for _, r := range results {
+		recordRoot := ""
+		for cur := ix; cur != nil; cur = cur.fallback {
+			if rec, ok := cur.labelMap[r.Label]; ok {
+				recordRoot = rec.sourceRoot
+				break
+			}
+		}
+		if recordRoot == root {
+			same = append(same, r)
+		}
+	}
+	if len(same) == 0 {
+		return results
+	}
+	return same
+}
@@ -0,0 +1,100 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// rootResolver indexes each rule by its package path relative to its
+// source root.
+type rootResolver struct {
+	testResolver
+}
+
+func (rr *rootResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	return []ImportSpec{{Lang: rr.name, Imp: SourceRootRel(c, f.Pkg)}}
+}
+
+func TestSourceRoots(t *testing.T) {
+	root := testConfig(t)
+	cr := &Configurer{}
+	cr.Configure(root, "", nil)
+
+	// configs maps directory paths to configurations, built the same way
+	// Gazelle builds them while walking the repository.
+	configs := map[string]*config.Config{"": root}
+	configure := func(rel, content string) *config.Config {
+		parent := path.Dir(rel)
+		if parent == "." {
+			parent = ""
+		}
+		c := configs[parent].Clone()
+		var f *rule.File
+		if content != "" {
+			var err error
+			f, err = rule.LoadData(path.Join(rel, "BUILD.bazel"), rel, []byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		cr.Configure(c, rel, f)
+		configs[rel] = c
+		return c
+	}
+	configure("a", "# gazelle:source_root")
+	configure("b", "# gazelle:source_root")
+	for _, rel := range []string{"a/lib", "a/app", "b/lib", "b/app", "lib", "app"} {
+		configure(rel, "")
+	}
+
+	rr := &rootResolver{testResolver{name: "x"}}
+	ix := NewRuleIndex(kindResolver(rr))
+	for _, rel := range []string{"a/lib", "b/lib"} {
+		f, err := rule.LoadData(path.Join(rel, "BUILD.bazel"), rel, []byte(`x_library(name = "lib")`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix.AddRule(configs[rel], f.Rules[0], f)
+	}
+	ix.Finish()
+
+	if got, want := SourceRootRel(configs["a/lib"], "a/lib"), "lib"; got != want {
+		t.Errorf("SourceRootRel: got %q; want %q", got, want)
+	}
+	if got, want := SourceRoot(configs["b/app"]), "b"; got != want {
+		t.Errorf("SourceRoot: got %q; want %q", got, want)
+	}
+
+	imp := ImportSpec{Lang: "x", Imp: "lib"}
+	for _, tc := range []struct {
+		from string
+		want []string
+	}{
+		{from: "a/app", want: []string{"//a/lib"}},
+		{from: "b/app", want: []string{"//b/lib"}},
+		{from: "app", want: []string{"//a/lib", "//b/lib"}},
+	} {
+		if got := resultLabels(ix.FindRulesByImportWithConfig(configs[tc.from], imp, "x")); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("from %s: got %v; want %v", tc.from, got, tc.want)
+		}
+	}
+}
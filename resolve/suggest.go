@@ -0,0 +1,142 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSuggestDistance is the maximum edit distance used by
+// RuleIndex.ReportUnresolved when suggesting similar imports.
+const DefaultSuggestDistance = 2
+
+// maxSuggestions is the maximum number of imports returned by SuggestImport.
+const maxSuggestions = 5
+
+// SuggestImport returns known imports that are similar to imp, for example,
+// to suggest a fix for a typo in an import that can't be resolved. Imports
+// are similar if they have the same language as imp and their Levenshtein
+// distance from imp.Imp is between 1 and maxDistance. Only imports provided
+// by rules indexed by the resolver named lang are considered.
+//
+// Suggestions are sorted by distance, then by import string. At most
+// a few suggestions are returned. Imports whose length differs from imp.Imp
+// by more than maxDistance are skipped without computing their distance, so
+// SuggestImport is fast enough to call for each unresolved import, even in
+// large indexes.
+//
+// SuggestImport may only be called after Finish.
+func (ix *RuleIndex) SuggestImport(imp ImportSpec, lang string, maxDistance int) []ImportSpec {
+	if maxDistance <= 0 {
+		return nil
+	}
+	type suggestion struct {
+		imp  ImportSpec
+		dist int
+	}
+	var suggestions []suggestion
+	for known, records := range ix.importMap {
+		if known.Lang != imp.Lang || known.Imp == imp.Imp {
+			continue
+		}
+		if d := len(known.Imp) - len(imp.Imp); d > maxDistance || -d > maxDistance {
+			continue
+		}
+		dist, ok := boundedLevenshtein(imp.Imp, known.Imp, maxDistance)
+		if !ok {
+			continue
+		}
+		for _, r := range records {
+			if r.lang == lang {
+				suggestions = append(suggestions, suggestion{known, dist})
+				break
+			}
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].dist != suggestions[j].dist {
+			return suggestions[i].dist < suggestions[j].dist
+		}
+		return suggestions[i].imp.Imp < suggestions[j].imp.Imp
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	var imps []ImportSpec
+	for _, s := range suggestions {
+		imps = append(imps, s.imp)
+	}
+	return imps
+}
+
+// boundedLevenshtein returns the Levenshtein distance between a and b,
+// measured in bytes. If the distance is greater than max, false is returned
+// as soon as that is known.
+func boundedLevenshtein(a, b string, max int) (int, bool) {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return 0, false
+		}
+		prev, cur = cur, prev
+	}
+	if d := prev[len(b)]; d <= max {
+		return d, true
+	}
+	return 0, false
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggestionText returns text to be appended to an error message that lists
+// suggested imports, like ` (did you mean "a" or "b"?)`. If there are no
+// suggestions, suggestionText returns "".
+func suggestionText(suggestions []ImportSpec) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = strconv.Quote(s.Imp)
+	}
+	return " (did you mean " + strings.Join(quoted, " or ") + "?)"
+}
@@ -0,0 +1,100 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestSuggestImport(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{{
+		content: `
+test_library(
+    name = "a",
+    provides = ["example.com/foo", "example.com/food", "example.com/bar"],
+)
+
+other_library(
+    name = "b",
+    provides = ["example.com/fooo"],
+)
+`,
+	}}, &testResolver{name: "test"}, &testResolver{name: "other"})
+
+	for _, tc := range []struct {
+		desc, imp   string
+		maxDistance int
+		want        []string
+	}{
+		{
+			desc:        "typo",
+			imp:         "example.com/fop",
+			maxDistance: 1,
+			want:        []string{"example.com/foo"},
+		}, {
+			desc:        "sorted_by_distance",
+			imp:         "example.com/fo",
+			maxDistance: 2,
+			want:        []string{"example.com/foo", "example.com/food"},
+		}, {
+			desc:        "exact",
+			imp:         "example.com/bar",
+			maxDistance: 1,
+		}, {
+			desc:        "too_far",
+			imp:         "example.com/baz/qux",
+			maxDistance: 2,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got []string
+			for _, imp := range ix.SuggestImport(ImportSpec{Lang: "test", Imp: tc.imp}, "test", tc.maxDistance) {
+				got = append(got, imp.Imp)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReportUnresolvedSuggestions(t *testing.T) {
+	c := testConfig(t, "-strict_resolve")
+	ix := buildTestIndex(t, c, []testFile{{
+		content: `
+test_library(
+    name = "a",
+    provides = ["example.com/foo"],
+)
+`,
+	}}, &testResolver{name: "test"})
+
+	from := label.New("", "x", "x")
+	ix.ReportUnresolved(c, from, ImportSpec{Lang: "test", Imp: "example.com/fop"}, "test", errors.New("not found"))
+	errs := TakeUnresolved(c)
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors; want 1", len(errs))
+	}
+	want := `//x: import "example.com/fop": not found (did you mean "example.com/foo"?)`
+	if got := errs[0].Error(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
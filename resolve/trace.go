@@ -0,0 +1,176 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// TraceStepKind identifies the kind of a step recorded in a ResolveTrace.
+type TraceStepKind string
+
+const (
+	// TraceDeprecated records that the import was replaced because it was
+	// deprecated with the deprecate_import directive.
+	TraceDeprecated TraceStepKind = "deprecated"
+
+	// TraceOverride records that a resolve directive (or resolve_alias,
+	// resolve_any, or resolve_template) determined the label.
+	TraceOverride TraceStepKind = "override"
+
+	// TraceRewrite records that the import was rewritten by an
+	// import_rewrite directive before it was looked up.
+	TraceRewrite TraceStepKind = "rewrite"
+
+	// TraceIndex records a lookup in the index or in an index added with
+	// WithFallback. Labels are the rules that matched.
+	TraceIndex TraceStepKind = "index"
+
+	// TraceFallbackLang records a lookup for the fallback language named
+	// with the resolve_fallback_lang directive.
+	TraceFallbackLang TraceStepKind = "fallback_lang"
+
+	// TraceFirstPartyOnly records that CrossResolvers were not consulted
+	// because -first_party_only is set.
+	TraceFirstPartyOnly TraceStepKind = "first_party_only"
+
+	// TraceCrossResolver records a call to a CrossResolver. Detail is the
+	// resolver's type, and Labels are the labels it returned.
+	TraceCrossResolver TraceStepKind = "cross_resolver"
+
+	// TraceTieBreak records that ambiguous results were narrowed down by
+	// a pin_import directive, source roots, or SetChangedLabels.
+	TraceTieBreak TraceStepKind = "tie_break"
+
+	// TraceSelfImport records results that were dropped because they are
+	// the importing rule or rules it embeds.
+	TraceSelfImport TraceStepKind = "self_import"
+
+	// TraceResult, TraceAmbiguous, and TraceUnresolved record the final
+	// decision: a single label, several candidate labels, or none.
+	TraceResult     TraceStepKind = "result"
+	TraceAmbiguous  TraceStepKind = "ambiguous"
+	TraceUnresolved TraceStepKind = "unresolved"
+)
+
+// TraceStep is one step in a ResolveTrace.
+type TraceStep struct {
+	Kind TraceStepKind
+
+	// Detail describes the step for humans, for example, which index or
+	// CrossResolver was consulted.
+	Detail string
+
+	// Labels are the labels found or chosen in this step, if any.
+	Labels []label.Label
+}
+
+// ResolveTrace records the steps taken to resolve an import with
+// RuleIndex.ResolveWithTrace, in order.
+type ResolveTrace struct {
+	Imp   ImportSpec
+	Lang  string
+	From  label.Label
+	Steps []TraceStep
+}
+
+// String formats the trace with one step per line.
+func (t ResolveTrace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: import %q (%s)\n", t.From, t.Imp.Imp, t.Imp.Lang)
+	for _, s := range t.Steps {
+		fmt.Fprintf(&b, "  %s: %s", s.Kind, s.Detail)
+		if len(s.Labels) > 0 {
+			fmt.Fprintf(&b, ": %s", strings.Join(labelStrings(s.Labels), ", "))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// add records a step with the labels of results. Nothing is recorded if t
+// is nil, so lookups can be traced without cost when no trace is wanted.
+func (t *ResolveTrace) add(kind TraceStepKind, results []FindResult, format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	var labels []label.Label
+	for _, r := range results {
+		labels = append(labels, r.Label)
+	}
+	t.Steps = append(t.Steps, TraceStep{Kind: kind, Detail: fmt.Sprintf(format, args...), Labels: labels})
+}
+
+// traceTies calls breakTies and records a step if it narrowed the results.
+func (ix *RuleIndex) traceTies(c *config.Config, imp ImportSpec, results []FindResult, tr *ResolveTrace) []FindResult {
+	narrowed := ix.breakTies(c, imp, results)
+	if len(narrowed) != len(results) {
+		tr.add(TraceTieBreak, narrowed, "%d of %d results kept", len(narrowed), len(results))
+	}
+	return narrowed
+}
+
+// ResolveWithTrace resolves imp for the rule with label from, the way
+// language resolvers usually do, and records each step in a trace for
+// debugging. imp is replaced if it's deprecated, then resolve directives are
+// checked with FindRuleWithOverride, and then the import is looked up with
+// FindRulesByImportWithConfig, recording each index and CrossResolver
+// consulted. Self-imports are dropped. ResolveWithTrace returns the single
+// remaining result and true, or false if no result or several results
+// remain; the last step of the trace says which.
+//
+// ResolveWithTrace is not used by Gazelle itself, and resolvers may apply
+// language-specific rules that it doesn't know about.
+func (ix *RuleIndex) ResolveWithTrace(c *config.Config, imp ImportSpec, lang string, from label.Label) (FindResult, ResolveTrace, bool) {
+	tr := &ResolveTrace{Imp: imp, Lang: lang, From: from}
+	if replaced := ReplaceDeprecatedImport(c, imp); replaced != imp {
+		tr.add(TraceDeprecated, nil, "replaced with %q by deprecate_import", replaced.Imp)
+		imp = replaced
+	}
+	if l, ok := ix.FindRuleWithOverride(c, imp, lang); ok {
+		result := FindResult{Label: l}
+		tr.add(TraceOverride, []FindResult{result}, "resolve directive")
+		tr.add(TraceResult, []FindResult{result}, "resolved by directive")
+		return result, *tr, true
+	}
+
+	var results, self []FindResult
+	for _, r := range ix.findRulesByImportWithConfig(c, imp, lang, tr) {
+		if ix.IsSelfImport(r, nil, from) {
+			self = append(self, r)
+		} else {
+			results = append(results, r)
+		}
+	}
+	if len(self) > 0 {
+		tr.add(TraceSelfImport, self, "dropped self-imports")
+	}
+	switch len(results) {
+	case 0:
+		tr.add(TraceUnresolved, nil, "no rule provides the import")
+		return FindResult{}, *tr, false
+	case 1:
+		tr.add(TraceResult, results, "resolved")
+		return results[0], *tr, true
+	default:
+		tr.add(TraceAmbiguous, results, "multiple rules provide the import")
+		return FindResult{}, *tr, false
+	}
+}
@@ -0,0 +1,111 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestResolveWithTrace(t *testing.T) {
+	rslv := &testResolver{name: "test"}
+	cr := &testCrossResolver{imps: map[ImportSpec]label.Label{
+		{Lang: "test", Imp: "cross"}: label.New("cross", "", "x"),
+	}}
+	c := testConfig(t)
+	ix := NewRuleIndex(kindResolver(rslv), cr)
+	addTestFiles(t, c, ix, []testFile{{
+		rel: "lib",
+		content: `
+test_library(
+    name = "a",
+    provides = ["a"],
+)
+`,
+	}})
+	ix.Finish()
+
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:resolve test test overridden //other:o
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = c.Clone()
+	(&Configurer{}).Configure(c, "", f)
+
+	from := label.New("", "app", "app")
+	for _, tc := range []struct {
+		desc, imp string
+		wantLabel string
+		wantOK    bool
+		wantKinds []TraceStepKind
+	}{
+		{
+			desc:      "index",
+			imp:       "a",
+			wantLabel: "//lib:a",
+			wantOK:    true,
+			wantKinds: []TraceStepKind{TraceIndex, TraceResult},
+		}, {
+			desc:      "override",
+			imp:       "overridden",
+			wantLabel: "//other:o",
+			wantOK:    true,
+			wantKinds: []TraceStepKind{TraceOverride, TraceResult},
+		}, {
+			desc:      "cross",
+			imp:       "cross",
+			wantLabel: "@cross//:x",
+			wantOK:    true,
+			wantKinds: []TraceStepKind{TraceIndex, TraceCrossResolver, TraceResult},
+		}, {
+			desc:      "unresolved",
+			imp:       "missing",
+			wantKinds: []TraceStepKind{TraceIndex, TraceCrossResolver, TraceUnresolved},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			imp := ImportSpec{Lang: "test", Imp: tc.imp}
+			res, tr, ok := ix.ResolveWithTrace(c, imp, "test", from)
+			if ok != tc.wantOK {
+				t.Fatalf("got ok %v; want %v\n%s", ok, tc.wantOK, tr)
+			}
+			if ok && res.Label.String() != tc.wantLabel {
+				t.Errorf("got label %s; want %s", res.Label, tc.wantLabel)
+			}
+			if tr.Imp != imp || tr.Lang != "test" || tr.From != from {
+				t.Errorf("got trace for %v from %s; want %v from %s", tr.Imp, tr.From, imp, from)
+			}
+			var kinds []TraceStepKind
+			for _, s := range tr.Steps {
+				kinds = append(kinds, s.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tc.wantKinds) {
+				t.Errorf("got steps %v; want %v\n%s", kinds, tc.wantKinds, tr)
+			}
+			if ok {
+				last := tr.Steps[len(tr.Steps)-1]
+				if len(last.Labels) != 1 || last.Labels[0].String() != tc.wantLabel {
+					t.Errorf("got result step labels %v; want [%s]", last.Labels, tc.wantLabel)
+				}
+			}
+		})
+	}
+}
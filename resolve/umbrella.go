@@ -0,0 +1,124 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// umbrella is a target that re-exports a set of members, declared with
+// the umbrella directive. Labels are absolute.
+type umbrella struct {
+	label   label.Label
+	members []label.Label
+}
+
+// CollapseUmbrellaDeps replaces dependencies of r that are all the members
+// of an umbrella declared with the umbrella directive with a single
+// dependency on the umbrella. from is the label of r. The umbrellas that
+// were added are returned in the order they were declared. Umbrellas are
+// considered in that order, so a dependency collapsed into one umbrella
+// can't be collapsed into another.
+//
+// Collapsing is conservative. Only a plain list of strings in the "deps"
+// attribute is considered, and rules with "# keep" comments are not
+// modified. An umbrella is only used if every one of its members is a
+// dependency, none of those dependencies is marked with "# keep", and r is
+// neither the umbrella nor one of its members, since that would create
+// a cycle.
+func CollapseUmbrellaDeps(c *config.Config, r *rule.Rule, from label.Label) []label.Label {
+	umbrellas := getResolveConfig(c).umbrellas
+	if len(umbrellas) == 0 || r.ShouldKeep() {
+		return nil
+	}
+	list, ok := r.Attr("deps").(*bzl.ListExpr)
+	if !ok {
+		return nil
+	}
+
+	// index maps each dependency label to its position in list.List.
+	index := make(map[label.Label]int)
+	for i, e := range list.List {
+		s, ok := e.(*bzl.StringExpr)
+		if !ok {
+			continue
+		}
+		l, err := label.Parse(s.Value)
+		if err != nil {
+			continue
+		}
+		l = l.Abs(from.Repo, from.Pkg)
+		if _, ok := index[l]; !ok {
+			index[l] = i
+		}
+	}
+
+	removed := make(map[int]bool)
+	replaced := make(map[int]label.Label)
+	var added []label.Label
+	for _, u := range umbrellas {
+		if u.label.Equal(from) {
+			continue
+		}
+		usable := true
+		first := -1
+		for _, m := range u.members {
+			i, ok := index[m]
+			if !ok || m.Equal(from) || rule.ShouldKeep(list.List[i]) {
+				usable = false
+				break
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+		if !usable {
+			continue
+		}
+		for _, m := range u.members {
+			i := index[m]
+			removed[i] = true
+			delete(replaced, i)
+			delete(index, m)
+		}
+		if _, ok := index[u.label]; !ok {
+			removed[first] = false
+			replaced[first] = u.label
+			index[u.label] = first
+		}
+		added = append(added, u.label)
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	var kept []bzl.Expr
+	for i, e := range list.List {
+		if removed[i] {
+			continue
+		}
+		if l, ok := replaced[i]; ok {
+			e = &bzl.StringExpr{Value: l.Rel(from.Repo, from.Pkg).String()}
+		}
+		kept = append(kept, e)
+	}
+	list.List = kept
+	r.SetAttr("deps", list)
+	return added
+}
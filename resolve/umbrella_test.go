@@ -0,0 +1,123 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestCollapseUmbrellaDeps(t *testing.T) {
+	c := testConfig(t)
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+# gazelle:umbrella //all:everything provides //a:x //a:y //a:z
+# gazelle:umbrella //all:pair provides //b:p //b:q
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &Configurer{}
+	cr.Configure(c, "", f)
+
+	for _, tc := range []struct {
+		desc, pkg, name, deps string
+		want                  []string
+		wantAdded             []string
+	}{
+		{
+			desc:      "full",
+			deps:      `["//a:x", "//a:y", "//a:z", "//lib"]`,
+			want:      []string{"//all:everything", "//lib"},
+			wantAdded: []string{"//all:everything"},
+		}, {
+			desc:      "unordered",
+			deps:      `["//lib", "//a:z", "//b:q", "//a:x", "//b:p", "//a:y"]`,
+			want:      []string{"//lib", "//all:everything", "//all:pair"},
+			wantAdded: []string{"//all:everything", "//all:pair"},
+		}, {
+			desc: "partial",
+			deps: `["//a:x", "//a:y", "//lib"]`,
+			want: []string{"//a:x", "//a:y", "//lib"},
+		}, {
+			desc:      "already_listed",
+			deps:      `["//a:x", "//a:y", "//a:z", "//all:everything"]`,
+			want:      []string{"//all:everything"},
+			wantAdded: []string{"//all:everything"},
+		}, {
+			desc: "kept_member",
+			deps: `[
+        "//a:x",
+        "//a:y",  # keep
+        "//a:z",
+    ]`,
+			want: []string{"//a:x", "//a:y", "//a:z"},
+		}, {
+			desc: "umbrella_itself",
+			pkg:  "all",
+			name: "everything",
+			deps: `["//a:x", "//a:y", "//a:z"]`,
+			want: []string{"//a:x", "//a:y", "//a:z"},
+		}, {
+			desc: "member_itself",
+			pkg:  "a",
+			name: "x",
+			deps: `[":y", ":z", "//lib"]`,
+			want: []string{":y", ":z", "//lib"},
+		}, {
+			desc:      "relative",
+			pkg:       "all",
+			deps:      `["//a:x", "//a:y", "//a:z"]`,
+			want:      []string{":everything"},
+			wantAdded: []string{"//all:everything"},
+		}, {
+			desc: "select",
+			deps: `select({"//conditions:default": ["//a:x", "//a:y", "//a:z"]})`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			name := tc.name
+			if name == "" {
+				name = "consumer"
+			}
+			bf, err := rule.LoadData("BUILD.bazel", tc.pkg, []byte(`x_library(
+    name = "`+name+`",
+    deps = `+tc.deps+`,
+)
+`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bf.Rules[0]
+			added := CollapseUmbrellaDeps(c, r, label.New("", tc.pkg, name))
+			var gotAdded []string
+			for _, l := range added {
+				gotAdded = append(gotAdded, l.String())
+			}
+			if !reflect.DeepEqual(gotAdded, tc.wantAdded) {
+				t.Errorf("added: got %v; want %v", gotAdded, tc.wantAdded)
+			}
+			if tc.want == nil {
+				return
+			}
+			if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("deps: got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
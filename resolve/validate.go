@@ -0,0 +1,40 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "github.com/bazelbuild/bazel-gazelle/config"
+
+// IndexValidator is an optional interface that a Resolver may implement to
+// check invariants that involve the whole index, for example, that exactly
+// one rule provides a well-known import. ValidateIndex is called once after
+// Finish and before any rules are resolved.
+type IndexValidator interface {
+	// ValidateIndex returns a list of problems found in ix. c is the
+	// configuration for the repository root.
+	ValidateIndex(c *config.Config, ix *RuleIndex) []error
+}
+
+// ValidateIndex calls ValidateIndex for each resolver in rslvs that
+// implements IndexValidator and returns the errors they report, in order.
+func ValidateIndex(c *config.Config, ix *RuleIndex, rslvs []Resolver) []error {
+	var errs []error
+	for _, rslv := range rslvs {
+		if v, ok := rslv.(IndexValidator); ok {
+			errs = append(errs, v.ValidateIndex(c, ix)...)
+		}
+	}
+	return errs
+}
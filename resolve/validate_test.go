@@ -0,0 +1,74 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+// entrypointValidator is a testResolver that requires exactly one rule to
+// provide the import "main".
+type entrypointValidator struct {
+	testResolver
+}
+
+func (ev *entrypointValidator) ValidateIndex(c *config.Config, ix *RuleIndex) []error {
+	imp := ImportSpec{Lang: ev.name, Imp: "main"}
+	if n := len(ix.FindRulesByImport(imp, ev.name)); n != 1 {
+		return []error{fmt.Errorf("%d rules provide %q; want 1", n, imp.Imp)}
+	}
+	return nil
+}
+
+func TestValidateIndex(t *testing.T) {
+	for _, tc := range []struct {
+		desc, content string
+		wantErr       bool
+	}{
+		{
+			desc: "provided",
+			content: `
+test_library(
+    name = "main",
+    provides = ["main"],
+)
+`,
+		}, {
+			desc: "missing",
+			content: `
+test_library(
+    name = "lib",
+    provides = ["lib"],
+)
+`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := testConfig(t)
+			rslv := &entrypointValidator{testResolver{name: "test"}}
+			other := &testResolver{name: "other"}
+			ix := buildTestIndex(t, c, []testFile{{content: tc.content}}, rslv, other)
+			errs := ValidateIndex(c, ix, []Resolver{rslv, other})
+			if gotErr := len(errs) > 0; gotErr != tc.wantErr {
+				t.Errorf("got errors %v; want errors %v", errs, tc.wantErr)
+			}
+		})
+	}
+}
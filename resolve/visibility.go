@@ -0,0 +1,186 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// packageGroup records the members of a package_group rule.
+type packageGroup struct {
+	// packages are the package specifications from the "packages"
+	// attribute, like "//foo", "//foo/...", or "-//foo/bar".
+	packages []string
+
+	// includes are absolute labels of other package_group rules whose
+	// members are also members of this group.
+	includes []label.Label
+}
+
+// addPackageGroup indexes a package_group rule so its members may be
+// checked by VisibleVia. package_group rules are indexed whether or not
+// a Resolver handles them.
+func (ix *RuleIndex) addPackageGroup(c *config.Config, r *rule.Rule, f *rule.File) {
+	if ix.packageGroups == nil {
+		ix.packageGroups = make(map[label.Label]*packageGroup)
+	}
+	pg := &packageGroup{packages: r.AttrStrings("packages")}
+	for _, s := range r.AttrStrings("includes") {
+		if l, err := label.Parse(s); err == nil {
+			pg.includes = append(pg.includes, l.Abs(c.RepoName, f.Pkg))
+		}
+	}
+	ix.packageGroups[label.New(c.RepoName, f.Pkg, r.Name())] = pg
+}
+
+// VisibleVia returns whether the rule with label from may depend on the
+// indexed rule with label target, according to target's "visibility"
+// attribute, or the default_visibility of its package if it has none.
+// Both labels must be absolute. If from is indexed, it's normalized with
+// RuleIndex.NormalizeFrom first.
+//
+// Visibility labels like "//visibility:public" and "//foo:__subpackages__"
+// are evaluated directly. Other labels are looked up among the indexed
+// package_group rules, and their "packages" and "includes" attributes are
+// evaluated. Since the index can't tell whether labels it doesn't know
+// grant visibility, true is returned for targets that aren't indexed and
+// for visibility labels that aren't indexed package groups.
+func VisibleVia(ix *RuleIndex, from, target label.Label) bool {
+	if record, ok := ix.labelMap[from]; ok {
+		from = ix.NormalizeFrom(from, record.rule)
+	}
+	if from.Repo == target.Repo && from.Pkg == target.Pkg {
+		return true
+	}
+	r, ok := ix.labelMap[target]
+	if !ok {
+		return true
+	}
+	vis := r.rule.AttrStrings("visibility")
+	if vis == nil {
+		vis = defaultVisibility(r.file)
+	}
+	for _, v := range vis {
+		l, err := label.Parse(v)
+		if err != nil {
+			continue
+		}
+		l = l.Abs(target.Repo, target.Pkg)
+		if l.Repo == "" {
+			l.Repo = target.Repo
+		}
+		if ix.visibilityLabelIncludes(l, from, make(map[label.Label]bool)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultVisibility returns the default_visibility declared by the package
+// function in f, if there is one.
+func defaultVisibility(f *rule.File) []string {
+	if f == nil {
+		return nil
+	}
+	for _, r := range f.Rules {
+		if r.Kind() == "package" {
+			return r.AttrStrings("default_visibility")
+		}
+	}
+	return nil
+}
+
+// visibilityLabelIncludes returns whether the visibility label l grants
+// visibility to from. visited guards against cycles of package groups.
+func (ix *RuleIndex) visibilityLabelIncludes(l, from label.Label, visited map[label.Label]bool) bool {
+	if l.Pkg == "visibility" {
+		return l.Name == "public"
+	}
+	switch l.Name {
+	case "__pkg__":
+		return from.Repo == l.Repo && from.Pkg == l.Pkg
+	case "__subpackages__":
+		return from.Repo == l.Repo && pathtools.HasPrefix(from.Pkg, l.Pkg)
+	}
+	pg, ok := ix.packageGroups[l]
+	if !ok {
+		return true
+	}
+	return ix.packageGroupIncludes(l, pg, from, visited)
+}
+
+// packageGroupIncludes returns whether from is in the package group pg with
+// label l or a group it includes. Negative specifications like "-//foo"
+// exclude packages matched by any positive specification in pg.
+func (ix *RuleIndex) packageGroupIncludes(l label.Label, pg *packageGroup, from label.Label, visited map[label.Label]bool) bool {
+	if visited[l] {
+		return false
+	}
+	visited[l] = true
+	included := false
+	for _, spec := range pg.packages {
+		if strings.HasPrefix(spec, "-") {
+			if packageSpecMatches(strings.TrimPrefix(spec, "-"), l.Repo, from) {
+				return false
+			}
+		} else if packageSpecMatches(spec, l.Repo, from) {
+			included = true
+		}
+	}
+	if included {
+		return true
+	}
+	for _, inc := range pg.includes {
+		if incPg, ok := ix.packageGroups[inc]; ok && ix.packageGroupIncludes(inc, incPg, from, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageSpecMatches returns whether the package of from matches a package
+// specification from a package_group in repository repo.
+func packageSpecMatches(spec, repo string, from label.Label) bool {
+	switch spec {
+	case "public":
+		return true
+	case "private":
+		return false
+	}
+	if strings.HasPrefix(spec, "@") {
+		i := strings.Index(spec, "//")
+		if i < 0 {
+			return false
+		}
+		repo, spec = spec[1:i], spec[i:]
+	}
+	if !strings.HasPrefix(spec, "//") || from.Repo != repo {
+		return false
+	}
+	pkg := strings.TrimPrefix(spec, "//")
+	if pkg == "..." {
+		return true
+	}
+	if strings.HasSuffix(pkg, "/...") {
+		return pathtools.HasPrefix(from.Pkg, strings.TrimSuffix(pkg, "/..."))
+	}
+	return from.Pkg == pkg
+}
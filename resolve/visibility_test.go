@@ -0,0 +1,148 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestVisibleVia(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{
+		{rel: "groups", content: `
+package_group(
+    name = "friends",
+    packages = [
+        "//friend",
+        "//team/...",
+        "-//team/outsider",
+    ],
+    includes = [":partners"],
+)
+
+package_group(
+    name = "partners",
+    packages = ["//partner"],
+    includes = [":friends"],
+)
+`},
+		{rel: "lib", content: `
+test_library(
+    name = "grouped",
+    provides = ["grouped"],
+    visibility = ["//groups:friends"],
+)
+
+test_library(
+    name = "subpackages",
+    provides = ["subpackages"],
+    visibility = ["//lib:__subpackages__"],
+)
+
+test_library(
+    name = "public",
+    provides = ["public"],
+    visibility = ["//visibility:public"],
+)
+
+test_library(
+    name = "unknown_group",
+    provides = ["unknown_group"],
+    visibility = ["//elsewhere:group"],
+)
+`},
+		{rel: "private", content: `
+package(default_visibility = ["//visibility:private"])
+
+test_library(
+    name = "private",
+    provides = ["private"],
+)
+`},
+	}, &testResolver{name: "test"})
+
+	for _, tc := range []struct {
+		from, target string
+		want         bool
+	}{
+		{from: "//friend:a", target: "//lib:grouped", want: true},
+		{from: "//team/x:a", target: "//lib:grouped", want: true},
+		{from: "//team/outsider:a", target: "//lib:grouped", want: false},
+		{from: "//partner:a", target: "//lib:grouped", want: true},
+		{from: "//stranger:a", target: "//lib:grouped", want: false},
+		{from: "//lib:other", target: "//lib:grouped", want: true},
+		{from: "//lib/sub:a", target: "//lib:subpackages", want: true},
+		{from: "//friend:a", target: "//lib:subpackages", want: false},
+		{from: "//stranger:a", target: "//lib:public", want: true},
+		{from: "//stranger:a", target: "//lib:unknown_group", want: true},
+		{from: "//stranger:a", target: "//private:private", want: false},
+		{from: "//stranger:a", target: "//not/indexed:x", want: true},
+	} {
+		from, err := label.Parse(tc.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, err := label.Parse(tc.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := VisibleVia(ix, from, target); got != tc.want {
+			t.Errorf("VisibleVia(%s, %s): got %v; want %v", from, target, got, tc.want)
+		}
+	}
+}
+
+// movingFromNormalizer is a testResolver that gives rules in the package gen
+// logical labels in the package friend.
+type movingFromNormalizer struct {
+	testResolver
+}
+
+func (mn *movingFromNormalizer) NormalizeFrom(from label.Label, r *rule.Rule) label.Label {
+	if from.Pkg == "gen" {
+		from.Pkg = "friend"
+	}
+	return from
+}
+
+func TestVisibleViaNormalizeFrom(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{
+		{rel: "lib", content: `
+test_library(
+    name = "lib",
+    provides = ["lib"],
+    visibility = ["//friend:__pkg__"],
+)
+`},
+		{rel: "gen", content: `
+test_library(
+    name = "gen",
+    provides = ["gen"],
+)
+`},
+	}, &movingFromNormalizer{testResolver{name: "test"}})
+
+	if !VisibleVia(ix, label.New("", "gen", "gen"), label.New("", "lib", "lib")) {
+		t.Errorf("//gen is not visible via its logical label in //friend")
+	}
+	if VisibleVia(ix, label.New("", "other", "other"), label.New("", "lib", "lib")) {
+		t.Errorf("//other is visible; want not visible")
+	}
+}
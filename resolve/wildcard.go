@@ -0,0 +1,58 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import "strings"
+
+// WildcardImportSuffix ends import strings that match a whole subtree of
+// imports. A rule indexed with the import string "example.com/sdk/..."
+// provides "example.com/sdk" and every import string that starts with
+// "example.com/sdk/". A rule indexed with "..." provides every import
+// string in its language. Components of import strings must be separated
+// by slashes.
+//
+// Wildcard imports are only consulted when no rule provides an import
+// exactly. If several wildcard imports match, the longest one is used.
+const WildcardImportSuffix = "/..."
+
+// IsWildcardImport returns whether imp matches a subtree of imports. See
+// WildcardImportSuffix.
+func IsWildcardImport(imp ImportSpec) bool {
+	return imp.Imp == "..." || strings.HasSuffix(imp.Imp, WildcardImportSuffix)
+}
+
+// findWildcardRecords returns records in importMap for rules of language
+// lang indexed with the longest wildcard import matching imp.
+func findWildcardRecords(importMap map[ImportSpec][]*ruleRecord, imp ImportSpec, lang string) []*ruleRecord {
+	prefix := imp.Imp
+	for {
+		key := ImportSpec{Lang: imp.Lang, Imp: prefix + WildcardImportSuffix}
+		if prefix == "" {
+			key.Imp = "..."
+		}
+		if matches := recordsForLang(importMap[key], lang); len(matches) > 0 {
+			return matches
+		}
+		if prefix == "" {
+			return nil
+		}
+		if i := strings.LastIndexByte(prefix, '/'); i >= 0 {
+			prefix = prefix[:i]
+		} else {
+			prefix = ""
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWildcardImports(t *testing.T) {
+	c := testConfig(t)
+	ix := buildTestIndex(t, c, []testFile{
+		{
+			rel: "sdk",
+			content: `
+test_library(
+    name = "sdk",
+    provides = ["github.com/org/sdk/..."],
+)
+
+test_library(
+    name = "storage",
+    provides = ["github.com/org/sdk/storage/..."],
+)
+
+test_library(
+    name = "exact",
+    provides = ["github.com/org/sdk/storage/blob"],
+)
+`,
+		}, {
+			rel: "all",
+			content: `
+other_library(
+    name = "all",
+    provides = ["..."],
+)
+`,
+		},
+	}, &testResolver{name: "test"}, &testResolver{name: "other"})
+
+	for _, tc := range []struct {
+		imp  ImportSpec
+		want []string
+	}{
+		{imp: ImportSpec{Lang: "test", Imp: "github.com/org/sdk"}, want: []string{"//sdk"}},
+		{imp: ImportSpec{Lang: "test", Imp: "github.com/org/sdk/auth"}, want: []string{"//sdk"}},
+		{imp: ImportSpec{Lang: "test", Imp: "github.com/org/sdk/storage/queue"}, want: []string{"//sdk:storage"}},
+		{imp: ImportSpec{Lang: "test", Imp: "github.com/org/sdk/storage/blob"}, want: []string{"//sdk:exact"}},
+		{imp: ImportSpec{Lang: "test", Imp: "github.com/org/sdkx"}, want: nil},
+		{imp: ImportSpec{Lang: "test", Imp: "github.com/other"}, want: nil},
+		{imp: ImportSpec{Lang: "other", Imp: "anything/at/all"}, want: []string{"//all"}},
+	} {
+		lang := tc.imp.Lang
+		if got := resultLabels(ix.FindRulesByImport(tc.imp, lang)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v; want %v", tc.imp, got, tc.want)
+		}
+	}
+}
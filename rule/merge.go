@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 
+	"github.com/bazelbuild/bazel-gazelle/label"
 	bzl "github.com/bazelbuild/buildtools/build"
 )
 
@@ -41,10 +43,14 @@ import (
 // marked with a "# keep" comment, values in the attribute not marked with
 // a "# keep" comment will be dropped. If the attribute is empty afterward,
 // it will be deleted.
+//
+// Calls to glob in dst attributes are merged according to the private
+// attribute GlobsKey in src. See GlobsKey.
 func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 	if dst.ShouldKeep() {
 		return
 	}
+	globs, _ := src.PrivateAttr(GlobsKey).(string)
 
 	// Process attributes that are in dst but not in src.
 	for key, dstAttr := range dst.attrs {
@@ -52,7 +58,7 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 			continue
 		}
 		dstValue := dstAttr.RHS
-		if mergedValue, err := mergeExprs(nil, dstValue); err != nil {
+		if mergedValue, err := mergeExprs(nil, dstValue, globs); err != nil {
 			start, end := dstValue.Span()
 			log.Printf("%s:%d.%d-%d.%d: could not merge expression", filename, start.Line, start.LineRune, end.Line, end.LineRune)
 		} else if mergedValue == nil {
@@ -69,7 +75,7 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 			dst.SetAttr(key, srcValue)
 		} else if mergeable[key] && !ShouldKeep(dstAttr) {
 			dstValue := dstAttr.RHS
-			if mergedValue, err := mergeExprs(srcValue, dstValue); err != nil {
+			if mergedValue, err := mergeExprs(srcValue, dstValue, globs); err != nil {
 				start, end := dstValue.Span()
 				log.Printf("%s:%d.%d-%d.%d: could not merge expression", filename, start.Line, start.LineRune, end.Line, end.LineRune)
 			} else {
@@ -93,9 +99,15 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 //   * a list of strings combined with a select call using +. The list must
 //     be the left operand.
 //
+// If dst includes a select call with conditions other than the platforms
+// Gazelle generates selects for, it's merged with mergeCustomSelects.
+//
+// If globs is PreserveGlobs or ExpandGlobs, calls to glob in dst are
+// handled as described in GlobsKey. Otherwise, they can't be merged.
+//
 // An error is returned if the expressions can't be merged, for example
 // because they are not in one of the above formats.
-func mergeExprs(src, dst bzl.Expr) (bzl.Expr, error) {
+func mergeExprs(src, dst bzl.Expr, globs string) (bzl.Expr, error) {
 	if ShouldKeep(dst) {
 		return nil, nil
 	}
@@ -106,6 +118,39 @@ func mergeExprs(src, dst bzl.Expr) (bzl.Expr, error) {
 		return src, nil
 	}
 
+	var rest, keptGlobs []bzl.Expr
+	var selects []*bzl.CallExpr
+	haveGlobs := false
+	for _, term := range sumTerms(dst) {
+		switch {
+		case isGlobCall(term) && (globs == PreserveGlobs || globs == ExpandGlobs):
+			haveGlobs = true
+			if globs == PreserveGlobs || globKept(term) {
+				keptGlobs = append(keptGlobs, term)
+			}
+		case isCustomSelect(term):
+			selects = append(selects, term.(*bzl.CallExpr))
+		default:
+			rest = append(rest, term)
+		}
+	}
+	if haveGlobs {
+		for _, s := range selects {
+			rest = append(rest, s)
+		}
+		merged := src
+		if len(rest) > 0 {
+			var err error
+			if merged, err = mergeExprs(src, sumExpr(rest), globs); err != nil {
+				return nil, err
+			}
+		}
+		return sumExpr(append(sumTerms(merged), keptGlobs...)), nil
+	}
+	if len(selects) > 0 {
+		return mergeCustomSelects(src, sumExpr(rest), selects)
+	}
+
 	srcExprs, err := extractPlatformStringsExprs(src)
 	if err != nil {
 		return nil, err
@@ -121,6 +166,220 @@ func mergeExprs(src, dst bzl.Expr) (bzl.Expr, error) {
 	return makePlatformStringsExpr(mergedExprs), nil
 }
 
+// GlobsKey is the key of a private attribute on a generated rule that
+// controls how MergeRules handles calls to glob, combined with other
+// expressions using +, in the matching existing rule. When it's not set,
+// attributes with globs can't be merged and are left unchanged. When it's
+// PreserveGlobs, globs are concatenated after the merged value, since
+// Gazelle can't tell what they match. When it's ExpandGlobs, globs are
+// dropped, except for globs marked with a "# keep" comment.
+const GlobsKey = "_gazelle_globs"
+
+// Values of the GlobsKey private attribute.
+const (
+	PreserveGlobs = "preserve"
+	ExpandGlobs   = "expand"
+)
+
+// isGlobCall returns whether e is a call to glob.
+func isGlobCall(e bzl.Expr) bool {
+	call, ok := e.(*bzl.CallExpr)
+	if !ok {
+		return false
+	}
+	x, ok := call.X.(*bzl.Ident)
+	return ok && x.Name == "glob"
+}
+
+// globKept returns whether the glob call e or one of its arguments is
+// marked with a "# keep" comment.
+func globKept(e bzl.Expr) bool {
+	if ShouldKeep(e) {
+		return true
+	}
+	for _, arg := range e.(*bzl.CallExpr).List {
+		if ShouldKeep(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCustomSelect returns whether e is a call to select with at least one
+// condition that's not "//conditions:default" or a platform Gazelle
+// generates selects for (see isPlatformCondition). Gazelle doesn't generate
+// these, so they're assumed to be written by hand.
+func isCustomSelect(e bzl.Expr) bool {
+	dict := selectDict(e)
+	if dict == nil {
+		return false
+	}
+	for _, item := range dict.List {
+		kv, ok := item.(*bzl.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key := stringValue(kv.Key); key != "//conditions:default" && !isPlatformCondition(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPlatformCondition returns whether key names one of the config_setting
+// rules in @io_bazel_rules_go//go/platform that Gazelle generates select
+// expressions for. Keys without a package are also accepted.
+func isPlatformCondition(key string) bool {
+	l, err := label.Parse(key)
+	if err != nil {
+		return false
+	}
+	if (l.Repo != "" || l.Pkg != "") && (l.Repo != "io_bazel_rules_go" || l.Pkg != "go/platform") {
+		return false
+	}
+	if KnownOSSet[l.Name] || KnownArchSet[l.Name] {
+		return true
+	}
+	osArch := strings.Split(l.Name, "_")
+	return len(osArch) == 2 && KnownOSSet[osArch[0]] && KnownArchSet[osArch[1]]
+}
+
+// mergeCustomSelects merges src into dst, where dst is rest concatenated
+// with selects, a list of select calls written by hand (see isCustomSelect).
+//
+// The selects are preserved, with their non-default branches unchanged. The
+// rest of dst is merged with src as usual. If the rest of dst doesn't
+// include a list, strings in the list in src are merged into the
+// "//conditions:default" branch of the first select instead, and the branch
+// is added if it's missing. Strings that already appear in a non-default
+// branch are not added to the list or the default branch.
+func mergeCustomSelects(src, rest bzl.Expr, selects []*bzl.CallExpr) (bzl.Expr, error) {
+	srcExprs, err := extractPlatformStringsExprs(src)
+	if err != nil {
+		return nil, err
+	}
+	restExprs, err := extractPlatformStringsExprs(rest)
+	if err != nil {
+		return nil, err
+	}
+	srcExprs.generic = withoutConditionalStrings(srcExprs.generic, selects)
+	if restExprs.generic == nil {
+		if err := mergeDefaultBranch(srcExprs.generic, selectDict(selects[0])); err != nil {
+			return nil, err
+		}
+		srcExprs.generic = nil
+	}
+	mergedExprs, err := mergePlatformStringsExprs(srcExprs, restExprs)
+	if err != nil {
+		return nil, err
+	}
+	terms := sumTerms(makePlatformStringsExpr(mergedExprs))
+	for _, s := range selects {
+		terms = append(terms, s)
+	}
+	return sumExpr(terms), nil
+}
+
+// mergeDefaultBranch merges src into the "//conditions:default" branch of
+// dict, adding the branch if it's missing. The branch is not modified if
+// it's marked with a "# keep" comment.
+func mergeDefaultBranch(src *bzl.ListExpr, dict *bzl.DictExpr) error {
+	for _, item := range dict.List {
+		kv, ok := item.(*bzl.KeyValueExpr)
+		if !ok || stringValue(kv.Key) != "//conditions:default" {
+			continue
+		}
+		if ShouldKeep(kv.Value) {
+			return nil
+		}
+		dst, ok := kv.Value.(*bzl.ListExpr)
+		if !ok {
+			return fmt.Errorf("default branch of select is not a list")
+		}
+		if merged := mergeList(src, dst); merged != nil {
+			kv.Value = merged
+		} else {
+			kv.Value = &bzl.ListExpr{}
+		}
+		return nil
+	}
+	if src == nil {
+		src = &bzl.ListExpr{}
+	}
+	dict.List = append(dict.List, &bzl.KeyValueExpr{
+		Key:   &bzl.StringExpr{Value: "//conditions:default"},
+		Value: src,
+	})
+	return nil
+}
+
+// withoutConditionalStrings returns a copy of list without strings that
+// appear in a non-default branch of any of selects.
+func withoutConditionalStrings(list *bzl.ListExpr, selects []*bzl.CallExpr) *bzl.ListExpr {
+	if list == nil {
+		return nil
+	}
+	conditional := make(map[string]bool)
+	for _, s := range selects {
+		for _, item := range selectDict(s).List {
+			kv, ok := item.(*bzl.KeyValueExpr)
+			if !ok || stringValue(kv.Key) == "//conditions:default" {
+				continue
+			}
+			if values, ok := kv.Value.(*bzl.ListExpr); ok {
+				for _, v := range values.List {
+					conditional[stringValue(v)] = true
+				}
+			}
+		}
+	}
+	filtered := &bzl.ListExpr{ForceMultiLine: list.ForceMultiLine}
+	for _, v := range list.List {
+		if s := stringValue(v); s == "" || !conditional[s] {
+			filtered.List = append(filtered.List, v)
+		}
+	}
+	return filtered
+}
+
+// selectDict returns the dict argument of e if e is a call to select with
+// a dict. Otherwise, selectDict returns nil.
+func selectDict(e bzl.Expr) *bzl.DictExpr {
+	call, ok := e.(*bzl.CallExpr)
+	if !ok || len(call.List) != 1 {
+		return nil
+	}
+	if x, ok := call.X.(*bzl.Ident); !ok || x.Name != "select" {
+		return nil
+	}
+	dict, _ := call.List[0].(*bzl.DictExpr)
+	return dict
+}
+
+// sumTerms returns the operands of e, if e is a sum like "a + b + c".
+// Otherwise, it returns e by itself. nil is returned if e is nil.
+func sumTerms(e bzl.Expr) []bzl.Expr {
+	if e == nil {
+		return nil
+	}
+	if b, ok := e.(*bzl.BinaryExpr); ok && b.Op == "+" {
+		return append(sumTerms(b.X), sumTerms(b.Y)...)
+	}
+	return []bzl.Expr{e}
+}
+
+// sumExpr returns the sum of terms, or nil if there are no terms.
+func sumExpr(terms []bzl.Expr) bzl.Expr {
+	if len(terms) == 0 {
+		return nil
+	}
+	sum := terms[0]
+	for _, t := range terms[1:] {
+		sum = &bzl.BinaryExpr{X: sum, Op: "+", Y: t}
+	}
+	return sum
+}
+
 func mergePlatformStringsExprs(src, dst platformStringsExprs) (platformStringsExprs, error) {
 	var ps platformStringsExprs
 	var err error
@@ -147,11 +406,18 @@ func mergeList(src, dst *bzl.ListExpr) *bzl.ListExpr {
 
 	// Build a list of strings from the src list and keep matching strings
 	// in the dst list. This preserves comments. Also keep anything with
-	// a "# keep" comment, whether or not it's in the src list.
+	// a "# keep" comment, whether or not it's in the src list. If a string
+	// in the src list has a suffix comment (for example, an annotation from
+	// AnnotatedStrings), it replaces the suffix comment of the matching
+	// string in the dst list.
 	srcSet := make(map[string]bool)
+	srcSuffix := make(map[string][]bzl.Comment)
 	for _, v := range src.List {
 		if s := stringValue(v); s != "" {
 			srcSet[s] = true
+			if suffix := v.Comment().Suffix; len(suffix) > 0 {
+				srcSuffix[s] = suffix
+			}
 		}
 	}
 
@@ -162,6 +428,9 @@ func mergeList(src, dst *bzl.ListExpr) *bzl.ListExpr {
 		s := stringValue(v)
 		if keep := ShouldKeep(v); keep || srcSet[s] {
 			keepComment = keepComment || keep
+			if suffix, ok := srcSuffix[s]; ok && !keep {
+				v.Comment().Suffix = suffix
+			}
 			merged = append(merged, v)
 			if s != "" {
 				kept[s] = true
@@ -616,6 +616,33 @@ func (r *Rule) ShouldKeep() bool {
 	return ShouldKeep(r.expr)
 }
 
+// Comments returns the text of the comments that appear immediately before
+// the rule, including the leading "#" of each line.
+func (r *Rule) Comments() []string {
+	var comments []string
+	for _, c := range r.expr.Comment().Before {
+		comments = append(comments, c.Token)
+	}
+	return comments
+}
+
+// AddComment adds a comment line immediately before the rule, after any
+// existing comments. token should start with "#".
+func (r *Rule) AddComment(token string) {
+	cs := r.expr.Comment()
+	cs.Before = append(cs.Before, bzl.Comment{Token: token})
+}
+
+// SetComments replaces the comments that appear immediately before the rule
+// with the given lines. Each line should start with "#".
+func (r *Rule) SetComments(tokens []string) {
+	cs := r.expr.Comment()
+	cs.Before = nil
+	for _, t := range tokens {
+		cs.Before = append(cs.Before, bzl.Comment{Token: t})
+	}
+}
+
 // Kind returns the kind of rule this is (for example, "go_library").
 func (r *Rule) Kind() string {
 	return r.kind
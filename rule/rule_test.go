@@ -346,3 +346,28 @@ func TestShouldKeepExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestRuleComments(t *testing.T) {
+	f, err := LoadData("BUILD.bazel", "", []byte(`
+# first
+x_library(name = "x")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.Rules[0]
+	if got, want := r.Comments(), []string{"# first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	r.AddComment("# second")
+	if got, want := r.Comments(), []string{"# first", "# second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after AddComment: got %q; want %q", got, want)
+	}
+	r.SetComments([]string{"# replaced"})
+	want := `# replaced
+x_library(name = "x")
+`
+	if got := string(f.Format()); got != want {
+		t.Errorf("after SetComments: got:\n%s\nwant:\n%s", got, want)
+	}
+}
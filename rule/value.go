@@ -43,6 +43,39 @@ type BzlExprValue interface {
 	BzlExpr() bzl.Expr
 }
 
+// AnnotatedString is a string with an optional comment, written after the
+// string on the same line.
+type AnnotatedString struct {
+	Value string
+
+	// Comment is the text of the comment, without the leading "#". If empty,
+	// no comment is written.
+	Comment string
+}
+
+// AnnotatedStrings is a list of strings with comments. It can be translated
+// to a list expression where each string with a comment is written on its
+// own line, followed by the comment.
+//
+// When a list of annotated strings is merged into an existing list with
+// MergeRules, comments on generated strings replace comments after the same
+// strings in the existing list, so running Gazelle repeatedly does not
+// accumulate duplicate comments.
+type AnnotatedStrings []AnnotatedString
+
+func (as AnnotatedStrings) BzlExpr() bzl.Expr {
+	list := &bzl.ListExpr{List: make([]bzl.Expr, 0, len(as))}
+	for _, a := range as {
+		s := &bzl.StringExpr{Value: a.Value}
+		if a.Comment != "" {
+			s.Comments.Suffix = []bzl.Comment{{Token: "# " + a.Comment}}
+			list.ForceMultiLine = true
+		}
+		list.List = append(list.List, s)
+	}
+	return list
+}
+
 // SelectStringListValue is a value that can be translated to a Bazel
 // select expression that picks a string list based on a string condition.
 type SelectStringListValue map[string][]string